@@ -4,10 +4,17 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	appConstants "github.com/gjbastidas/GoSimpleAPIWithMongoDB/constants"
 	"github.com/gjbastidas/GoSimpleAPIWithMongoDB/env"
@@ -19,12 +26,41 @@ import (
 )
 
 type App struct {
-	mCl *mongo.Client
-	cfg *env.AppConfig
+	mCl       *mongo.Client
+	cfg       *env.AppConfig
+	thumbs    *thumbnailer
+	renders   *renderCache
+	publisher *publisher
 }
 
 func New() *App {
 	a := new(App)
+	a.connect()
+	a.serve()
+	return a
+}
+
+// Reconcile recomputes the comment counts denormalized in posts, fixing the ones that drifted
+func Reconcile() {
+	a := new(App)
+	a.connect()
+
+	ctx, cancel := context.WithTimeout(context.Background(), appConstants.ReconcileTimeout)
+	defer cancel()
+	fixed, err := appDb.ReconcileCommentCounts(ctx, a.mCl, appConstants.DbName, appConstants.PColl, appConstants.CColl)
+	if err != nil {
+		klog.Fatalf("cannot reconcile comment counts: %v", err)
+	}
+	klog.Infof("fixed comment counts of %d posts", fixed)
+
+	err = a.mCl.Disconnect(ctx)
+	if err != nil {
+		klog.Errorf("cannot disconnect from mongodb: %v", err)
+	}
+}
+
+// connect sets up the mongodb client from the environment and makes sure indexes exist
+func (a *App) connect() {
 	var err error
 
 	// set environment variables
@@ -32,6 +68,10 @@ func New() *App {
 	if err != nil {
 		klog.Fatalf("bad application configuration. error: %v", err)
 	}
+	err = appDb.CheckModerationMode(appDb.ModerationMode(a.cfg.ModerationMode))
+	if err != nil {
+		klog.Fatalf("bad application configuration. error: %v", err)
+	}
 
 	// set mongodb client
 	a.mCl, err = appDb.NewClient(a.cfg.DbUsername, a.cfg.DbPassword, a.cfg.DbHost, a.cfg.DbPort)
@@ -47,31 +87,29 @@ func New() *App {
 		klog.Fatal(err)
 	}
 
-	a.serve()
-	return a
+	err = appDb.EnsureIndexes(ctx, a.mCl, appConstants.DbName)
+	if err != nil {
+		klog.Fatalf("cannot create indexes: %v", err)
+	}
 }
 
-// serve wires up routes and run server
+// serve starts the background workers and runs the server
 func (a *App) serve() {
-	// routing details
-	r := mux.NewRouter()
-
-	pSbr := r.PathPrefix("/post").Subrouter()
-	pSbr.HandleFunc("/", a.handleCreatePost(new(appDb.PostDoc), appConstants.DbName, appConstants.PColl)).Methods(http.MethodPost)
-	pSbr.HandleFunc("/{id:[a-z0-9]+}", a.handleGetPost(new(appDb.PostDoc), appConstants.DbName, appConstants.PColl)).Methods(http.MethodGet)
-	pSbr.HandleFunc("/{id:[a-z0-9]+}", a.handlePutPost(new(appDb.PostDoc), appConstants.DbName, appConstants.PColl)).Methods(http.MethodPut)
-	pSbr.HandleFunc("/{id:[a-z0-9]+}", a.handleDeletePost(new(appDb.PostDoc), appConstants.DbName, appConstants.PColl)).Methods(http.MethodDelete)
+	a.thumbs = newThumbnailer(appDb.NewPost, a.mCl, a.cfg.ThumbnailSizes, a.cfg.ThumbnailWorkers, appConstants.DbName, appConstants.PColl)
+	a.thumbs.start()
+	a.renders = newRenderCache(appConstants.RenderCacheSize)
+	a.publisher = newPublisher(appDb.NewPost, a.mCl, appConstants.PublishInterval, appConstants.DbName, appConstants.PColl)
+	a.publisher.start()
 
-	cSbr := r.PathPrefix("/comment").Subrouter()
-	cSbr.HandleFunc("/", a.handleCreateComment(appDb.NewModels(), appConstants.DbName)).Methods(http.MethodPost)
-	cSbr.HandleFunc("/{id:[a-z0-9]+}", a.handleGetComment(new(appDb.CommentDoc), appConstants.DbName, appConstants.CColl)).Methods(http.MethodGet)
-	cSbr.HandleFunc("/{id:[a-z0-9]+}", a.handlePutComment(new(appDb.CommentDoc), appConstants.DbName, appConstants.CColl)).Methods(http.MethodPut)
-	cSbr.HandleFunc("/{id:[a-z0-9]+}", a.handleDeleteComment(new(appDb.CommentDoc), appConstants.DbName, appConstants.CColl)).Methods(http.MethodDelete)
+	// base context of every request, cancelled if graceful shutdown times out
+	baseCtx, cancelBase := context.WithCancel(context.Background())
+	defer cancelBase()
 
 	// http server configs
 	srv := &http.Server{
-		Addr:    ":8088",
-		Handler: r,
+		Addr:        ":8088",
+		Handler:     a.routes(),
+		BaseContext: func(net.Listener) context.Context { return baseCtx },
 	}
 
 	// graceful server shutdown
@@ -86,6 +124,7 @@ func (a *App) serve() {
 		defer cancel()
 		if err := srv.Shutdown(ctx); err != nil {
 			klog.Errorf("server shutdown error: %v", err)
+			cancelBase()
 		}
 		klog.Info("server shutdown complete")
 
@@ -100,37 +139,231 @@ func (a *App) serve() {
 
 	// waits until any SIGINT or SIGTERM os signal is sent
 	<-done
+	a.thumbs.stop()
+	a.publisher.stop()
 	klog.Info("app stopped")
 }
 
-func (a *App) handleCreatePost(p appDb.Post, dbName, colName string) http.HandlerFunc {
+// routes wires up the endpoints of the app
+func (a *App) routes() *mux.Router {
+	r := mux.NewRouter()
+	r.Use(requestTimeout)
+
+	pSbr := r.PathPrefix("/post").Subrouter()
+	pSbr.HandleFunc("/", a.handleCreatePost(appDb.NewModels(), appConstants.DbName)).Methods(http.MethodPost)
+	pSbr.HandleFunc("/_bulk", a.handleBulkCreatePosts(appDb.NewModels(), appConstants.DbName)).Methods(http.MethodPost)
+	pSbr.HandleFunc("/_bulk/delete", a.handleBulkDeletePosts(appDb.NewModels(), appConstants.DbName)).Methods(http.MethodPost)
+	pSbr.HandleFunc("/", a.handleListPosts(appDb.NewPost, appConstants.DbName, appConstants.PColl)).Methods(http.MethodGet)
+	pSbr.HandleFunc("/{id:[a-z0-9]+}", a.handleGetPost(appDb.NewModels(), appConstants.DbName)).Methods(http.MethodGet)
+	pSbr.HandleFunc("/{id:[a-z0-9]+}", a.handlePutPost(appDb.NewPost, appConstants.DbName, appConstants.PColl)).Methods(http.MethodPut)
+	pSbr.HandleFunc("/{id:[a-z0-9]+}", a.handlePatchPost(appDb.NewPost, appConstants.DbName, appConstants.PColl)).Methods(http.MethodPatch)
+	pSbr.HandleFunc("/{id:[a-z0-9]+}", a.handleDeletePost(appDb.NewModels(), appConstants.DbName)).Methods(http.MethodDelete)
+	pSbr.HandleFunc("/{id:[a-z0-9]+}/revisions", a.handleListRevisions(appDb.NewPost, appConstants.DbName, appConstants.PColl)).Methods(http.MethodGet)
+	pSbr.HandleFunc("/{id:[a-z0-9]+}/revisions/{n:[0-9]+}", a.handleGetRevision(appDb.NewPost, appConstants.DbName, appConstants.PColl)).Methods(http.MethodGet)
+	pSbr.HandleFunc("/{id:[a-z0-9]+}/revisions/{n:[0-9]+}/diff", a.handleDiffRevisions(appDb.NewPost, appConstants.DbName, appConstants.PColl)).Methods(http.MethodGet)
+	pSbr.HandleFunc("/{id:[a-z0-9]+}/revisions/{n:[0-9]+}/restore", a.handleRestoreRevision(appDb.NewPost, appConstants.DbName, appConstants.PColl)).Methods(http.MethodPost)
+	pSbr.HandleFunc("/{id:[a-z0-9]+}/reactions", a.handleAddPostReaction(appDb.NewModels(), appConstants.DbName)).Methods(http.MethodPost)
+	pSbr.HandleFunc("/{id:[a-z0-9]+}/reactions", a.handleRemovePostReaction(appDb.NewPost, appConstants.DbName, appConstants.PColl)).Methods(http.MethodDelete)
+	pSbr.HandleFunc("/{id:[a-z0-9]+}/attachments", a.handleAddPostAttachment(appDb.NewPost, appConstants.DbName, appConstants.PColl)).Methods(http.MethodPost)
+	pSbr.HandleFunc("/{id:[a-z0-9]+}/attachments/{fileId:[a-z0-9]+}", a.handleGetPostAttachment(appDb.NewPost, appConstants.DbName, appConstants.PColl)).Methods(http.MethodGet)
+	pSbr.HandleFunc("/{id:[a-z0-9]+}/attachments/{fileId:[a-z0-9]+}", a.handleDeletePostAttachment(appDb.NewPost, appConstants.DbName, appConstants.PColl)).Methods(http.MethodDelete)
+	pSbr.HandleFunc("/{id:[a-z0-9]+}/comments/tree", a.handleGetCommentTree(appDb.NewModels(), appConstants.DbName)).Methods(http.MethodGet)
+	pSbr.HandleFunc("/{id:[a-z0-9]+}/comments", a.handleListPostComments(appDb.NewModels(), appConstants.DbName)).Methods(http.MethodGet)
+
+	cSbr := r.PathPrefix("/comment").Subrouter()
+	cSbr.HandleFunc("/", a.handleCreateComment(appDb.NewModels(), appConstants.DbName)).Methods(http.MethodPost)
+	cSbr.HandleFunc("/_bulk", a.handleBulkCreateComments(appDb.NewModels(), appConstants.DbName)).Methods(http.MethodPost)
+	cSbr.HandleFunc("/_bulk/delete", a.handleBulkDeleteComments(appDb.NewModels(), appConstants.DbName)).Methods(http.MethodPost)
+	cSbr.HandleFunc("/{id:[a-z0-9]+}", a.handleGetComment(appDb.NewComment, appConstants.DbName, appConstants.CColl)).Methods(http.MethodGet)
+	cSbr.HandleFunc("/{id:[a-z0-9]+}", a.handlePutComment(appDb.NewComment, appConstants.DbName, appConstants.CColl)).Methods(http.MethodPut)
+	cSbr.HandleFunc("/{id:[a-z0-9]+}", a.handlePatchComment(appDb.NewComment, appConstants.DbName, appConstants.CColl)).Methods(http.MethodPatch)
+	cSbr.HandleFunc("/{id:[a-z0-9]+}", a.handleDeleteComment(appDb.NewModels(), appConstants.DbName)).Methods(http.MethodDelete)
+
+	cSbr.HandleFunc("/{id:[a-z0-9]+}/reactions", a.handleAddCommentReaction(appDb.NewModels(), appConstants.DbName)).Methods(http.MethodPost)
+	cSbr.HandleFunc("/{id:[a-z0-9]+}/reactions", a.handleRemoveCommentReaction(appDb.NewComment, appConstants.DbName, appConstants.CColl)).Methods(http.MethodDelete)
+
+	aSbr := r.PathPrefix("/author").Subrouter()
+	aSbr.HandleFunc("/", a.handleCreateAuthor(appDb.NewAuthor, appConstants.DbName, appConstants.AColl)).Methods(http.MethodPost)
+	aSbr.HandleFunc("/", a.handleListAuthors(appDb.NewAuthor, appConstants.DbName, appConstants.AColl)).Methods(http.MethodGet)
+	aSbr.HandleFunc("/{id:[a-z0-9]+}", a.handleGetAuthor(appDb.NewAuthor, appConstants.DbName, appConstants.AColl)).Methods(http.MethodGet)
+	aSbr.HandleFunc("/{id:[a-z0-9]+}", a.handlePutAuthor(appDb.NewModels(), appConstants.DbName)).Methods(http.MethodPut)
+	aSbr.HandleFunc("/{id:[a-z0-9]+}", a.handleDeleteAuthor(appDb.NewModels(), appConstants.DbName)).Methods(http.MethodDelete)
+	aSbr.HandleFunc("/{id:[a-z0-9]+}/posts", a.handleListAuthorPosts(appDb.NewModels(), appConstants.DbName)).Methods(http.MethodGet)
+	aSbr.HandleFunc("/{id:[a-z0-9]+}/comments", a.handleListAuthorComments(appDb.NewModels(), appConstants.DbName)).Methods(http.MethodGet)
+
+	r.HandleFunc("/tags", a.handleListTags(appDb.NewPost, appConstants.DbName, appConstants.PColl)).Methods(http.MethodGet)
+	r.HandleFunc("/search", a.handleSearch(appDb.NewModels(), appConstants.DbName)).Methods(http.MethodGet)
+
+	adSbr := r.PathPrefix("/admin").Subrouter()
+	adSbr.Use(requireAdmin(a.cfg.AdminToken))
+	adSbr.HandleFunc("/export", a.handleExport(appDb.NewModels(), appConstants.DbName)).Methods(http.MethodGet)
+	adSbr.HandleFunc("/import", a.handleImport(appDb.NewModels(), appConstants.DbName)).Methods(http.MethodPost)
+
+	mSbr := r.PathPrefix("/moderation").Subrouter()
+	mSbr.Use(requireModerator(a.cfg.ModeratorToken))
+	mSbr.HandleFunc("/comments", a.handleListModerationQueue(appDb.NewComment, appConstants.DbName, appConstants.CColl)).Methods(http.MethodGet)
+	mSbr.HandleFunc("/comments/{id:[a-z0-9]+}/approve", a.handleModerateComment(appDb.NewModels(), appConstants.DbName, appDb.CommentApproved)).Methods(http.MethodPost)
+	mSbr.HandleFunc("/comments/{id:[a-z0-9]+}/reject", a.handleModerateComment(appDb.NewModels(), appConstants.DbName, appDb.CommentRejected)).Methods(http.MethodPost)
+
+	return r
+}
+
+func (a *App) handleCreatePost(models *appDb.Models, dbName string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		err := json.NewDecoder(r.Body).Decode(&p)
+		p := models.P()
+		err := json.NewDecoder(r.Body).Decode(p)
 		if err != nil {
 			jsonPrintError(w, http.StatusBadRequest, err.Error(), "cannot decode body")
 			return
 		}
 
-		res, err := p.CreatePost(a.mCl, dbName, colName)
-		if err != nil {
-			jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot create post")
+		author, ok := a.readAuthorOf(w, r, models, dbName, p.GetAuthorId())
+		if !ok {
 			return
 		}
+		p.SetAuthor(author)
+
+		res, err := p.CreatePost(r.Context(), a.mCl, dbName, models.PColName)
+		if err != nil {
+			switch {
+			case errors.Is(err, appDb.ErrPublishAtRequired):
+				jsonPrintError(w, http.StatusBadRequest, err.Error(), "cannot create post")
+				return
+			default:
+				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot create post")
+				return
+			}
+		}
 
 		jsonPrint(w, http.StatusCreated, res)
 	}
 }
 
-func (a *App) handleGetPost(p appDb.Post, dbName, colName string) http.HandlerFunc {
+// handleBulkCreatePosts creates the posts of a json array, each one like handleCreatePost
+func (a *App) handleBulkCreatePosts(models *appDb.Models, dbName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ordered, err := boolParam(r, "ordered", true)
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid ordered parameter")
+			return
+		}
+		posts, err := decodeBulk[*appDb.PostDoc](r)
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "cannot decode body")
+			return
+		}
+
+		authorOf := memo(func(idStr string) (*appDb.AuthorDoc, *bulkItem) {
+			return bulkRead(idStr, "author", func(objId primitive.ObjectID) (*appDb.AuthorDoc, error) {
+				return models.A().ReadAuthor(r.Context(), a.mCl, objId, dbName, models.AColName)
+			})
+		})
+		items := make([]*bulkItem, len(posts))
+		valid, at := make([]*appDb.PostDoc, 0, len(posts)), make([]int, 0, len(posts))
+		for i, p := range posts {
+			author, item := authorOf(p.GetAuthorId())
+			if err := p.CheckSchedule(); err != nil {
+				item = &bulkItem{Status: http.StatusBadRequest, Error: err.Error()}
+			}
+			if item != nil {
+				items[i] = item
+				if ordered {
+					break
+				}
+				continue
+			}
+			p.SetAuthor(author)
+			valid, at = append(valid, p), append(at, i)
+		}
+
+		results, err := models.P().CreatePosts(r.Context(), a.mCl, valid, ordered, dbName, models.PColName)
+		if err != nil {
+			jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot create posts")
+			return
+		}
+		for j, res := range results {
+			items[at[j]] = bulkItemOf(res, http.StatusCreated)
+		}
+
+		jsonPrint(w, http.StatusOK, bulkResponseOf(items, ordered))
+	}
+}
+
+// handleBulkDeletePosts deletes the posts of a json array of ids, each one like handleDeletePost
+func (a *App) handleBulkDeletePosts(models *appDb.Models, dbName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ordered, err := boolParam(r, "ordered", true)
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid ordered parameter")
+			return
+		}
+		detach, err := boolParam(r, "detachComments", false)
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid detachComments parameter")
+			return
+		}
+		idStrs, err := decodeBulk[string](r)
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "cannot decode body")
+			return
+		}
+
+		items, objIds, at := bulkObjIds(idStrs, "post", ordered)
+		results, err := models.P().DeletePosts(r.Context(), a.mCl, objIds, ordered, detach, dbName, models.PColName, models.CColName)
+		if err != nil {
+			jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot delete posts")
+			return
+		}
+		for j, res := range results {
+			items[at[j]] = bulkItemOf(res, http.StatusOK)
+			a.renders.invalidate(objIds[j])
+		}
+
+		jsonPrint(w, http.StatusOK, bulkResponseOf(items, ordered))
+	}
+}
+
+func (a *App) handleGetPost(models *appDb.Models, dbName string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		p := models.P()
 		vars := mux.Vars(r)
 		objId, err := primitive.ObjectIDFromHex(vars["id"])
 		if err != nil {
 			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid post id")
 			return
 		}
+		projection, err := fieldsParam(r, appDb.PostFieldNames)
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid fields parameter")
+			return
+		}
+		expand, commentsLimit, err := expandParams(r)
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid expand parameters")
+			return
+		}
+		render, err := renderParam(r)
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid render parameter")
+			return
+		}
+		viewer, err := viewerParam(r)
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid "+appConstants.AuthorHeader+" header")
+			return
+		}
+		// reads the fields rendering and visibility need too, the response is trimmed back to projection
+		read := projection.WithVisibilityFields()
+		if render {
+			read = read.WithRenderFields()
+		}
 
-		res, err := p.ReadPost(a.mCl, objId, dbName, colName)
+		res := new(appDb.ExpandedPost)
+		if len(expand) == 0 {
+			res.PostDoc, err = p.ReadPostFields(r.Context(), a.mCl, objId, read, dbName, models.PColName)
+		} else {
+			res, err = p.ReadPostExpanded(r.Context(), a.mCl, objId, read, expand, commentsLimit, dbName, models.PColName, models.CColName, models.AColName)
+		}
 		if err != nil {
 			switch err {
 			case mongo.ErrNoDocuments:
@@ -141,50 +374,76 @@ func (a *App) handleGetPost(p appDb.Post, dbName, colName string) http.HandlerFu
 				return
 			}
 		}
+		if !res.VisibleTo(viewer) {
+			jsonPrintError(w, http.StatusNotFound, mongo.ErrNoDocuments.Error(), "post not found")
+			return
+		}
+		if render {
+			res.ContentHTML, err = a.renderPost(res.PostDoc)
+			if err != nil {
+				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot render post")
+				return
+			}
+		}
 
+		setETag(w, res.Version)
+		projection.Trim(res.PostDoc)
 		jsonPrint(w, http.StatusOK, res)
 	}
 }
 
-func (a *App) handlePutPost(p appDb.Post, dbName, colName string) http.HandlerFunc {
+func (a *App) handleListPosts(newPost appDb.PostFactory, dbName, colName string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		vars := mux.Vars(r)
-		objId, err := primitive.ObjectIDFromHex(vars["id"])
+		p := newPost()
+		query, limit, err := listQueryParams(r, appDb.PostQueryFields, appDb.PostFieldNames)
 		if err != nil {
-			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid post id")
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid list parameters")
+			return
+		}
+		anyTag, err := tagModeParam(r)
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid tagMode parameter")
+			return
+		}
+		viewer, err := viewerParam(r)
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid "+appConstants.AuthorHeader+" header")
 			return
 		}
+		query.Restrict(appDb.PostsVisibleTo(viewer))
 
-		_, err = p.ReadPost(a.mCl, objId, dbName, colName)
+		res, err := p.ListPosts(r.Context(), a.mCl, r.URL.Query()["tag"], anyTag, query, limit, dbName, colName)
 		if err != nil {
-			switch err {
-			case mongo.ErrNoDocuments:
-				jsonPrintError(w, http.StatusNotFound, err.Error(), "post not found")
-				return
-			default:
-				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot read post")
-				return
-			}
+			jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot list posts")
+			return
 		}
 
-		err = json.NewDecoder(r.Body).Decode(&p)
+		jsonPrint(w, http.StatusOK, res)
+	}
+}
+
+func (a *App) handleListTags(newPost appDb.PostFactory, dbName, colName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := newPost()
+		limit, err := limitParam(r)
 		if err != nil {
-			jsonPrintError(w, http.StatusBadRequest, err.Error(), "cannot decode body")
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid limit parameter")
 			return
 		}
 
-		err = p.UpdatePost(a.mCl, objId, dbName, colName)
+		res, err := p.CountTags(r.Context(), a.mCl, limit, dbName, colName)
 		if err != nil {
-			jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot update post")
+			jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot count tags")
 			return
 		}
 
-		jsonPrint(w, http.StatusOK, map[string]string{"msj": "post updated"})
+		jsonPrint(w, http.StatusOK, map[string]any{"items": res})
 	}
 }
 
-func (a *App) handleDeletePost(p appDb.Post, dbName, colName string) http.HandlerFunc {
+func (a *App) handlePutPost(newPost appDb.PostFactory, dbName, colName string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		p := newPost()
 		vars := mux.Vars(r)
 		objId, err := primitive.ObjectIDFromHex(vars["id"])
 		if err != nil {
@@ -192,7 +451,13 @@ func (a *App) handleDeletePost(p appDb.Post, dbName, colName string) http.Handle
 			return
 		}
 
-		_, err = p.ReadPost(a.mCl, objId, dbName, colName)
+		version, err := ifMatch(r, a.postVersion(r, newPost(), objId, dbName, colName))
+		if err != nil {
+			ifMatchError(w, err, "post")
+			return
+		}
+
+		_, err = newPost().ReadPost(r.Context(), a.mCl, objId, dbName, colName)
 		if err != nil {
 			switch err {
 			case mongo.ErrNoDocuments:
@@ -204,141 +469,1547 @@ func (a *App) handleDeletePost(p appDb.Post, dbName, colName string) http.Handle
 			}
 		}
 
-		err = p.DeletePost(a.mCl, objId, dbName, colName)
+		err = json.NewDecoder(r.Body).Decode(p)
 		if err != nil {
-			jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot delete post")
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "cannot decode body")
 			return
 		}
 
-		jsonPrint(w, http.StatusOK, map[string]string{"msj": "post deleted"})
+		err = p.ReplacePost(r.Context(), a.mCl, objId, version, dbName, colName)
+		if err != nil {
+			switch {
+			case errors.Is(err, appDb.ErrVersionMismatch):
+				jsonPrintError(w, http.StatusPreconditionFailed, err.Error(), "cannot update post")
+				return
+			case errors.Is(err, appDb.ErrPublishAtRequired):
+				jsonPrintError(w, http.StatusBadRequest, err.Error(), "cannot update post")
+				return
+			case errors.Is(err, mongo.ErrNoDocuments):
+				jsonPrintError(w, http.StatusNotFound, err.Error(), "post not found")
+				return
+			default:
+				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot update post")
+				return
+			}
+		}
+
+		a.renders.invalidate(objId)
+		jsonPrint(w, http.StatusOK, map[string]string{"msj": "post updated"})
 	}
 }
 
-func (a *App) handleCreateComment(models *appDb.Models, dbName string) http.HandlerFunc {
+func (a *App) handlePatchPost(newPost appDb.PostFactory, dbName, colName string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		err := json.NewDecoder(r.Body).Decode(models.C)
+		p := newPost()
+		vars := mux.Vars(r)
+		objId, err := primitive.ObjectIDFromHex(vars["id"])
 		if err != nil {
-			jsonPrintError(w, http.StatusBadRequest, err.Error(), "cannot decode body")
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid post id")
 			return
 		}
 
-		postIdStr := models.C.GetRelatedPostId()
-		postId, err := primitive.ObjectIDFromHex(postIdStr)
+		version, err := ifMatch(r, a.postVersion(r, newPost(), objId, dbName, colName))
 		if err != nil {
-			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid post id")
+			ifMatchError(w, err, "post")
+			return
+		}
+
+		patch, code, err := decodeMergePatch(r)
+		if err != nil {
+			jsonPrintError(w, code, err.Error(), "cannot decode merge patch")
 			return
 		}
-		_, err = models.P.ReadPost(a.mCl, postId, dbName, models.PColName)
+
+		_, err = p.ReadPost(r.Context(), a.mCl, objId, dbName, colName)
 		if err != nil {
 			switch err {
 			case mongo.ErrNoDocuments:
-				jsonPrintError(w, http.StatusNotFound, err.Error(), "not found post with id: "+postId.String())
+				jsonPrintError(w, http.StatusNotFound, err.Error(), "post not found")
 				return
 			default:
-				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot read post with id: "+postId.String())
+				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot read post")
 				return
 			}
 		}
 
-		res, err := models.C.CreateComment(a.mCl, dbName, models.CColName)
+		err = p.PatchPost(r.Context(), a.mCl, objId, patch, version, dbName, colName)
 		if err != nil {
-			jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot create comment on post with id: "+postId.String())
-			return
+			switch {
+			case errors.Is(err, appDb.ErrVersionMismatch):
+				jsonPrintError(w, http.StatusPreconditionFailed, err.Error(), "cannot patch post")
+				return
+			case errors.Is(err, mongo.ErrNoDocuments):
+				jsonPrintError(w, http.StatusNotFound, err.Error(), "post not found")
+				return
+			case errors.Is(err, appDb.ErrInvalidPatch), errors.Is(err, appDb.ErrPublishAtRequired):
+				jsonPrintError(w, http.StatusBadRequest, err.Error(), "cannot patch post")
+				return
+			default:
+				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot patch post")
+				return
+			}
 		}
 
-		jsonPrint(w, http.StatusCreated, res)
+		a.renders.invalidate(objId)
+		jsonPrint(w, http.StatusOK, map[string]string{"msj": "post updated"})
 	}
 }
 
-func (a *App) handleGetComment(c appDb.Comment, dbName, colName string) http.HandlerFunc {
+func (a *App) handleDeletePost(models *appDb.Models, dbName string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		objId, err := primitive.ObjectIDFromHex(vars["id"])
 		if err != nil {
-			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid comment id")
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid post id")
+			return
+		}
+
+		version, err := ifMatch(r, a.postVersion(r, models.P(), objId, dbName, models.PColName))
+		if err != nil {
+			ifMatchError(w, err, "post")
 			return
 		}
 
-		res, err := c.ReadComment(a.mCl, objId, dbName, colName)
+		detach := false
+		if d := r.URL.Query().Get("detachComments"); d != "" {
+			detach, err = strconv.ParseBool(d)
+			if err != nil {
+				jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid detachComments parameter")
+				return
+			}
+		}
+
+		p := models.P()
+		_, err = p.ReadPost(r.Context(), a.mCl, objId, dbName, models.PColName)
 		if err != nil {
 			switch err {
 			case mongo.ErrNoDocuments:
-				jsonPrintError(w, http.StatusNotFound, err.Error(), "comment not found")
+				jsonPrintError(w, http.StatusNotFound, err.Error(), "post not found")
 				return
 			default:
-				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot read comment")
+				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot read post")
+				return
+			}
+		}
+
+		n, err := p.DeletePost(r.Context(), a.mCl, objId, version, detach, dbName, models.PColName, models.CColName)
+		if err != nil {
+			switch {
+			case errors.Is(err, appDb.ErrVersionMismatch):
+				jsonPrintError(w, http.StatusPreconditionFailed, err.Error(), "cannot delete post")
+				return
+			case errors.Is(err, mongo.ErrNoDocuments):
+				jsonPrintError(w, http.StatusNotFound, err.Error(), "post not found")
+				return
+			default:
+				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot delete post")
 				return
 			}
 		}
 
+		a.renders.invalidate(objId)
+		res := map[string]any{"msj": "post deleted", "commentsDeleted": n}
+		if detach {
+			res = map[string]any{"msj": "post deleted", "commentsDetached": n}
+		}
 		jsonPrint(w, http.StatusOK, res)
 	}
 }
 
-func (a *App) handlePutComment(c appDb.Comment, dbName, colName string) http.HandlerFunc {
+func (a *App) handleListRevisions(newPost appDb.PostFactory, dbName, colName string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		p := newPost()
 		vars := mux.Vars(r)
 		objId, err := primitive.ObjectIDFromHex(vars["id"])
 		if err != nil {
-			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid comment id")
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid post id")
 			return
 		}
 
-		_, err = c.ReadComment(a.mCl, objId, dbName, colName)
+		cursor, limit, err := pageParams(r)
 		if err != nil {
-			switch err {
-			case mongo.ErrNoDocuments:
-				jsonPrintError(w, http.StatusNotFound, err.Error(), "comment not found")
-				return
-			default:
-				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot read comment")
-				return
-			}
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid pagination parameters")
+			return
 		}
 
-		err = json.NewDecoder(r.Body).Decode(&c)
-		if err != nil {
-			jsonPrintError(w, http.StatusBadRequest, err.Error(), "cannot decode comment body")
+		_, ok := a.readVisiblePost(w, r, p, objId, nil, dbName, colName)
+		if !ok {
 			return
 		}
 
-		err = c.UpdateComment(a.mCl, objId, dbName, colName)
+		res, err := p.ListRevisions(r.Context(), a.mCl, objId, cursor, limit, dbName, colName)
 		if err != nil {
-			jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot update comment with id: "+vars["id"])
+			jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot list revisions")
 			return
 		}
 
-		jsonPrint(w, http.StatusOK, map[string]string{"msj": "comment updated"})
+		jsonPrint(w, http.StatusOK, res)
 	}
 }
 
-func (a *App) handleDeleteComment(c appDb.Comment, dbName, colName string) http.HandlerFunc {
+func (a *App) handleGetRevision(newPost appDb.PostFactory, dbName, colName string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		p := newPost()
 		vars := mux.Vars(r)
 		objId, err := primitive.ObjectIDFromHex(vars["id"])
 		if err != nil {
-			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid comment id")
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid post id")
+			return
+		}
+		n, err := strconv.ParseInt(vars["n"], 10, 64)
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid revision")
+			return
+		}
+		_, ok := a.readVisiblePost(w, r, p, objId, nil, dbName, colName)
+		if !ok {
 			return
 		}
 
-		_, err = c.ReadComment(a.mCl, objId, dbName, colName)
+		res, err := p.ReadRevision(r.Context(), a.mCl, objId, n, dbName, colName)
 		if err != nil {
 			switch err {
 			case mongo.ErrNoDocuments:
-				jsonPrintError(w, http.StatusNotFound, err.Error(), "comment not found")
+				jsonPrintError(w, http.StatusNotFound, err.Error(), "revision not found")
 				return
 			default:
-				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot read comment")
+				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot read revision")
 				return
 			}
 		}
 
-		err = c.DeleteComment(a.mCl, objId, dbName, colName)
+		jsonPrint(w, http.StatusOK, res)
+	}
+}
+
+func (a *App) handleDiffRevisions(newPost appDb.PostFactory, dbName, colName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := newPost()
+		vars := mux.Vars(r)
+		objId, err := primitive.ObjectIDFromHex(vars["id"])
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid post id")
+			return
+		}
+		n, err := strconv.ParseInt(vars["n"], 10, 64)
 		if err != nil {
-			jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot delete comment")
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid revision")
 			return
 		}
 
-		jsonPrint(w, http.StatusOK, map[string]string{"msj": "comment deleted"})
+		// compares against the current version unless told otherwise
+		var to int64
+		if t := r.URL.Query().Get("to"); t != "" {
+			to, err = strconv.ParseInt(t, 10, 64)
+			if err != nil {
+				jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid to revision")
+				return
+			}
+		}
+		cur, ok := a.readVisiblePost(w, r, p, objId, nil, dbName, colName)
+		if !ok {
+			return
+		}
+		if to == 0 {
+			to = cur.Version
+		}
+
+		revs := make([]*appDb.RevisionDoc, 0, 2)
+		for _, rn := range []int64{n, to} {
+			rev, err := p.ReadRevision(r.Context(), a.mCl, objId, rn, dbName, colName)
+			if err != nil {
+				switch err {
+				case mongo.ErrNoDocuments:
+					jsonPrintError(w, http.StatusNotFound, err.Error(), "revision not found")
+					return
+				default:
+					jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot read revision")
+					return
+				}
+			}
+			revs = append(revs, rev)
+		}
+
+		diff, err := appDb.DiffRevisions(revs[0], revs[1])
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "cannot compare revisions")
+			return
+		}
+
+		jsonPrint(w, http.StatusOK, map[string]any{"from": n, "to": to, "diff": diff})
+	}
+}
+
+func (a *App) handleRestoreRevision(newPost appDb.PostFactory, dbName, colName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := newPost()
+		vars := mux.Vars(r)
+		objId, err := primitive.ObjectIDFromHex(vars["id"])
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid post id")
+			return
+		}
+		n, err := strconv.ParseInt(vars["n"], 10, 64)
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid revision")
+			return
+		}
+
+		version, err := ifMatch(r, a.postVersion(r, newPost(), objId, dbName, colName))
+		if err != nil {
+			ifMatchError(w, err, "post")
+			return
+		}
+
+		err = p.RestoreRevision(r.Context(), a.mCl, objId, n, version, dbName, colName)
+		if err != nil {
+			switch {
+			case errors.Is(err, appDb.ErrVersionMismatch):
+				jsonPrintError(w, http.StatusPreconditionFailed, err.Error(), "cannot restore revision")
+				return
+			case errors.Is(err, appDb.ErrPublishAtRequired):
+				jsonPrintError(w, http.StatusConflict, err.Error(), "cannot restore revision")
+				return
+			case errors.Is(err, mongo.ErrNoDocuments):
+				jsonPrintError(w, http.StatusNotFound, err.Error(), "revision not found")
+				return
+			default:
+				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot restore revision")
+				return
+			}
+		}
+
+		a.renders.invalidate(objId)
+		jsonPrint(w, http.StatusOK, map[string]string{"msj": "post restored"})
+	}
+}
+
+func (a *App) handleCreateComment(models *appDb.Models, dbName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c := models.C()
+		err := json.NewDecoder(r.Body).Decode(c)
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "cannot decode body")
+			return
+		}
+
+		postIdStr := c.GetRelatedPostId()
+		postId, err := primitive.ObjectIDFromHex(postIdStr)
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid post id")
+			return
+		}
+		post, err := models.P().ReadPost(r.Context(), a.mCl, postId, dbName, models.PColName)
+		if err != nil {
+			switch err {
+			case mongo.ErrNoDocuments:
+				jsonPrintError(w, http.StatusNotFound, err.Error(), "not found post with id: "+postId.String())
+				return
+			default:
+				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot read post with id: "+postId.String())
+				return
+			}
+		}
+
+		author, ok := a.readAuthorOf(w, r, models, dbName, c.GetAuthorId())
+		if !ok {
+			return
+		}
+		c.SetAuthor(author)
+		status := a.newCommentStatus(post)
+		c.SetStatus(status)
+
+		if parentIdStr := c.GetParentId(); parentIdStr != "" {
+			parentId, err := primitive.ObjectIDFromHex(parentIdStr)
+			if err != nil {
+				jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid parent comment id")
+				return
+			}
+			parent, err := models.C().ReadComment(r.Context(), a.mCl, parentId, dbName, models.CColName)
+			if err != nil {
+				switch err {
+				case mongo.ErrNoDocuments:
+					jsonPrintError(w, http.StatusNotFound, err.Error(), "not found parent comment with id: "+parentId.String())
+					return
+				default:
+					jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot read parent comment with id: "+parentId.String())
+					return
+				}
+			}
+			if parent.PostId != postId.Hex() {
+				jsonPrintError(w, http.StatusBadRequest, "parent comment belongs to another post", "invalid parent comment with id: "+parentId.String())
+				return
+			}
+			c.ReplyTo(parent)
+		}
+
+		res, err := c.CreateComment(r.Context(), a.mCl, dbName, models.CColName, models.PColName)
+		if err != nil {
+			// the post may have been deleted meanwhile
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				jsonPrintError(w, http.StatusNotFound, err.Error(), "not found post with id: "+postId.String())
+				return
+			}
+			jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot create comment on post with id: "+postId.String())
+			return
+		}
+
+		// comments waiting for a moderator are not live yet
+		if status == appDb.CommentPending {
+			jsonPrint(w, http.StatusAccepted, res)
+			return
+		}
+		jsonPrint(w, http.StatusCreated, res)
+	}
+}
+
+// handleBulkCreateComments creates the comments of a json array, each one like handleCreateComment
+func (a *App) handleBulkCreateComments(models *appDb.Models, dbName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ordered, err := boolParam(r, "ordered", true)
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid ordered parameter")
+			return
+		}
+		comments, err := decodeBulk[*appDb.CommentDoc](r)
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "cannot decode body")
+			return
+		}
+
+		postOf := memo(func(idStr string) (*appDb.PostDoc, *bulkItem) {
+			return bulkRead(idStr, "post", func(objId primitive.ObjectID) (*appDb.PostDoc, error) {
+				return models.P().ReadPost(r.Context(), a.mCl, objId, dbName, models.PColName)
+			})
+		})
+		authorOf := memo(func(idStr string) (*appDb.AuthorDoc, *bulkItem) {
+			return bulkRead(idStr, "author", func(objId primitive.ObjectID) (*appDb.AuthorDoc, error) {
+				return models.A().ReadAuthor(r.Context(), a.mCl, objId, dbName, models.AColName)
+			})
+		})
+		parentOf := memo(func(idStr string) (*appDb.CommentDoc, *bulkItem) {
+			return bulkRead(idStr, "parent comment", func(objId primitive.ObjectID) (*appDb.CommentDoc, error) {
+				return models.C().ReadComment(r.Context(), a.mCl, objId, dbName, models.CColName)
+			})
+		})
+		// prepare checks a comment like handleCreateComment does, returning its outcome when it fails
+		prepare := func(c *appDb.CommentDoc) *bulkItem {
+			post, item := postOf(c.GetRelatedPostId())
+			if item != nil {
+				return item
+			}
+			author, item := authorOf(c.GetAuthorId())
+			if item != nil {
+				return item
+			}
+			c.SetAuthor(author)
+			c.SetStatus(a.newCommentStatus(post))
+
+			if c.GetParentId() == "" {
+				return nil
+			}
+			parent, item := parentOf(c.GetParentId())
+			if item != nil {
+				return item
+			}
+			if parent.PostId != c.GetRelatedPostId() {
+				return &bulkItem{Status: http.StatusBadRequest, Error: "parent comment belongs to another post"}
+			}
+			c.ReplyTo(parent)
+			return nil
+		}
+
+		items := make([]*bulkItem, len(comments))
+		valid, at := make([]*appDb.CommentDoc, 0, len(comments)), make([]int, 0, len(comments))
+		for i, c := range comments {
+			if item := prepare(c); item != nil {
+				items[i] = item
+				if ordered {
+					break
+				}
+				continue
+			}
+			valid, at = append(valid, c), append(at, i)
+		}
+
+		results, err := models.C().CreateComments(r.Context(), a.mCl, valid, ordered, dbName, models.CColName, models.PColName)
+		if err != nil {
+			jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot create comments")
+			return
+		}
+		for j, res := range results {
+			items[at[j]] = bulkItemOf(res, http.StatusCreated)
+		}
+
+		jsonPrint(w, http.StatusOK, bulkResponseOf(items, ordered))
+	}
+}
+
+// handleBulkDeleteComments deletes the comments of a json array of ids, each one like handleDeleteComment
+func (a *App) handleBulkDeleteComments(models *appDb.Models, dbName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ordered, err := boolParam(r, "ordered", true)
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid ordered parameter")
+			return
+		}
+		idStrs, err := decodeBulk[string](r)
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "cannot decode body")
+			return
+		}
+
+		items, objIds, at := bulkObjIds(idStrs, "comment", ordered)
+		results, err := models.C().DeleteComments(r.Context(), a.mCl, objIds, ordered, dbName, models.CColName, models.PColName)
+		if err != nil {
+			jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot delete comments")
+			return
+		}
+		for j, res := range results {
+			items[at[j]] = bulkItemOf(res, http.StatusOK)
+		}
+
+		jsonPrint(w, http.StatusOK, bulkResponseOf(items, ordered))
+	}
+}
+
+func (a *App) handleListPostComments(models *appDb.Models, dbName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		postId, err := primitive.ObjectIDFromHex(vars["id"])
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid post id")
+			return
+		}
+
+		query, limit, err := listQueryParams(r, appDb.CommentQueryFields, appDb.CommentFieldNames)
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid list parameters")
+			return
+		}
+
+		viewer, err := viewerParam(r)
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid "+appConstants.AuthorHeader+" header")
+			return
+		}
+		query.Restrict(appDb.CommentsVisibleTo(viewer))
+
+		_, ok := a.readVisiblePost(w, r, models.P(), postId, nil, dbName, models.PColName)
+		if !ok {
+			return
+		}
+
+		res, err := models.C().ListPostComments(r.Context(), a.mCl, postId, query, limit, dbName, models.CColName)
+		if err != nil {
+			jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot list comments of post with id: "+postId.String())
+			return
+		}
+
+		jsonPrint(w, http.StatusOK, res)
+	}
+}
+
+func (a *App) handleAddPostReaction(models *appDb.Models, dbName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := models.P()
+		vars := mux.Vars(r)
+		objId, err := primitive.ObjectIDFromHex(vars["id"])
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid post id")
+			return
+		}
+
+		var body reactionBody
+		err = json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "cannot decode body")
+			return
+		}
+
+		_, err = p.ReadPost(r.Context(), a.mCl, objId, dbName, models.PColName)
+		if err != nil {
+			switch err {
+			case mongo.ErrNoDocuments:
+				jsonPrintError(w, http.StatusNotFound, err.Error(), "post not found")
+				return
+			default:
+				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot read post")
+				return
+			}
+		}
+
+		author, ok := a.readAuthorOf(w, r, models, dbName, body.AuthorId)
+		if !ok {
+			return
+		}
+
+		err = p.AddReaction(r.Context(), a.mCl, objId, author.Id, body.Type, dbName, models.PColName)
+		if err != nil {
+			switch {
+			case errors.Is(err, appDb.ErrInvalidReaction):
+				jsonPrintError(w, http.StatusBadRequest, err.Error(), "cannot react to post")
+				return
+			case errors.Is(err, appDb.ErrAlreadyReacted):
+				jsonPrintError(w, http.StatusConflict, err.Error(), "cannot react to post")
+				return
+			case errors.Is(err, mongo.ErrNoDocuments):
+				jsonPrintError(w, http.StatusNotFound, err.Error(), "post not found")
+				return
+			default:
+				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot react to post")
+				return
+			}
+		}
+
+		jsonPrint(w, http.StatusCreated, map[string]string{"msj": "reaction added"})
+	}
+}
+
+func (a *App) handleRemovePostReaction(newPost appDb.PostFactory, dbName, colName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := newPost()
+		vars := mux.Vars(r)
+		objId, err := primitive.ObjectIDFromHex(vars["id"])
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid post id")
+			return
+		}
+		authorId, err := primitive.ObjectIDFromHex(r.URL.Query().Get("authorId"))
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid author id")
+			return
+		}
+
+		err = p.RemoveReaction(r.Context(), a.mCl, objId, authorId, r.URL.Query().Get("type"), dbName, colName)
+		if err != nil {
+			switch {
+			case errors.Is(err, appDb.ErrInvalidReaction):
+				jsonPrintError(w, http.StatusBadRequest, err.Error(), "cannot remove post reaction")
+				return
+			case errors.Is(err, mongo.ErrNoDocuments):
+				jsonPrintError(w, http.StatusNotFound, err.Error(), "reaction not found")
+				return
+			default:
+				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot remove post reaction")
+				return
+			}
+		}
+
+		jsonPrint(w, http.StatusOK, map[string]string{"msj": "reaction removed"})
+	}
+}
+
+// handleAddPostAttachment uploads the file field of a multipart form as attachment of a post
+func (a *App) handleAddPostAttachment(newPost appDb.PostFactory, dbName, colName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := newPost()
+		vars := mux.Vars(r)
+		objId, err := primitive.ObjectIDFromHex(vars["id"])
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid post id")
+			return
+		}
+
+		// room for the other parts of the form, the file itself is limited while it is stored
+		r.Body = http.MaxBytesReader(w, r.Body, appConstants.MaxAttachmentSize+1024*1024)
+		part, code, err := filePart(r)
+		if err != nil {
+			jsonPrintError(w, code, err.Error(), "cannot read attachment")
+			return
+		}
+		defer part.Close()
+
+		res, err := p.AddAttachment(r.Context(), a.mCl, objId, part.FileName(), part, dbName, colName)
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			switch {
+			case errors.Is(err, mongo.ErrNoDocuments):
+				jsonPrintError(w, http.StatusNotFound, err.Error(), "post not found")
+				return
+			case errors.Is(err, appDb.ErrAttachmentType):
+				jsonPrintError(w, http.StatusUnsupportedMediaType, err.Error(), "cannot attach file to post")
+				return
+			case errors.Is(err, appDb.ErrAttachmentTooLarge), errors.As(err, &tooLarge):
+				jsonPrintError(w, http.StatusRequestEntityTooLarge, err.Error(), "cannot attach file to post")
+				return
+			case errors.Is(err, appDb.ErrTooManyAttachments):
+				jsonPrintError(w, http.StatusConflict, err.Error(), "cannot attach file to post")
+				return
+			default:
+				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot attach file to post")
+				return
+			}
+		}
+
+		if appDb.HasThumbnails(res.ContentType) {
+			a.thumbs.enqueue(thumbnailJob{postId: objId, fileId: res.Id})
+		}
+		jsonPrint(w, http.StatusCreated, res)
+	}
+}
+
+// handleGetPostAttachment downloads a file attached to a post, or one of its thumbnails when
+// asked a size. Range requests are supported
+func (a *App) handleGetPostAttachment(newPost appDb.PostFactory, dbName, colName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := newPost()
+		objId, fileId, ok := attachmentIds(w, r)
+		if !ok {
+			return
+		}
+		var size int
+		if sz := r.URL.Query().Get("size"); sz != "" {
+			var err error
+			size, err = strconv.Atoi(sz)
+			if err != nil || !a.thumbs.hasSize(size) {
+				jsonPrintError(w, http.StatusBadRequest, fmt.Sprintf("size must be one of %v", a.thumbs.thumbnailSizes()), "invalid size parameter")
+				return
+			}
+		}
+
+		_, ok = a.readVisiblePost(w, r, p, objId, nil, dbName, colName)
+		if !ok {
+			return
+		}
+
+		res, content, err := p.OpenAttachment(r.Context(), a.mCl, objId, fileId, size, dbName, colName)
+		if err != nil {
+			switch err {
+			case mongo.ErrNoDocuments:
+				jsonPrintError(w, http.StatusNotFound, err.Error(), "attachment not found")
+				return
+			default:
+				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot read attachment")
+				return
+			}
+		}
+		defer content.Close()
+
+		var modTime time.Time
+		if res.CreatedAt != nil {
+			modTime = *res.CreatedAt
+		}
+		w.Header().Set("Content-Type", res.ContentType)
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": res.Name}))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		http.ServeContent(w, r, res.Name, modTime, content)
+	}
+}
+
+func (a *App) handleDeletePostAttachment(newPost appDb.PostFactory, dbName, colName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := newPost()
+		objId, fileId, ok := attachmentIds(w, r)
+		if !ok {
+			return
+		}
+
+		err := p.RemoveAttachment(r.Context(), a.mCl, objId, fileId, dbName, colName)
+		if err != nil {
+			switch {
+			case errors.Is(err, mongo.ErrNoDocuments):
+				jsonPrintError(w, http.StatusNotFound, err.Error(), "attachment not found")
+				return
+			default:
+				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot delete attachment")
+				return
+			}
+		}
+
+		jsonPrint(w, http.StatusOK, map[string]string{"msj": "attachment deleted"})
+	}
+}
+
+func (a *App) handleGetCommentTree(models *appDb.Models, dbName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		postId, err := primitive.ObjectIDFromHex(vars["id"])
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid post id")
+			return
+		}
+
+		maxDepth := appConstants.DefaultTreeDepth
+		if d := r.URL.Query().Get("maxDepth"); d != "" {
+			maxDepth, err = strconv.ParseInt(d, 10, 64)
+			if err != nil || maxDepth < 0 || maxDepth > appConstants.MaxTreeDepth {
+				jsonPrintError(w, http.StatusBadRequest, fmt.Sprintf("maxDepth must be a number between 0 and %d", appConstants.MaxTreeDepth), "invalid maxDepth parameter")
+				return
+			}
+		}
+
+		_, ok := a.readVisiblePost(w, r, models.P(), postId, nil, dbName, models.PColName)
+		if !ok {
+			return
+		}
+
+		res, err := models.C().ReadCommentTree(r.Context(), a.mCl, postId, maxDepth, dbName, models.CColName)
+		if err != nil {
+			jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot read comment tree of post with id: "+postId.String())
+			return
+		}
+
+		jsonPrint(w, http.StatusOK, map[string]any{"items": res})
+	}
+}
+
+func (a *App) handleAddCommentReaction(models *appDb.Models, dbName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c := models.C()
+		vars := mux.Vars(r)
+		objId, err := primitive.ObjectIDFromHex(vars["id"])
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid comment id")
+			return
+		}
+
+		var body reactionBody
+		err = json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "cannot decode body")
+			return
+		}
+
+		_, err = c.ReadComment(r.Context(), a.mCl, objId, dbName, models.CColName)
+		if err != nil {
+			switch err {
+			case mongo.ErrNoDocuments:
+				jsonPrintError(w, http.StatusNotFound, err.Error(), "comment not found")
+				return
+			default:
+				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot read comment")
+				return
+			}
+		}
+
+		author, ok := a.readAuthorOf(w, r, models, dbName, body.AuthorId)
+		if !ok {
+			return
+		}
+
+		err = c.AddReaction(r.Context(), a.mCl, objId, author.Id, body.Type, dbName, models.CColName)
+		if err != nil {
+			switch {
+			case errors.Is(err, appDb.ErrInvalidReaction):
+				jsonPrintError(w, http.StatusBadRequest, err.Error(), "cannot react to comment")
+				return
+			case errors.Is(err, appDb.ErrAlreadyReacted):
+				jsonPrintError(w, http.StatusConflict, err.Error(), "cannot react to comment")
+				return
+			case errors.Is(err, mongo.ErrNoDocuments):
+				jsonPrintError(w, http.StatusNotFound, err.Error(), "comment not found")
+				return
+			default:
+				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot react to comment")
+				return
+			}
+		}
+
+		jsonPrint(w, http.StatusCreated, map[string]string{"msj": "reaction added"})
+	}
+}
+
+func (a *App) handleRemoveCommentReaction(newComment appDb.CommentFactory, dbName, colName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c := newComment()
+		vars := mux.Vars(r)
+		objId, err := primitive.ObjectIDFromHex(vars["id"])
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid comment id")
+			return
+		}
+		authorId, err := primitive.ObjectIDFromHex(r.URL.Query().Get("authorId"))
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid author id")
+			return
+		}
+
+		err = c.RemoveReaction(r.Context(), a.mCl, objId, authorId, r.URL.Query().Get("type"), dbName, colName)
+		if err != nil {
+			switch {
+			case errors.Is(err, appDb.ErrInvalidReaction):
+				jsonPrintError(w, http.StatusBadRequest, err.Error(), "cannot remove comment reaction")
+				return
+			case errors.Is(err, mongo.ErrNoDocuments):
+				jsonPrintError(w, http.StatusNotFound, err.Error(), "reaction not found")
+				return
+			default:
+				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot remove comment reaction")
+				return
+			}
+		}
+
+		jsonPrint(w, http.StatusOK, map[string]string{"msj": "reaction removed"})
+	}
+}
+
+func (a *App) handleGetComment(newComment appDb.CommentFactory, dbName, colName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c := newComment()
+		vars := mux.Vars(r)
+		objId, err := primitive.ObjectIDFromHex(vars["id"])
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid comment id")
+			return
+		}
+		projection, err := fieldsParam(r, appDb.CommentFieldNames)
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid fields parameter")
+			return
+		}
+		viewer, err := viewerParam(r)
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid "+appConstants.AuthorHeader+" header")
+			return
+		}
+
+		res, err := c.ReadCommentFields(r.Context(), a.mCl, objId, projection.WithVisibilityFields(), dbName, colName)
+		if err != nil {
+			switch err {
+			case mongo.ErrNoDocuments:
+				jsonPrintError(w, http.StatusNotFound, err.Error(), "comment not found")
+				return
+			default:
+				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot read comment")
+				return
+			}
+		}
+		if !res.VisibleTo(viewer) {
+			jsonPrintError(w, http.StatusNotFound, mongo.ErrNoDocuments.Error(), "comment not found")
+			return
+		}
+
+		setETag(w, res.Version)
+		projection.Trim(res)
+		jsonPrint(w, http.StatusOK, res)
+	}
+}
+
+func (a *App) handlePutComment(newComment appDb.CommentFactory, dbName, colName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c := newComment()
+		vars := mux.Vars(r)
+		objId, err := primitive.ObjectIDFromHex(vars["id"])
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid comment id")
+			return
+		}
+
+		version, err := ifMatch(r, a.commentVersion(r, newComment(), objId, dbName, colName))
+		if err != nil {
+			ifMatchError(w, err, "comment")
+			return
+		}
+
+		_, err = newComment().ReadComment(r.Context(), a.mCl, objId, dbName, colName)
+		if err != nil {
+			switch err {
+			case mongo.ErrNoDocuments:
+				jsonPrintError(w, http.StatusNotFound, err.Error(), "comment not found")
+				return
+			default:
+				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot read comment")
+				return
+			}
+		}
+
+		err = json.NewDecoder(r.Body).Decode(c)
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "cannot decode comment body")
+			return
+		}
+
+		err = c.ReplaceComment(r.Context(), a.mCl, objId, version, dbName, colName)
+		if err != nil {
+			switch {
+			case errors.Is(err, appDb.ErrVersionMismatch):
+				jsonPrintError(w, http.StatusPreconditionFailed, err.Error(), "cannot update comment with id: "+vars["id"])
+				return
+			case errors.Is(err, mongo.ErrNoDocuments):
+				jsonPrintError(w, http.StatusNotFound, err.Error(), "comment not found")
+				return
+			default:
+				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot update comment with id: "+vars["id"])
+				return
+			}
+		}
+
+		jsonPrint(w, http.StatusOK, map[string]string{"msj": "comment updated"})
+	}
+}
+
+func (a *App) handlePatchComment(newComment appDb.CommentFactory, dbName, colName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c := newComment()
+		vars := mux.Vars(r)
+		objId, err := primitive.ObjectIDFromHex(vars["id"])
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid comment id")
+			return
+		}
+
+		version, err := ifMatch(r, a.commentVersion(r, newComment(), objId, dbName, colName))
+		if err != nil {
+			ifMatchError(w, err, "comment")
+			return
+		}
+
+		patch, code, err := decodeMergePatch(r)
+		if err != nil {
+			jsonPrintError(w, code, err.Error(), "cannot decode merge patch")
+			return
+		}
+
+		_, err = c.ReadComment(r.Context(), a.mCl, objId, dbName, colName)
+		if err != nil {
+			switch err {
+			case mongo.ErrNoDocuments:
+				jsonPrintError(w, http.StatusNotFound, err.Error(), "comment not found")
+				return
+			default:
+				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot read comment")
+				return
+			}
+		}
+
+		err = c.PatchComment(r.Context(), a.mCl, objId, patch, version, dbName, colName)
+		if err != nil {
+			switch {
+			case errors.Is(err, appDb.ErrVersionMismatch):
+				jsonPrintError(w, http.StatusPreconditionFailed, err.Error(), "cannot patch comment with id: "+vars["id"])
+				return
+			case errors.Is(err, mongo.ErrNoDocuments):
+				jsonPrintError(w, http.StatusNotFound, err.Error(), "comment not found")
+				return
+			case errors.Is(err, appDb.ErrInvalidPatch):
+				jsonPrintError(w, http.StatusBadRequest, err.Error(), "cannot patch comment with id: "+vars["id"])
+				return
+			default:
+				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot patch comment with id: "+vars["id"])
+				return
+			}
+		}
+
+		jsonPrint(w, http.StatusOK, map[string]string{"msj": "comment updated"})
+	}
+}
+
+func (a *App) handleDeleteComment(models *appDb.Models, dbName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c := models.C()
+		vars := mux.Vars(r)
+		objId, err := primitive.ObjectIDFromHex(vars["id"])
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid comment id")
+			return
+		}
+
+		version, err := ifMatch(r, a.commentVersion(r, models.C(), objId, dbName, models.CColName))
+		if err != nil {
+			ifMatchError(w, err, "comment")
+			return
+		}
+
+		_, err = c.ReadComment(r.Context(), a.mCl, objId, dbName, models.CColName)
+		if err != nil {
+			switch err {
+			case mongo.ErrNoDocuments:
+				jsonPrintError(w, http.StatusNotFound, err.Error(), "comment not found")
+				return
+			default:
+				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot read comment")
+				return
+			}
+		}
+
+		err = c.DeleteComment(r.Context(), a.mCl, objId, version, dbName, models.CColName, models.PColName)
+		if err != nil {
+			switch {
+			case errors.Is(err, appDb.ErrVersionMismatch):
+				jsonPrintError(w, http.StatusPreconditionFailed, err.Error(), "cannot delete comment")
+				return
+			case errors.Is(err, mongo.ErrNoDocuments):
+				jsonPrintError(w, http.StatusNotFound, err.Error(), "comment not found")
+				return
+			default:
+				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot delete comment")
+				return
+			}
+		}
+
+		jsonPrint(w, http.StatusOK, map[string]string{"msj": "comment deleted"})
+	}
+}
+
+// readVisiblePost reads the fields of projection of the post a request is about, or the whole post
+// when projection is nil. Posts the viewer cannot read are not found, like in handleGetPost.
+// It prints the error response and returns false when the post cannot be read
+func (a *App) readVisiblePost(w http.ResponseWriter, r *http.Request, p appDb.Post, objId primitive.ObjectID, projection appDb.Projection, dbName, colName string) (*appDb.PostDoc, bool) {
+	viewer, err := viewerParam(r)
+	if err != nil {
+		jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid "+appConstants.AuthorHeader+" header")
+		return nil, false
+	}
+	res, err := p.ReadPostFields(r.Context(), a.mCl, objId, projection.WithVisibilityFields(), dbName, colName)
+	if err != nil {
+		switch err {
+		case mongo.ErrNoDocuments:
+			jsonPrintError(w, http.StatusNotFound, err.Error(), "not found post with id: "+objId.String())
+			return nil, false
+		default:
+			jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot read post with id: "+objId.String())
+			return nil, false
+		}
+	}
+	if !res.VisibleTo(viewer) {
+		jsonPrintError(w, http.StatusNotFound, mongo.ErrNoDocuments.Error(), "not found post with id: "+objId.String())
+		return nil, false
+	}
+	return res, true
+}
+
+// newCommentStatus is the status comments on post are created with: pending when the post, or
+// else the app configuration, asks for pre-moderation
+func (a *App) newCommentStatus(post *appDb.PostDoc) appDb.CommentStatus {
+	mode := post.Moderation
+	if mode == "" && a.cfg != nil {
+		mode = appDb.ModerationMode(a.cfg.ModerationMode)
+	}
+	if mode == appDb.ModerationPre {
+		return appDb.CommentPending
+	}
+	return ""
+}
+
+// handleListModerationQueue lists the comments waiting for a moderator, or the rejected ones
+// when asked with the status parameter, oldest first
+func (a *App) handleListModerationQueue(newComment appDb.CommentFactory, dbName, colName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c := newComment()
+		status, err := moderationStatusParam(r)
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid status parameter")
+			return
+		}
+		cursor, limit, err := pageParams(r)
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid page parameters")
+			return
+		}
+
+		res, err := c.ListModerationQueue(r.Context(), a.mCl, status, cursor, limit, dbName, colName)
+		if err != nil {
+			jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot list moderation queue")
+			return
+		}
+
+		jsonPrint(w, http.StatusOK, res)
+	}
+}
+
+// handleModerateComment approves or rejects a comment, as status tells, with the reason of the
+// moderator, which rejections must give
+func (a *App) handleModerateComment(models *appDb.Models, dbName string, status appDb.CommentStatus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		objId, err := primitive.ObjectIDFromHex(vars["id"])
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid comment id")
+			return
+		}
+		body := new(moderationBody)
+		err = json.NewDecoder(r.Body).Decode(body)
+		if err != nil && !errors.Is(err, io.EOF) {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "cannot decode body")
+			return
+		}
+
+		err = models.C().ModerateComment(r.Context(), a.mCl, objId, status, strings.TrimSpace(body.Reason), dbName, models.CColName, models.PColName)
+		if err != nil {
+			switch {
+			case errors.Is(err, appDb.ErrReasonRequired):
+				jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid moderation of comment with id: "+objId.String())
+				return
+			case errors.Is(err, mongo.ErrNoDocuments):
+				jsonPrintError(w, http.StatusNotFound, err.Error(), "not found comment with id: "+objId.String())
+				return
+			default:
+				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot moderate comment with id: "+objId.String())
+				return
+			}
+		}
+
+		jsonPrint(w, http.StatusOK, map[string]string{"msj": "comment " + string(status)})
+	}
+}
+
+// readAuthorOf reads the author a new post or comment refers to. When it cannot, it writes the
+// error response and returns false
+func (a *App) readAuthorOf(w http.ResponseWriter, r *http.Request, models *appDb.Models, dbName, authorIdStr string) (*appDb.AuthorDoc, bool) {
+	authorId, err := primitive.ObjectIDFromHex(authorIdStr)
+	if err != nil {
+		jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid author id")
+		return nil, false
+	}
+	author, err := models.A().ReadAuthor(r.Context(), a.mCl, authorId, dbName, models.AColName)
+	if err != nil {
+		switch err {
+		case mongo.ErrNoDocuments:
+			jsonPrintError(w, http.StatusNotFound, err.Error(), "not found author with id: "+authorId.String())
+			return nil, false
+		default:
+			jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot read author with id: "+authorId.String())
+			return nil, false
+		}
+	}
+	return author, true
+}
+
+func (a *App) handleCreateAuthor(newAuthor appDb.AuthorFactory, dbName, colName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		au := newAuthor()
+		err := json.NewDecoder(r.Body).Decode(au)
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "cannot decode body")
+			return
+		}
+
+		res, err := au.CreateAuthor(r.Context(), a.mCl, dbName, colName)
+		if err != nil {
+			switch {
+			case errors.Is(err, appDb.ErrAuthorNameRequired):
+				jsonPrintError(w, http.StatusBadRequest, err.Error(), "cannot create author")
+				return
+			case mongo.IsDuplicateKeyError(err):
+				jsonPrintError(w, http.StatusConflict, err.Error(), "cannot create author")
+				return
+			default:
+				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot create author")
+				return
+			}
+		}
+
+		jsonPrint(w, http.StatusCreated, res)
+	}
+}
+
+func (a *App) handleGetAuthor(newAuthor appDb.AuthorFactory, dbName, colName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		au := newAuthor()
+		vars := mux.Vars(r)
+		objId, err := primitive.ObjectIDFromHex(vars["id"])
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid author id")
+			return
+		}
+
+		res, err := au.ReadAuthor(r.Context(), a.mCl, objId, dbName, colName)
+		if err != nil {
+			switch err {
+			case mongo.ErrNoDocuments:
+				jsonPrintError(w, http.StatusNotFound, err.Error(), "author not found")
+				return
+			default:
+				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot read author")
+				return
+			}
+		}
+
+		setETag(w, res.Version)
+		jsonPrint(w, http.StatusOK, res)
+	}
+}
+
+func (a *App) handleListAuthors(newAuthor appDb.AuthorFactory, dbName, colName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		au := newAuthor()
+		cursor, limit, err := pageParams(r)
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid pagination parameters")
+			return
+		}
+
+		res, err := au.ListAuthors(r.Context(), a.mCl, cursor, limit, dbName, colName)
+		if err != nil {
+			jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot list authors")
+			return
+		}
+
+		jsonPrint(w, http.StatusOK, res)
+	}
+}
+
+func (a *App) handlePutAuthor(models *appDb.Models, dbName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		au := models.A()
+		vars := mux.Vars(r)
+		objId, err := primitive.ObjectIDFromHex(vars["id"])
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid author id")
+			return
+		}
+
+		version, err := ifMatch(r, a.authorVersion(r, models.A(), objId, dbName, models.AColName))
+		if err != nil {
+			ifMatchError(w, err, "author")
+			return
+		}
+
+		_, err = models.A().ReadAuthor(r.Context(), a.mCl, objId, dbName, models.AColName)
+		if err != nil {
+			switch err {
+			case mongo.ErrNoDocuments:
+				jsonPrintError(w, http.StatusNotFound, err.Error(), "author not found")
+				return
+			default:
+				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot read author")
+				return
+			}
+		}
+
+		err = json.NewDecoder(r.Body).Decode(au)
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "cannot decode body")
+			return
+		}
+
+		err = au.ReplaceAuthor(r.Context(), a.mCl, objId, version, dbName, models.AColName, models.PColName, models.CColName)
+		if err != nil {
+			switch {
+			case errors.Is(err, appDb.ErrVersionMismatch):
+				jsonPrintError(w, http.StatusPreconditionFailed, err.Error(), "cannot update author")
+				return
+			case errors.Is(err, mongo.ErrNoDocuments):
+				jsonPrintError(w, http.StatusNotFound, err.Error(), "author not found")
+				return
+			case errors.Is(err, appDb.ErrAuthorNameRequired):
+				jsonPrintError(w, http.StatusBadRequest, err.Error(), "cannot update author")
+				return
+			case mongo.IsDuplicateKeyError(err):
+				jsonPrintError(w, http.StatusConflict, err.Error(), "cannot update author")
+				return
+			default:
+				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot update author")
+				return
+			}
+		}
+
+		jsonPrint(w, http.StatusOK, map[string]string{"msj": "author updated"})
+	}
+}
+
+func (a *App) handleDeleteAuthor(models *appDb.Models, dbName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		au := models.A()
+		vars := mux.Vars(r)
+		objId, err := primitive.ObjectIDFromHex(vars["id"])
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid author id")
+			return
+		}
+
+		version, err := ifMatch(r, a.authorVersion(r, models.A(), objId, dbName, models.AColName))
+		if err != nil {
+			ifMatchError(w, err, "author")
+			return
+		}
+
+		_, err = au.ReadAuthor(r.Context(), a.mCl, objId, dbName, models.AColName)
+		if err != nil {
+			switch err {
+			case mongo.ErrNoDocuments:
+				jsonPrintError(w, http.StatusNotFound, err.Error(), "author not found")
+				return
+			default:
+				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot read author")
+				return
+			}
+		}
+
+		err = au.DeleteAuthor(r.Context(), a.mCl, objId, version, dbName, models.AColName, models.PColName, models.CColName)
+		if err != nil {
+			switch {
+			case errors.Is(err, appDb.ErrVersionMismatch):
+				jsonPrintError(w, http.StatusPreconditionFailed, err.Error(), "cannot delete author")
+				return
+			case errors.Is(err, mongo.ErrNoDocuments):
+				jsonPrintError(w, http.StatusNotFound, err.Error(), "author not found")
+				return
+			case errors.Is(err, appDb.ErrAuthorInUse):
+				jsonPrintError(w, http.StatusConflict, err.Error(), "cannot delete author")
+				return
+			default:
+				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot delete author")
+				return
+			}
+		}
+
+		jsonPrint(w, http.StatusOK, map[string]string{"msj": "author deleted"})
+	}
+}
+
+func (a *App) handleListAuthorPosts(models *appDb.Models, dbName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		authorId, err := primitive.ObjectIDFromHex(vars["id"])
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid author id")
+			return
+		}
+
+		query, limit, err := listQueryParams(r, appDb.PostQueryFields, appDb.PostFieldNames)
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid list parameters")
+			return
+		}
+		viewer, err := viewerParam(r)
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid "+appConstants.AuthorHeader+" header")
+			return
+		}
+		query.Restrict(appDb.PostsVisibleTo(viewer))
+
+		_, err = models.A().ReadAuthor(r.Context(), a.mCl, authorId, dbName, models.AColName)
+		if err != nil {
+			switch err {
+			case mongo.ErrNoDocuments:
+				jsonPrintError(w, http.StatusNotFound, err.Error(), "not found author with id: "+authorId.String())
+				return
+			default:
+				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot read author with id: "+authorId.String())
+				return
+			}
+		}
+
+		res, err := models.P().ListAuthorPosts(r.Context(), a.mCl, authorId, query, limit, dbName, models.PColName)
+		if err != nil {
+			jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot list posts of author with id: "+authorId.String())
+			return
+		}
+
+		jsonPrint(w, http.StatusOK, res)
+	}
+}
+
+func (a *App) handleListAuthorComments(models *appDb.Models, dbName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		authorId, err := primitive.ObjectIDFromHex(vars["id"])
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid author id")
+			return
+		}
+
+		query, limit, err := listQueryParams(r, appDb.CommentQueryFields, appDb.CommentFieldNames)
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid list parameters")
+			return
+		}
+
+		viewer, err := viewerParam(r)
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid "+appConstants.AuthorHeader+" header")
+			return
+		}
+		query.Restrict(appDb.CommentsVisibleTo(viewer))
+
+		_, err = models.A().ReadAuthor(r.Context(), a.mCl, authorId, dbName, models.AColName)
+		if err != nil {
+			switch err {
+			case mongo.ErrNoDocuments:
+				jsonPrintError(w, http.StatusNotFound, err.Error(), "not found author with id: "+authorId.String())
+				return
+			default:
+				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot read author with id: "+authorId.String())
+				return
+			}
+		}
+
+		res, err := models.C().ListAuthorComments(r.Context(), a.mCl, authorId, viewer, query, limit, dbName, models.CColName, models.PColName)
+		if err != nil {
+			jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot list comments of author with id: "+authorId.String())
+			return
+		}
+
+		jsonPrint(w, http.StatusOK, res)
+	}
+}
+
+func (a *App) handleSearch(models *appDb.Models, dbName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query().Get("q")
+		if strings.TrimSpace(q) == "" {
+			jsonPrintError(w, http.StatusBadRequest, "q must not be empty", "invalid search query")
+			return
+		}
+
+		hitType := r.URL.Query().Get("type")
+		switch hitType {
+		case "", appDb.HitPost, appDb.HitComment:
+		default:
+			jsonPrintError(w, http.StatusBadRequest, "type must be either post or comment", "invalid type parameter")
+			return
+		}
+
+		offset, limit, err := offsetPageParams(r)
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid pagination parameters")
+			return
+		}
+
+		res, err := models.S().Search(r.Context(), a.mCl, q, hitType, offset, limit, dbName, models.PColName, models.CColName)
+		if err != nil {
+			jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot search posts and comments")
+			return
+		}
+
+		jsonPrint(w, http.StatusOK, res)
+	}
+}
+
+// handleExport streams the whole dataset as newline-delimited JSON
+func (a *App) handleExport(models *appDb.Models, dbName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		nw := &ndjsonWriter{w: w}
+		err := models.T().Export(r.Context(), a.mCl, nw, dbName, models.AColName, models.PColName, models.CColName)
+		if err != nil {
+			if !nw.started {
+				jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot export")
+				return
+			}
+			// the response is under way, the client only sees it cut short
+			klog.Errorf("export cut short: %v", err)
+			return
+		}
+		nw.start()
+	}
+}
+
+// handleImport stores the records of an export sent as newline-delimited JSON
+func (a *App) handleImport(models *appDb.Models, dbName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || mediaType != appConstants.NDJSONContentType {
+			jsonPrintError(w, http.StatusUnsupportedMediaType, "content type must be "+appConstants.NDJSONContentType, "cannot import")
+			return
+		}
+		upsert, keepIds, err := importParams(r)
+		if err != nil {
+			jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid import parameters")
+			return
+		}
+
+		report, err := models.T().Import(r.Context(), a.mCl, r.Body, upsert, keepIds, dbName, models.AColName, models.PColName, models.CColName)
+		if upsert {
+			// replaced posts may keep their version
+			a.renders.clear()
+		}
+		if err != nil {
+			jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot import")
+			return
+		}
+
+		jsonPrint(w, http.StatusOK, report)
 	}
 }
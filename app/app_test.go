@@ -1,36 +1,114 @@
 package app
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	appConstants "github.com/gjbastidas/GoSimpleAPIWithMongoDB/constants"
+	"github.com/gjbastidas/GoSimpleAPIWithMongoDB/env"
+	appDb "github.com/gjbastidas/GoSimpleAPIWithMongoDB/models"
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 func TestHandleCreatePost(t *testing.T) {
 	subtests := []struct {
 		name             string
 		collection       string
+		authorCollection string
+		authorIdHex      string
+		format           string
+		status           string
 		expectedResponse string
 		expectedCode     int
 	}{
 		{
 			name:             "happy-path",
 			collection:       fakePostCol,
+			authorCollection: fakeAuthorCol,
+			authorIdHex:      fakeAuthorObjIdHex,
 			expectedResponse: `{"InsertedID":"` + fakePostObjIdHex + `"}`,
 			expectedCode:     http.StatusCreated,
 		},
+		{
+			name:             "markdown",
+			collection:       fakePostCol,
+			authorCollection: fakeAuthorCol,
+			authorIdHex:      fakeAuthorObjIdHex,
+			format:           "markdown",
+			expectedResponse: `{"InsertedID":"` + fakePostObjIdHex + `"}`,
+			expectedCode:     http.StatusCreated,
+		},
+		{
+			name:             "return-error-unknown-format",
+			collection:       fakePostCol,
+			authorCollection: fakeAuthorCol,
+			authorIdHex:      fakeAuthorObjIdHex,
+			format:           "rtf",
+			expectedResponse: `{"error":"format must be one of plain, markdown"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "draft",
+			collection:       fakePostCol,
+			authorCollection: fakeAuthorCol,
+			authorIdHex:      fakeAuthorObjIdHex,
+			status:           "draft",
+			expectedResponse: `{"InsertedID":"` + fakePostObjIdHex + `"}`,
+			expectedCode:     http.StatusCreated,
+		},
+		{
+			name:             "return-error-scheduled-without-publish-at",
+			collection:       fakePostCol,
+			authorCollection: fakeAuthorCol,
+			authorIdHex:      fakeAuthorObjIdHex,
+			status:           "scheduled",
+			expectedResponse: `{"error":"scheduled posts must have a publishAt time"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "return-error-unknown-status",
+			collection:       fakePostCol,
+			authorCollection: fakeAuthorCol,
+			authorIdHex:      fakeAuthorObjIdHex,
+			status:           "deleted",
+			expectedResponse: `{"error":"status must be one of draft, scheduled, published, archived"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
 		{
 			name:             "return-error",
 			collection:       "fakeOtherCol",
+			authorCollection: fakeAuthorCol,
+			authorIdHex:      fakeAuthorObjIdHex,
 			expectedResponse: `{"error":"dummy error"}`,
 			expectedCode:     http.StatusInternalServerError,
 		},
+		{
+			name:             "author-not-found",
+			collection:       fakePostCol,
+			authorCollection: "NoDocs",
+			authorIdHex:      fakeAuthorObjIdHex,
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+		{
+			name:             "return-error-missing-author-id",
+			collection:       fakePostCol,
+			authorCollection: fakeAuthorCol,
+			expectedResponse: `{"error":"the provided hex string is not a valid ObjectID"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
 	}
 
 	for _, st := range subtests {
@@ -38,10 +116,14 @@ func TestHandleCreatePost(t *testing.T) {
 			a := new(App)
 			router := mux.NewRouter()
 			subRouter := router.PathPrefix("/post").Subrouter()
-			subRouter.HandleFunc("/", a.handleCreatePost(new(MockPost), "fakeDb", st.collection)).Methods(http.MethodPost)
+
+			mockModels := NewMockModels()
+			mockModels.PColName = st.collection
+			mockModels.AColName = st.authorCollection
+			subRouter.HandleFunc("/", a.handleCreatePost(mockModels, fakeDbName)).Methods(http.MethodPost)
 
 			w := httptest.NewRecorder()
-			jsonBody := strings.NewReader(`{"content":"fake content", "author":"fake author"}`)
+			jsonBody := strings.NewReader(`{"content":"fake content", "format":"` + st.format + `", "status":"` + st.status + `", "authorId":"` + st.authorIdHex + `"}`)
 			r, err := http.NewRequest(http.MethodPost, "/post/", jsonBody)
 			router.ServeHTTP(w, r)
 
@@ -57,21 +139,320 @@ func TestHandleCreatePost(t *testing.T) {
 	}
 }
 
-func TestHandleGetPost(t *testing.T) {
+func TestHandleBulkCreatePosts(t *testing.T) {
+	created := `{"id":"` + fakePostObjIdHex + `","status":201}`
+	skipped := `{"status":424,"error":"skipped after an earlier item failed"}`
 	subtests := []struct {
 		name             string
 		collection       string
-		postIdHex        string
+		query            string
+		body             string
+		expectedResponse string
+		expectedCode     int
+	}{
+		{
+			name:             "happy-path",
+			collection:       fakePostCol,
+			body:             `[{"content":"fake content","authorId":"` + fakeAuthorObjIdHex + `"},{"content":"fake content","authorId":"` + fakeAuthorObjIdHex + `"}]`,
+			expectedResponse: `{"errors":false,"items":[` + created + `,` + created + `]}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "ordered-skips-after-failure",
+			collection:       fakePostCol,
+			body:             `[{"content":"fake content","authorId":"` + fakeAuthorObjIdHex + `"},{"content":"` + fakeDuplicateContent + `","authorId":"` + fakeAuthorObjIdHex + `"},{"content":"fake content","authorId":"` + fakeAuthorObjIdHex + `"}]`,
+			expectedResponse: `{"errors":true,"items":[` + created + `,{"status":409,"error":"write exception: write errors: [E11000 duplicate key error]"},` + skipped + `]}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "unordered-goes-on-after-failure",
+			collection:       fakePostCol,
+			query:            "?ordered=false",
+			body:             `[{"content":"fake content","authorId":"` + fakeMissingObjIdHex + `"},{"content":"` + fakeDuplicateContent + `","authorId":"` + fakeAuthorObjIdHex + `"},{"content":"fake content","authorId":"` + fakeAuthorObjIdHex + `"}]`,
+			expectedResponse: `{"errors":true,"items":[{"status":404,"error":"not found author with id: ` + fakeMissingObjIdHex + `"},{"status":409,"error":"write exception: write errors: [E11000 duplicate key error]"},` + created + `]}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "ordered-skips-after-invalid-item",
+			collection:       fakePostCol,
+			body:             `[{"content":"fake content","authorId":"` + fakeMissingObjIdHex + `"},{"content":"fake content","authorId":"` + fakeAuthorObjIdHex + `"}]`,
+			expectedResponse: `{"errors":true,"items":[{"status":404,"error":"not found author with id: ` + fakeMissingObjIdHex + `"},` + skipped + `]}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "return-error",
+			collection:       "fakeOtherCol",
+			body:             `[{"content":"fake content","authorId":"` + fakeAuthorObjIdHex + `"}]`,
+			expectedResponse: `{"error":"dummy error"}`,
+			expectedCode:     http.StatusInternalServerError,
+		},
+		{
+			name:             "return-error-empty-bulk",
+			collection:       fakePostCol,
+			body:             `[]`,
+			expectedResponse: `{"error":"a bulk request takes between 1 and 1000 items"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "return-error-invalid-ordered",
+			collection:       fakePostCol,
+			query:            "?ordered=maybe",
+			body:             `[{"content":"fake content","authorId":"` + fakeAuthorObjIdHex + `"}]`,
+			expectedResponse: `{"error":"ordered must be either true or false"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			a := new(App)
+			router := mux.NewRouter()
+			subRouter := router.PathPrefix("/post").Subrouter()
+
+			mockModels := NewMockModels()
+			mockModels.PColName = st.collection
+			subRouter.HandleFunc("/_bulk", a.handleBulkCreatePosts(mockModels, fakeDbName)).Methods(http.MethodPost)
+
+			w := httptest.NewRecorder()
+			r, err := http.NewRequest(http.MethodPost, "/post/_bulk"+st.query, strings.NewReader(st.body))
+			router.ServeHTTP(w, r)
+
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedCode, w.Code)
+			}
+
+			b, err := io.ReadAll(w.Body)
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedResponse, strings.TrimSuffix(string(b), "\n"))
+			}
+		})
+	}
+}
+
+func TestHandleBulkDeletePosts(t *testing.T) {
+	deleted := `{"id":"` + fakePostObjIdHex + `","status":200}`
+	skipped := `{"status":424,"error":"skipped after an earlier item failed"}`
+	notFound := `{"status":404,"error":"mongo: no documents in result"}`
+	subtests := []struct {
+		name             string
+		collection       string
+		query            string
+		body             string
 		expectedResponse string
 		expectedCode     int
 	}{
 		{
 			name:             "happy-path",
 			collection:       fakePostCol,
+			body:             `["` + fakePostObjIdHex + `"]`,
+			expectedResponse: `{"errors":false,"items":[` + deleted + `]}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "detach-comments",
+			collection:       fakePostCol,
+			query:            "?detachComments=true",
+			body:             `["` + fakePostObjIdHex + `"]`,
+			expectedResponse: `{"errors":false,"items":[` + deleted + `]}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "ordered-skips-after-failure",
+			collection:       fakePostCol,
+			body:             `["` + fakeMissingObjIdHex + `","` + fakePostObjIdHex + `"]`,
+			expectedResponse: `{"errors":true,"items":[` + notFound + `,` + skipped + `]}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "unordered-goes-on-after-failure",
+			collection:       fakePostCol,
+			query:            "?ordered=false",
+			body:             `["12345","` + fakeMissingObjIdHex + `","` + fakePostObjIdHex + `"]`,
+			expectedResponse: `{"errors":true,"items":[{"status":400,"error":"invalid post id: the provided hex string is not a valid ObjectID"},` + notFound + `,` + deleted + `]}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "return-error",
+			collection:       "fakeOtherCol",
+			body:             `["` + fakePostObjIdHex + `"]`,
+			expectedResponse: `{"error":"dummy error"}`,
+			expectedCode:     http.StatusInternalServerError,
+		},
+		{
+			name:             "return-error-invalid-detach-comments",
+			collection:       fakePostCol,
+			query:            "?detachComments=maybe",
+			body:             `["` + fakePostObjIdHex + `"]`,
+			expectedResponse: `{"error":"detachComments must be either true or false"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			a := new(App)
+			router := mux.NewRouter()
+			subRouter := router.PathPrefix("/post").Subrouter()
+
+			mockModels := NewMockModels()
+			mockModels.PColName = st.collection
+			subRouter.HandleFunc("/_bulk/delete", a.handleBulkDeletePosts(mockModels, fakeDbName)).Methods(http.MethodPost)
+
+			w := httptest.NewRecorder()
+			r, err := http.NewRequest(http.MethodPost, "/post/_bulk/delete"+st.query, strings.NewReader(st.body))
+			router.ServeHTTP(w, r)
+
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedCode, w.Code)
+			}
+
+			b, err := io.ReadAll(w.Body)
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedResponse, strings.TrimSuffix(string(b), "\n"))
+			}
+		})
+	}
+}
+
+func TestHandleGetPost(t *testing.T) {
+	subtests := []struct {
+		name              string
+		collection        string
+		commentCollection string
+		postIdHex         string
+		query             string
+		authorHeader      string
+		expectedResponse  string
+		expectedCode      int
+	}{
+		{
+			name:             "happy-path",
+			collection:       fakePostCol,
+			postIdHex:        fakePostObjIdHex,
+			expectedResponse: `{"id":"` + fakePostObjIdHex + `","content":"fake content","author":"fake author","version":1}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "selected-fields",
+			collection:       fakePostCol,
+			postIdHex:        fakePostObjIdHex,
+			query:            "?fields=id,author",
+			expectedResponse: `{"id":"` + fakePostObjIdHex + `","author":"fake author"}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "selected-fields-always-with-id",
+			collection:       fakePostCol,
+			postIdHex:        fakePostObjIdHex,
+			query:            "?fields=content,version",
+			expectedResponse: `{"id":"` + fakePostObjIdHex + `","content":"fake content","version":1}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "return-error-unknown-field",
+			collection:       fakePostCol,
+			postIdHex:        fakePostObjIdHex,
+			query:            "?fields=id,password",
+			expectedResponse: `{"error":"invalid query: unknown field \"password\""}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "expand-comments-and-author",
+			collection:       fakePostCol,
+			postIdHex:        fakePostObjIdHex,
+			query:            "?expand=comments,author&commentsLimit=1",
+			expectedResponse: `{"id":"` + fakePostObjIdHex + `","content":"fake content","author":"fake author","version":1,"comments":{"items":[{"id":"` + fakeCommentObjIdHex + `","content":"fake content","postId":"` + fakePostObjIdHex + `"}],"next":"` + fakeCommentObjIdHex + `"},"authorDetails":{"id":"` + fakeAuthorObjIdHex + `","name":"fake author"}}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "expand-selected-fields",
+			collection:       fakePostCol,
+			postIdHex:        fakePostObjIdHex,
+			query:            "?expand=author&fields=author",
+			expectedResponse: `{"id":"` + fakePostObjIdHex + `","author":"fake author","authorDetails":{"id":"` + fakeAuthorObjIdHex + `","name":"fake author"}}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:              "return-error-expand",
+			collection:        fakePostCol,
+			commentCollection: "fakeOtherCol",
+			postIdHex:         fakePostObjIdHex,
+			query:             "?expand=comments",
+			expectedResponse:  `{"error":"dummy error"}`,
+			expectedCode:      http.StatusInternalServerError,
+		},
+		{
+			name:             "return-error-unknown-expand",
+			collection:       fakePostCol,
+			postIdHex:        fakePostObjIdHex,
+			query:            "?expand=comments,reactions",
+			expectedResponse: `{"error":"expand takes a comma separated list of comments and author"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "return-error-invalid-comments-limit",
+			collection:       fakePostCol,
+			postIdHex:        fakePostObjIdHex,
+			query:            "?expand=comments&commentsLimit=500",
+			expectedResponse: `{"error":"commentsLimit must be a number between 1 and 100"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "render-plain",
+			collection:       fakePostCol,
+			postIdHex:        fakePostObjIdHex,
+			query:            "?render=html&fields=author",
+			expectedResponse: `{"id":"` + fakePostObjIdHex + `","author":"fake author","contentHtml":"\u003cp\u003efake content\u003c/p\u003e\n"}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "render-markdown-sanitized",
+			collection:       fakePostCol,
+			postIdHex:        fakeMarkdownObjIdHex,
+			query:            "?render=html&fields=id",
+			expectedResponse: `{"id":"` + fakeMarkdownObjIdHex + `","contentHtml":"\u003cp\u003e\u003cstrong\u003efake\u003c/strong\u003e alert(1)content\u003c/p\u003e\n"}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "return-error-unknown-render",
+			collection:       fakePostCol,
 			postIdHex:        fakePostObjIdHex,
-			expectedResponse: `{"id":"` + fakePostObjIdHex + `","content":"fake content","author":"fake author"}`,
+			query:            "?render=pdf",
+			expectedResponse: `{"error":"render must be html"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "draft-read-by-author",
+			collection:       fakePostCol,
+			postIdHex:        fakeDraftObjIdHex,
+			query:            "?fields=id,status",
+			authorHeader:     fakeAuthorObjIdHex,
+			expectedResponse: `{"id":"` + fakeDraftObjIdHex + `","status":"draft"}`,
 			expectedCode:     http.StatusOK,
 		},
+		{
+			name:             "return-error-draft-read-by-other-author",
+			collection:       fakePostCol,
+			postIdHex:        fakeDraftObjIdHex,
+			authorHeader:     fakeBusyAuthorObjIdHex,
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+		{
+			name:             "return-error-draft-read-anonymously",
+			collection:       fakePostCol,
+			postIdHex:        fakeDraftObjIdHex,
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+		{
+			name:             "return-error-invalid-author-header",
+			collection:       fakePostCol,
+			postIdHex:        fakePostObjIdHex,
+			authorHeader:     "12345",
+			expectedResponse: `{"error":"the provided hex string is not a valid ObjectID"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
 		{
 			name:             "return-error",
 			collection:       "fakeOtherCol",
@@ -82,30 +463,3180 @@ func TestHandleGetPost(t *testing.T) {
 		{
 			name:             "return-error-no-docs",
 			collection:       "NoDocs",
-			postIdHex:        fakePostObjIdHex,
+			postIdHex:        fakePostObjIdHex,
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+		{
+			name:             "return-error-invalid-hex-id",
+			collection:       "fakePostCol",
+			postIdHex:        "12345",
+			expectedResponse: `{"error":"the provided hex string is not a valid ObjectID"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			a := new(App)
+			router := mux.NewRouter()
+			subRouter := router.PathPrefix("/post").Subrouter()
+
+			mockModels := NewMockModels()
+			mockModels.PColName = st.collection
+			mockModels.CColName = fakeCommentCol
+			if st.commentCollection != "" {
+				mockModels.CColName = st.commentCollection
+			}
+			subRouter.HandleFunc("/{id:[a-z0-9]+}", a.handleGetPost(mockModels, fakeDbName)).Methods(http.MethodGet)
+
+			w := httptest.NewRecorder()
+			url := fmt.Sprintf("/post/%v%v", st.postIdHex, st.query)
+			r, err := http.NewRequest(http.MethodGet, url, nil)
+			if st.authorHeader != "" {
+				r.Header.Set("X-Author-Id", st.authorHeader)
+			}
+			router.ServeHTTP(w, r)
+
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedCode, w.Code)
+				// documents read without their version have no ETag
+				if st.expectedCode == http.StatusOK && strings.Contains(st.expectedResponse, `"version"`) {
+					assert.EqualValues(t, `"1"`, w.Header().Get("ETag"))
+				}
+			}
+
+			b, err := io.ReadAll(w.Body)
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedResponse, strings.TrimSuffix(string(b), "\n"))
+			}
+		})
+	}
+}
+
+func TestHandleListPosts(t *testing.T) {
+	subtests := []struct {
+		name             string
+		collection       string
+		query            string
+		authorHeader     string
+		expectedResponse string
+		expectedCode     int
+	}{
+		{
+			name:             "happy-path",
+			collection:       fakePostCol,
+			query:            "",
+			expectedResponse: `{"items":[{"id":"` + fakePostObjIdHex + `","content":"fake content","author":"fake author","tags":["go","mongodb"]}]}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "next-cursor",
+			collection:       fakePostCol,
+			query:            "?limit=1",
+			expectedResponse: `{"items":[{"id":"` + fakePostObjIdHex + `","content":"fake content","author":"fake author","tags":["go","mongodb"]}],"next":"` + fakePostObjIdHex + `"}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "last-page",
+			collection:       fakePostCol,
+			query:            "?cursor=" + fakePostObjIdHex,
+			expectedResponse: `{"items":[]}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "all-tags",
+			collection:       fakePostCol,
+			query:            "?tag=go&tag=mongodb",
+			expectedResponse: `{"items":[{"id":"` + fakePostObjIdHex + `","content":"fake content","author":"fake author","tags":["go","mongodb"]}]}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "missing-tag",
+			collection:       fakePostCol,
+			query:            "?tag=go&tag=rust",
+			expectedResponse: `{"items":[]}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "any-tag",
+			collection:       fakePostCol,
+			query:            "?tag=go&tag=rust&tagMode=any",
+			expectedResponse: `{"items":[{"id":"` + fakePostObjIdHex + `","content":"fake content","author":"fake author","tags":["go","mongodb"]}]}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "return-error",
+			collection:       "fakeOtherCol",
+			query:            "",
+			expectedResponse: `{"error":"dummy error"}`,
+			expectedCode:     http.StatusInternalServerError,
+		},
+		{
+			name:             "return-error-invalid-limit",
+			collection:       fakePostCol,
+			query:            "?limit=0",
+			expectedResponse: `{"error":"limit must be a number between 1 and 100"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "return-error-invalid-tag-mode",
+			collection:       fakePostCol,
+			query:            "?tag=go&tagMode=some",
+			expectedResponse: `{"error":"tagMode must be either all or any"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "return-error-invalid-cursor",
+			collection:       fakePostCol,
+			query:            "?cursor=12345",
+			expectedResponse: `{"error":"the provided hex string is not a valid ObjectID"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "filter",
+			collection:       fakePostCol,
+			query:            "?filter=author%20eq%20%27fake%20author%27%20and%20%28content%20contains%20%27fake%27%20or%20version%20gt%201%29",
+			expectedResponse: `{"items":[{"id":"` + fakePostObjIdHex + `","content":"fake content","author":"fake author","tags":["go","mongodb"]}]}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "sort-and-shortcuts",
+			collection:       fakePostCol,
+			query:            "?sort=-createdAt,author&author=fake+author&createdAfter=2023-01-01",
+			expectedResponse: `{"items":[{"id":"` + fakePostObjIdHex + `","content":"fake content","author":"fake author","tags":["go","mongodb"]}]}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "return-error-unknown-field",
+			collection:       fakePostCol,
+			query:            "?filter=password%20eq%20%27x%27",
+			expectedResponse: `{"error":"invalid query: unknown field \"password\""}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "return-error-unknown-operator",
+			collection:       fakePostCol,
+			query:            "?filter=author%20regex%20%27.%2A%27",
+			expectedResponse: `{"error":"invalid query: unknown operator \"regex\""}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "return-error-operator-not-applying",
+			collection:       fakePostCol,
+			query:            "?filter=version%20contains%20%271%27",
+			expectedResponse: `{"error":"invalid query: contains does not apply to version"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "return-error-unsortable-field",
+			collection:       fakePostCol,
+			query:            "?sort=content",
+			expectedResponse: `{"error":"invalid query: cannot sort by \"content\""}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "return-error-invalid-shortcut",
+			collection:       fakePostCol,
+			query:            "?createdAfter=yesterday",
+			expectedResponse: `{"error":"invalid query: \"yesterday\" is not a valid value for createdAt"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "return-error-unknown-selected-field",
+			collection:       fakePostCol,
+			query:            "?fields=id,secret",
+			expectedResponse: `{"error":"invalid query: unknown field \"secret\""}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "return-error-malformed-cursor",
+			collection:       fakePostCol,
+			query:            "?sort=-createdAt&cursor=12345",
+			expectedResponse: `{"error":"invalid query: malformed cursor"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "return-error-invalid-author-header",
+			collection:       fakePostCol,
+			authorHeader:     "12345",
+			expectedResponse: `{"error":"the provided hex string is not a valid ObjectID"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			a := new(App)
+			router := mux.NewRouter()
+			subRouter := router.PathPrefix("/post").Subrouter()
+			subRouter.HandleFunc("/", a.handleListPosts(NewMockPost, fakeDbName, st.collection)).Methods(http.MethodGet)
+
+			w := httptest.NewRecorder()
+			r, err := http.NewRequest(http.MethodGet, "/post/"+st.query, nil)
+			if st.authorHeader != "" {
+				r.Header.Set("X-Author-Id", st.authorHeader)
+			}
+			router.ServeHTTP(w, r)
+
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedCode, w.Code)
+			}
+
+			b, err := io.ReadAll(w.Body)
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedResponse, strings.TrimSuffix(string(b), "\n"))
+			}
+		})
+	}
+}
+
+func TestHandleListTags(t *testing.T) {
+	subtests := []struct {
+		name             string
+		collection       string
+		query            string
+		expectedResponse string
+		expectedCode     int
+	}{
+		{
+			name:             "happy-path",
+			collection:       fakePostCol,
+			expectedResponse: `{"items":[{"tag":"go","count":2},{"tag":"mongodb","count":1}]}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "limit",
+			collection:       fakePostCol,
+			query:            "?limit=1",
+			expectedResponse: `{"items":[{"tag":"go","count":2}]}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "return-error",
+			collection:       "fakeOtherCol",
+			expectedResponse: `{"error":"dummy error"}`,
+			expectedCode:     http.StatusInternalServerError,
+		},
+		{
+			name:             "return-error-invalid-limit",
+			collection:       fakePostCol,
+			query:            "?limit=1000",
+			expectedResponse: `{"error":"limit must be a number between 1 and 100"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			a := new(App)
+			router := mux.NewRouter()
+			router.HandleFunc("/tags", a.handleListTags(NewMockPost, fakeDbName, st.collection)).Methods(http.MethodGet)
+
+			w := httptest.NewRecorder()
+			r, err := http.NewRequest(http.MethodGet, "/tags"+st.query, nil)
+			router.ServeHTTP(w, r)
+
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedCode, w.Code)
+			}
+
+			b, err := io.ReadAll(w.Body)
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedResponse, strings.TrimSuffix(string(b), "\n"))
+			}
+		})
+	}
+}
+
+func TestHandlePutPost(t *testing.T) {
+	subtests := []struct {
+		name             string
+		ifMatch          string
+		collection       string
+		postIdHex        string
+		expectedResponse string
+		expectedCode     int
+	}{
+		{
+			name:             "happy-path",
+			collection:       fakePostCol,
+			postIdHex:        fakePostObjIdHex,
+			expectedResponse: `{"msj":"post updated"}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "return-error",
+			collection:       "fakeOtherCol",
+			postIdHex:        fakePostObjIdHex,
+			expectedResponse: `{"error":"dummy error"}`,
+			expectedCode:     http.StatusInternalServerError,
+		},
+		{
+			name:             "no-docs",
+			collection:       "NoDocs",
+			postIdHex:        fakePostObjIdHex,
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+		{
+			name:             "return-error-invalid-hex-id",
+			collection:       fakePostCol,
+			postIdHex:        "12345",
+			expectedResponse: `{"error":"the provided hex string is not a valid ObjectID"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "if-match",
+			collection:       fakePostCol,
+			postIdHex:        fakePostObjIdHex,
+			ifMatch:          `"1"`,
+			expectedResponse: `{"msj":"post updated"}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "version-mismatch",
+			collection:       fakePostCol,
+			postIdHex:        fakePostObjIdHex,
+			ifMatch:          `"2"`,
+			expectedResponse: `{"error":"document version mismatch"}`,
+			expectedCode:     http.StatusPreconditionFailed,
+		},
+		{
+			name:             "if-match-list",
+			collection:       fakePostCol,
+			postIdHex:        fakePostObjIdHex,
+			ifMatch:          `"2", "1"`,
+			expectedResponse: `{"msj":"post updated"}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "version-mismatch-weak",
+			collection:       fakePostCol,
+			postIdHex:        fakePostObjIdHex,
+			ifMatch:          `W/"1"`,
+			expectedResponse: `{"error":"document version mismatch"}`,
+			expectedCode:     http.StatusPreconditionFailed,
+		},
+		{
+			name:             "return-error-invalid-if-match",
+			collection:       fakePostCol,
+			postIdHex:        fakePostObjIdHex,
+			ifMatch:          "1",
+			expectedResponse: `{"error":"If-Match must be * or a list of entity tags as returned in ETag"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			a := new(App)
+			router := mux.NewRouter()
+			subRouter := router.PathPrefix("/post").Subrouter()
+			subRouter.HandleFunc("/{id:[a-z0-9]+}", a.handlePutPost(NewMockPost, "fakeDb", st.collection)).Methods(http.MethodPut)
+
+			w := httptest.NewRecorder()
+			jsonBody := strings.NewReader(`{"content":"updated fake content"}`)
+			url := fmt.Sprintf("/post/%v", st.postIdHex)
+			r, err := http.NewRequest(http.MethodPut, url, jsonBody)
+			if st.ifMatch != "" {
+				r.Header.Set("If-Match", st.ifMatch)
+			}
+			router.ServeHTTP(w, r)
+
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedCode, w.Code)
+			}
+
+			b, err := io.ReadAll(w.Body)
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedResponse, strings.TrimSuffix(string(b), "\n"))
+			}
+		})
+	}
+}
+
+func TestHandlePatchPost(t *testing.T) {
+	subtests := []struct {
+		name             string
+		ifMatch          string
+		collection       string
+		postIdHex        string
+		contentType      string
+		body             string
+		expectedResponse string
+		expectedCode     int
+	}{
+		{
+			name:             "happy-path",
+			collection:       fakePostCol,
+			postIdHex:        fakePostObjIdHex,
+			contentType:      "application/merge-patch+json",
+			body:             `{"content":"patched fake content"}`,
+			expectedResponse: `{"msj":"post updated"}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "return-error",
+			collection:       "fakeOtherCol",
+			postIdHex:        fakePostObjIdHex,
+			contentType:      "application/merge-patch+json",
+			body:             `{"content":"patched fake content"}`,
+			expectedResponse: `{"error":"dummy error"}`,
+			expectedCode:     http.StatusInternalServerError,
+		},
+		{
+			name:             "no-docs",
+			collection:       "NoDocs",
+			postIdHex:        fakePostObjIdHex,
+			contentType:      "application/merge-patch+json",
+			body:             `{"content":"patched fake content"}`,
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+		{
+			name:             "return-error-read-only-field",
+			collection:       fakePostCol,
+			postIdHex:        fakePostObjIdHex,
+			contentType:      "application/merge-patch+json",
+			body:             `{"id":"` + fakePostObjIdHex + `"}`,
+			expectedResponse: `{"error":"invalid merge patch: field \"id\" cannot be patched"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "return-error-scheduled-without-publish-at",
+			collection:       fakePostCol,
+			postIdHex:        fakePostObjIdHex,
+			contentType:      "application/merge-patch+json",
+			body:             `{"status":"scheduled"}`,
+			expectedResponse: `{"error":"scheduled posts must have a publishAt time"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "happy-path-scheduled",
+			collection:       fakePostCol,
+			postIdHex:        fakePostObjIdHex,
+			contentType:      "application/merge-patch+json",
+			body:             `{"status":"scheduled","publishAt":"2030-01-01T00:00:00Z"}`,
+			expectedResponse: `{"msj":"post updated"}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "return-error-not-an-object",
+			collection:       fakePostCol,
+			postIdHex:        fakePostObjIdHex,
+			contentType:      "application/merge-patch+json",
+			body:             `null`,
+			expectedResponse: `{"error":"merge patch must be a json object"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "return-error-content-type",
+			collection:       fakePostCol,
+			postIdHex:        fakePostObjIdHex,
+			contentType:      "application/json",
+			body:             `{"content":"patched fake content"}`,
+			expectedResponse: `{"error":"content type must be application/merge-patch+json"}`,
+			expectedCode:     http.StatusUnsupportedMediaType,
+		},
+		{
+			name:             "return-error-invalid-hex-id",
+			collection:       fakePostCol,
+			postIdHex:        "12345",
+			contentType:      "application/merge-patch+json",
+			body:             `{"content":"patched fake content"}`,
+			expectedResponse: `{"error":"the provided hex string is not a valid ObjectID"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "if-match",
+			collection:       fakePostCol,
+			contentType:      "application/merge-patch+json",
+			body:             `{"content":"patched fake content"}`,
+			postIdHex:        fakePostObjIdHex,
+			ifMatch:          `"1"`,
+			expectedResponse: `{"msj":"post updated"}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "version-mismatch",
+			collection:       fakePostCol,
+			contentType:      "application/merge-patch+json",
+			body:             `{"content":"patched fake content"}`,
+			postIdHex:        fakePostObjIdHex,
+			ifMatch:          `"2"`,
+			expectedResponse: `{"error":"document version mismatch"}`,
+			expectedCode:     http.StatusPreconditionFailed,
+		},
+		{
+			name:             "return-error-invalid-if-match",
+			collection:       fakePostCol,
+			contentType:      "application/merge-patch+json",
+			body:             `{"content":"patched fake content"}`,
+			postIdHex:        fakePostObjIdHex,
+			ifMatch:          "1",
+			expectedResponse: `{"error":"If-Match must be * or a list of entity tags as returned in ETag"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			a := new(App)
+			router := mux.NewRouter()
+			subRouter := router.PathPrefix("/post").Subrouter()
+			subRouter.HandleFunc("/{id:[a-z0-9]+}", a.handlePatchPost(NewMockPost, fakeDbName, st.collection)).Methods(http.MethodPatch)
+
+			w := httptest.NewRecorder()
+			url := fmt.Sprintf("/post/%v", st.postIdHex)
+			r, err := http.NewRequest(http.MethodPatch, url, strings.NewReader(st.body))
+			r.Header.Set("Content-Type", st.contentType)
+			if st.ifMatch != "" {
+				r.Header.Set("If-Match", st.ifMatch)
+			}
+			router.ServeHTTP(w, r)
+
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedCode, w.Code)
+			}
+
+			b, err := io.ReadAll(w.Body)
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedResponse, strings.TrimSuffix(string(b), "\n"))
+			}
+		})
+	}
+}
+
+func TestHandleDeletePost(t *testing.T) {
+	subtests := []struct {
+		name              string
+		ifMatch           string
+		collection        string
+		commentCollection string
+		postIdHex         string
+		query             string
+		expectedResponse  string
+		expectedCode      int
+	}{
+		{
+			name:              "happy-path",
+			collection:        fakePostCol,
+			commentCollection: fakeCommentCol,
+			postIdHex:         fakePostObjIdHex,
+			expectedResponse:  `{"commentsDeleted":2,"msj":"post deleted"}`,
+			expectedCode:      http.StatusOK,
+		},
+		{
+			name:              "detach-comments",
+			collection:        fakePostCol,
+			commentCollection: fakeCommentCol,
+			postIdHex:         fakePostObjIdHex,
+			query:             "?detachComments=true",
+			expectedResponse:  `{"commentsDetached":2,"msj":"post deleted"}`,
+			expectedCode:      http.StatusOK,
+		},
+		{
+			name:              "return-error",
+			collection:        "fakeOtherCol",
+			commentCollection: fakeCommentCol,
+			postIdHex:         fakePostObjIdHex,
+			expectedResponse:  `{"error":"dummy error"}`,
+			expectedCode:      http.StatusInternalServerError,
+		},
+		{
+			name:              "return-error-comments",
+			collection:        fakePostCol,
+			commentCollection: "fakeOtherCol",
+			postIdHex:         fakePostObjIdHex,
+			expectedResponse:  `{"error":"dummy error"}`,
+			expectedCode:      http.StatusInternalServerError,
+		},
+		{
+			name:              "no-docs",
+			collection:        "NoDocs",
+			commentCollection: fakeCommentCol,
+			postIdHex:         fakePostObjIdHex,
+			expectedResponse:  `{"error":"mongo: no documents in result"}`,
+			expectedCode:      http.StatusNotFound,
+		},
+		{
+			name:              "return-error-invalid-detach",
+			collection:        fakePostCol,
+			commentCollection: fakeCommentCol,
+			postIdHex:         fakePostObjIdHex,
+			query:             "?detachComments=maybe",
+			expectedResponse:  `{"error":"strconv.ParseBool: parsing \"maybe\": invalid syntax"}`,
+			expectedCode:      http.StatusBadRequest,
+		},
+		{
+			name:              "return-error-invalid-hex-id",
+			collection:        "fakePostCol",
+			commentCollection: fakeCommentCol,
+			postIdHex:         "12345",
+			expectedResponse:  `{"error":"the provided hex string is not a valid ObjectID"}`,
+			expectedCode:      http.StatusBadRequest,
+		},
+		{
+			name:              "if-match",
+			collection:        fakePostCol,
+			commentCollection: fakeCommentCol,
+			postIdHex:         fakePostObjIdHex,
+			ifMatch:           `"1"`,
+			expectedResponse:  `{"commentsDeleted":2,"msj":"post deleted"}`,
+			expectedCode:      http.StatusOK,
+		},
+		{
+			name:              "version-mismatch",
+			collection:        fakePostCol,
+			commentCollection: fakeCommentCol,
+			postIdHex:         fakePostObjIdHex,
+			ifMatch:           `"2"`,
+			expectedResponse:  `{"error":"document version mismatch"}`,
+			expectedCode:      http.StatusPreconditionFailed,
+		},
+		{
+			name:              "return-error-invalid-if-match",
+			collection:        fakePostCol,
+			commentCollection: fakeCommentCol,
+			postIdHex:         fakePostObjIdHex,
+			ifMatch:           "1",
+			expectedResponse:  `{"error":"If-Match must be * or a list of entity tags as returned in ETag"}`,
+			expectedCode:      http.StatusBadRequest,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			a := new(App)
+			router := mux.NewRouter()
+			subRouter := router.PathPrefix("/post").Subrouter()
+
+			mockModels := NewMockModels()
+			mockModels.PColName = st.collection
+			mockModels.CColName = st.commentCollection
+			subRouter.HandleFunc("/{id:[a-z0-9]+}", a.handleDeletePost(mockModels, fakeDbName)).Methods(http.MethodDelete)
+
+			w := httptest.NewRecorder()
+			url := fmt.Sprintf("/post/%v%v", st.postIdHex, st.query)
+			r, err := http.NewRequest(http.MethodDelete, url, nil)
+			if st.ifMatch != "" {
+				r.Header.Set("If-Match", st.ifMatch)
+			}
+			router.ServeHTTP(w, r)
+
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedCode, w.Code)
+			}
+
+			b, err := io.ReadAll(w.Body)
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedResponse, strings.TrimSuffix(string(b), "\n"))
+			}
+		})
+	}
+}
+
+func TestHandleListRevisions(t *testing.T) {
+	subtests := []struct {
+		name             string
+		collection       string
+		postIdHex        string
+		authorHeader     string
+		expectedResponse string
+		expectedCode     int
+	}{
+		{
+			name:             "happy-path",
+			collection:       fakePostCol,
+			postIdHex:        fakePostObjIdHex,
+			expectedResponse: `{"items":[` + `{"postId":"` + fakePostObjIdHex + `","revision":1,"post":{"id":"` + fakePostObjIdHex + `","content":"fake content","author":"fake author","version":1}}` + `]}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "return-error",
+			collection:       "fakeOtherCol",
+			postIdHex:        fakePostObjIdHex,
+			expectedResponse: `{"error":"dummy error"}`,
+			expectedCode:     http.StatusInternalServerError,
+		},
+		{
+			name:             "no-docs",
+			collection:       "NoDocs",
+			postIdHex:        fakePostObjIdHex,
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+		{
+			name:             "return-error-invalid-hex-id",
+			collection:       fakePostCol,
+			postIdHex:        "12345",
+			expectedResponse: `{"error":"the provided hex string is not a valid ObjectID"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "return-error-draft-read-anonymously",
+			collection:       fakePostCol,
+			postIdHex:        fakeDraftObjIdHex,
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+		{
+			name:             "draft-read-by-author",
+			collection:       fakePostCol,
+			postIdHex:        fakeDraftObjIdHex,
+			authorHeader:     fakeAuthorObjIdHex,
+			expectedResponse: `{"items":[` + `{"postId":"` + fakeDraftObjIdHex + `","revision":1,"post":{"id":"` + fakeDraftObjIdHex + `","content":"fake content","author":"fake author","version":1}}` + `]}`,
+			expectedCode:     http.StatusOK,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			a := new(App)
+			router := mux.NewRouter()
+			subRouter := router.PathPrefix("/post").Subrouter()
+			subRouter.HandleFunc("/{id:[a-z0-9]+}/revisions", a.handleListRevisions(NewMockPost, fakeDbName, st.collection)).Methods(http.MethodGet)
+
+			w := httptest.NewRecorder()
+			url := fmt.Sprintf("/post/%v/revisions", st.postIdHex)
+			r, err := http.NewRequest(http.MethodGet, url, nil)
+			if st.authorHeader != "" {
+				r.Header.Set("X-Author-Id", st.authorHeader)
+			}
+			router.ServeHTTP(w, r)
+
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedCode, w.Code)
+			}
+
+			b, err := io.ReadAll(w.Body)
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedResponse, strings.TrimSuffix(string(b), "\n"))
+			}
+		})
+	}
+}
+
+func TestHandleGetRevision(t *testing.T) {
+	subtests := []struct {
+		name             string
+		collection       string
+		revision         string
+		postIdHex        string
+		authorHeader     string
+		expectedResponse string
+		expectedCode     int
+	}{
+		{
+			name:             "happy-path",
+			collection:       fakePostCol,
+			revision:         "1",
+			expectedResponse: `{"postId":"` + fakePostObjIdHex + `","revision":1,"post":{"id":"` + fakePostObjIdHex + `","content":"fake content","author":"fake author","version":1}}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "return-error",
+			collection:       "fakeOtherCol",
+			revision:         "1",
+			expectedResponse: `{"error":"dummy error"}`,
+			expectedCode:     http.StatusInternalServerError,
+		},
+		{
+			name:             "no-docs",
+			collection:       fakePostCol,
+			revision:         "5",
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+		{
+			name:             "return-error-draft-read-anonymously",
+			collection:       fakePostCol,
+			postIdHex:        fakeDraftObjIdHex,
+			revision:         "1",
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+		{
+			name:             "return-error-draft-read-by-other-author",
+			collection:       fakePostCol,
+			postIdHex:        fakeDraftObjIdHex,
+			revision:         "1",
+			authorHeader:     fakeBusyAuthorObjIdHex,
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			if st.postIdHex == "" {
+				st.postIdHex = fakePostObjIdHex
+			}
+			a := new(App)
+			router := mux.NewRouter()
+			subRouter := router.PathPrefix("/post").Subrouter()
+			subRouter.HandleFunc("/{id:[a-z0-9]+}/revisions/{n:[0-9]+}", a.handleGetRevision(NewMockPost, fakeDbName, st.collection)).Methods(http.MethodGet)
+
+			w := httptest.NewRecorder()
+			url := fmt.Sprintf("/post/%v/revisions/%v", st.postIdHex, st.revision)
+			r, err := http.NewRequest(http.MethodGet, url, nil)
+			if st.authorHeader != "" {
+				r.Header.Set("X-Author-Id", st.authorHeader)
+			}
+			router.ServeHTTP(w, r)
+
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedCode, w.Code)
+			}
+
+			b, err := io.ReadAll(w.Body)
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedResponse, strings.TrimSuffix(string(b), "\n"))
+			}
+		})
+	}
+}
+
+func TestHandleDiffRevisions(t *testing.T) {
+	subtests := []struct {
+		name             string
+		collection       string
+		query            string
+		postIdHex        string
+		authorHeader     string
+		expectedResponse string
+		expectedCode     int
+	}{
+		{
+			name:             "happy-path",
+			collection:       fakePostCol,
+			query:            "?to=2",
+			expectedResponse: `{"diff":"--- revision 1\n+++ revision 2\n author: fake author\n \n fake content\n+more fake content\n","from":1,"to":2}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "against-current-version",
+			collection:       fakePostCol,
+			expectedResponse: `{"diff":"--- revision 1\n+++ revision 1\n author: fake author\n \n fake content\n","from":1,"to":1}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "return-error",
+			collection:       "fakeOtherCol",
+			query:            "?to=2",
+			expectedResponse: `{"error":"dummy error"}`,
+			expectedCode:     http.StatusInternalServerError,
+		},
+		{
+			name:             "no-docs",
+			collection:       fakePostCol,
+			query:            "?to=5",
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+		{
+			name:             "return-error-too-large",
+			collection:       fakePostCol,
+			query:            "?to=3",
+			expectedResponse: `{"error":"revisions longer than 1000 lines cannot be compared"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "return-error-invalid-to",
+			collection:       fakePostCol,
+			query:            "?to=last",
+			expectedResponse: `{"error":"strconv.ParseInt: parsing \"last\": invalid syntax"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "return-error-draft-read-anonymously",
+			collection:       fakePostCol,
+			postIdHex:        fakeDraftObjIdHex,
+			query:            "?to=2",
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			if st.postIdHex == "" {
+				st.postIdHex = fakePostObjIdHex
+			}
+			a := new(App)
+			router := mux.NewRouter()
+			subRouter := router.PathPrefix("/post").Subrouter()
+			subRouter.HandleFunc("/{id:[a-z0-9]+}/revisions/{n:[0-9]+}/diff", a.handleDiffRevisions(NewMockPost, fakeDbName, st.collection)).Methods(http.MethodGet)
+
+			w := httptest.NewRecorder()
+			url := fmt.Sprintf("/post/%v/revisions/1/diff%v", st.postIdHex, st.query)
+			r, err := http.NewRequest(http.MethodGet, url, nil)
+			if st.authorHeader != "" {
+				r.Header.Set("X-Author-Id", st.authorHeader)
+			}
+			router.ServeHTTP(w, r)
+
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedCode, w.Code)
+			}
+
+			b, err := io.ReadAll(w.Body)
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedResponse, strings.TrimSuffix(string(b), "\n"))
+			}
+		})
+	}
+}
+
+func TestHandleRestoreRevision(t *testing.T) {
+	subtests := []struct {
+		name             string
+		collection       string
+		revision         string
+		ifMatch          string
+		expectedResponse string
+		expectedCode     int
+	}{
+		{
+			name:             "happy-path",
+			collection:       fakePostCol,
+			revision:         "1",
+			expectedResponse: `{"msj":"post restored"}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "return-error",
+			collection:       "fakeOtherCol",
+			revision:         "1",
+			expectedResponse: `{"error":"dummy error"}`,
+			expectedCode:     http.StatusInternalServerError,
+		},
+		{
+			name:             "no-docs",
+			collection:       fakePostCol,
+			revision:         "5",
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+		{
+			name:             "version-mismatch",
+			collection:       fakePostCol,
+			revision:         "1",
+			ifMatch:          `"3"`,
+			expectedResponse: `{"error":"document version mismatch"}`,
+			expectedCode:     http.StatusPreconditionFailed,
+		},
+		{
+			name:             "return-error-scheduled-without-publish-at",
+			collection:       fakePostCol,
+			revision:         "4",
+			expectedResponse: `{"error":"scheduled posts must have a publishAt time"}`,
+			expectedCode:     http.StatusConflict,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			a := new(App)
+			router := mux.NewRouter()
+			subRouter := router.PathPrefix("/post").Subrouter()
+			subRouter.HandleFunc("/{id:[a-z0-9]+}/revisions/{n:[0-9]+}/restore", a.handleRestoreRevision(NewMockPost, fakeDbName, st.collection)).Methods(http.MethodPost)
+
+			w := httptest.NewRecorder()
+			url := fmt.Sprintf("/post/%v/revisions/%v/restore", fakePostObjIdHex, st.revision)
+			r, err := http.NewRequest(http.MethodPost, url, nil)
+			if st.ifMatch != "" {
+				r.Header.Set("If-Match", st.ifMatch)
+			}
+			router.ServeHTTP(w, r)
+
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedCode, w.Code)
+			}
+
+			b, err := io.ReadAll(w.Body)
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedResponse, strings.TrimSuffix(string(b), "\n"))
+			}
+		})
+	}
+}
+
+func TestHandleAddPostReaction(t *testing.T) {
+	subtests := []struct {
+		name             string
+		collection       string
+		authorCollection string
+		body             string
+		expectedResponse string
+		expectedCode     int
+	}{
+		{
+			name:             "happy-path",
+			collection:       fakePostCol,
+			authorCollection: fakeAuthorCol,
+			body:             `{"type":"like","authorId":"` + fakeAuthorObjIdHex + `"}`,
+			expectedResponse: `{"msj":"reaction added"}`,
+			expectedCode:     http.StatusCreated,
+		},
+		{
+			name:             "return-error",
+			collection:       "fakeOtherCol",
+			authorCollection: fakeAuthorCol,
+			body:             `{"type":"like","authorId":"` + fakeAuthorObjIdHex + `"}`,
+			expectedResponse: `{"error":"dummy error"}`,
+			expectedCode:     http.StatusInternalServerError,
+		},
+		{
+			name:             "post-not-found",
+			collection:       "NoDocs",
+			authorCollection: fakeAuthorCol,
+			body:             `{"type":"like","authorId":"` + fakeAuthorObjIdHex + `"}`,
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+		{
+			name:             "author-not-found",
+			collection:       fakePostCol,
+			authorCollection: "NoDocs",
+			body:             `{"type":"like","authorId":"` + fakeAuthorObjIdHex + `"}`,
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+		{
+			name:             "already-reacted",
+			collection:       fakePostCol,
+			authorCollection: fakeAuthorCol,
+			body:             `{"type":"love","authorId":"` + fakeAuthorObjIdHex + `"}`,
+			expectedResponse: `{"error":"author already reacted with this type"}`,
+			expectedCode:     http.StatusConflict,
+		},
+		{
+			name:             "return-error-invalid-type",
+			collection:       fakePostCol,
+			authorCollection: fakeAuthorCol,
+			body:             `{"type":"meh","authorId":"` + fakeAuthorObjIdHex + `"}`,
+			expectedResponse: `{"error":"reaction type must be one of like, love, laugh, wow, sad, angry"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			a := new(App)
+			router := mux.NewRouter()
+			subRouter := router.PathPrefix("/post").Subrouter()
+
+			mockModels := NewMockModels()
+			mockModels.PColName = st.collection
+			mockModels.AColName = st.authorCollection
+			subRouter.HandleFunc("/{id:[a-z0-9]+}/reactions", a.handleAddPostReaction(mockModels, fakeDbName)).Methods(http.MethodPost)
+
+			w := httptest.NewRecorder()
+			r, err := http.NewRequest(http.MethodPost, "/post/"+fakePostObjIdHex+"/reactions", strings.NewReader(st.body))
+			router.ServeHTTP(w, r)
+
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedCode, w.Code)
+			}
+
+			b, err := io.ReadAll(w.Body)
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedResponse, strings.TrimSuffix(string(b), "\n"))
+			}
+		})
+	}
+}
+
+func TestHandleRemovePostReaction(t *testing.T) {
+	subtests := []struct {
+		name             string
+		collection       string
+		query            string
+		expectedResponse string
+		expectedCode     int
+	}{
+		{
+			name:             "happy-path",
+			collection:       fakePostCol,
+			query:            "?type=love&authorId=" + fakeAuthorObjIdHex,
+			expectedResponse: `{"msj":"reaction removed"}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "return-error",
+			collection:       "fakeOtherCol",
+			query:            "?type=love&authorId=" + fakeAuthorObjIdHex,
+			expectedResponse: `{"error":"dummy error"}`,
+			expectedCode:     http.StatusInternalServerError,
+		},
+		{
+			name:             "reaction-not-found",
+			collection:       fakePostCol,
+			query:            "?type=like&authorId=" + fakeAuthorObjIdHex,
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+		{
+			name:             "return-error-invalid-type",
+			collection:       fakePostCol,
+			query:            "?type=meh&authorId=" + fakeAuthorObjIdHex,
+			expectedResponse: `{"error":"reaction type must be one of like, love, laugh, wow, sad, angry"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "return-error-invalid-author-id",
+			collection:       fakePostCol,
+			query:            "?type=love",
+			expectedResponse: `{"error":"the provided hex string is not a valid ObjectID"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			a := new(App)
+			router := mux.NewRouter()
+			subRouter := router.PathPrefix("/post").Subrouter()
+			subRouter.HandleFunc("/{id:[a-z0-9]+}/reactions", a.handleRemovePostReaction(NewMockPost, fakeDbName, st.collection)).Methods(http.MethodDelete)
+
+			w := httptest.NewRecorder()
+			r, err := http.NewRequest(http.MethodDelete, "/post/"+fakePostObjIdHex+"/reactions"+st.query, nil)
+			router.ServeHTTP(w, r)
+
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedCode, w.Code)
+			}
+
+			b, err := io.ReadAll(w.Body)
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedResponse, strings.TrimSuffix(string(b), "\n"))
+			}
+		})
+	}
+}
+
+func TestHandleAddPostAttachment(t *testing.T) {
+	subtests := []struct {
+		name             string
+		collection       string
+		postIdHex        string
+		field            string
+		fileName         string
+		multipart        bool
+		expectedResponse string
+		expectedCode     int
+	}{
+		{
+			name:             "happy-path",
+			collection:       fakePostCol,
+			postIdHex:        fakePostObjIdHex,
+			field:            "file",
+			fileName:         "notes.txt",
+			multipart:        true,
+			expectedResponse: `{"id":"` + fakeAttachmentObjIdHex + `","name":"notes.txt","contentType":"text/plain","size":23}`,
+			expectedCode:     http.StatusCreated,
+		},
+		{
+			name:             "return-error",
+			collection:       "fakeOtherCol",
+			postIdHex:        fakePostObjIdHex,
+			field:            "file",
+			fileName:         "notes.txt",
+			multipart:        true,
+			expectedResponse: `{"error":"dummy error"}`,
+			expectedCode:     http.StatusInternalServerError,
+		},
+		{
+			name:             "return-error-missing-post",
+			collection:       fakePostCol,
+			postIdHex:        fakeMissingObjIdHex,
+			field:            "file",
+			fileName:         "notes.txt",
+			multipart:        true,
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+		{
+			name:             "return-error-file-type",
+			collection:       fakePostCol,
+			postIdHex:        fakePostObjIdHex,
+			field:            "file",
+			fileName:         "run.exe",
+			multipart:        true,
+			expectedResponse: `{"error":"` + appDb.ErrAttachmentType.Error() + `"}`,
+			expectedCode:     http.StatusUnsupportedMediaType,
+		},
+		{
+			name:             "return-error-missing-file",
+			collection:       fakePostCol,
+			postIdHex:        fakePostObjIdHex,
+			field:            "other",
+			fileName:         "notes.txt",
+			multipart:        true,
+			expectedResponse: `{"error":"form must have a file field"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "return-error-not-multipart",
+			collection:       fakePostCol,
+			postIdHex:        fakePostObjIdHex,
+			expectedResponse: `{"error":"content type must be multipart/form-data"}`,
+			expectedCode:     http.StatusUnsupportedMediaType,
+		},
+		{
+			name:             "return-error-invalid-hex-id",
+			collection:       fakePostCol,
+			postIdHex:        "12345",
+			expectedResponse: `{"error":"the provided hex string is not a valid ObjectID"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			a := new(App)
+			router := mux.NewRouter()
+			subRouter := router.PathPrefix("/post").Subrouter()
+			subRouter.HandleFunc("/{id:[a-z0-9]+}/attachments", a.handleAddPostAttachment(NewMockPost, fakeDbName, st.collection)).Methods(http.MethodPost)
+
+			body := new(bytes.Buffer)
+			contentType := "application/json"
+			if st.multipart {
+				mw := multipart.NewWriter(body)
+				fw, err := mw.CreateFormFile(st.field, st.fileName)
+				if assert.NoError(t, err) {
+					_, err = fw.Write([]byte(fakeAttachmentContent))
+					assert.NoError(t, err)
+				}
+				assert.NoError(t, mw.Close())
+				contentType = mw.FormDataContentType()
+			}
+
+			w := httptest.NewRecorder()
+			r, err := http.NewRequest(http.MethodPost, fmt.Sprintf("/post/%v/attachments", st.postIdHex), body)
+			r.Header.Set("Content-Type", contentType)
+			router.ServeHTTP(w, r)
+
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedCode, w.Code)
+			}
+
+			b, err := io.ReadAll(w.Body)
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedResponse, strings.TrimSuffix(string(b), "\n"))
+			}
+		})
+	}
+}
+
+func TestHandleGetPostAttachment(t *testing.T) {
+	subtests := []struct {
+		name                 string
+		collection           string
+		fileIdHex            string
+		query                string
+		rangeHeader          string
+		postIdHex            string
+		authorHeader         string
+		expectedResponse     string
+		expectedContentType  string
+		expectedContentRange string
+		expectedCode         int
+	}{
+		{
+			name:                "happy-path",
+			collection:          fakePostCol,
+			fileIdHex:           fakeAttachmentObjIdHex,
+			expectedResponse:    fakeAttachmentContent,
+			expectedContentType: "text/plain",
+			expectedCode:        http.StatusOK,
+		},
+		{
+			name:                "thumbnail",
+			collection:          fakePostCol,
+			fileIdHex:           fakeAttachmentObjIdHex,
+			query:               fmt.Sprintf("?size=%v", fakeThumbnailSize),
+			expectedResponse:    fakeThumbnailContent,
+			expectedContentType: "image/png",
+			expectedCode:        http.StatusOK,
+		},
+		{
+			name:             "return-error-missing-thumbnail",
+			collection:       fakePostCol,
+			fileIdHex:        fakeAttachmentObjIdHex,
+			query:            "?size=128",
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+		{
+			name:             "return-error-invalid-size",
+			collection:       fakePostCol,
+			fileIdHex:        fakeAttachmentObjIdHex,
+			query:            "?size=100",
+			expectedResponse: `{"error":"size must be one of [64 128]"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:                 "range",
+			collection:           fakePostCol,
+			fileIdHex:            fakeAttachmentObjIdHex,
+			rangeHeader:          "bytes=5-14",
+			expectedResponse:     "attachment",
+			expectedContentRange: "bytes 5-14/23",
+			expectedCode:         http.StatusPartialContent,
+		},
+		{
+			name:                 "return-error-unsatisfiable-range",
+			collection:           fakePostCol,
+			fileIdHex:            fakeAttachmentObjIdHex,
+			rangeHeader:          "bytes=100-",
+			expectedResponse:     "invalid range: failed to overlap",
+			expectedContentRange: "bytes */23",
+			expectedCode:         http.StatusRequestedRangeNotSatisfiable,
+		},
+		{
+			name:             "return-error",
+			collection:       "fakeOtherCol",
+			fileIdHex:        fakeAttachmentObjIdHex,
+			expectedResponse: `{"error":"dummy error"}`,
+			expectedCode:     http.StatusInternalServerError,
+		},
+		{
+			name:             "return-error-missing-attachment",
+			collection:       fakePostCol,
+			fileIdHex:        fakeMissingObjIdHex,
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+		{
+			name:             "return-error-invalid-hex-id",
+			collection:       fakePostCol,
+			fileIdHex:        "12345",
+			expectedResponse: `{"error":"the provided hex string is not a valid ObjectID"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "return-error-draft-read-anonymously",
+			collection:       fakePostCol,
+			postIdHex:        fakeDraftObjIdHex,
+			fileIdHex:        fakeAttachmentObjIdHex,
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+		{
+			name:                "draft-read-by-author",
+			collection:          fakePostCol,
+			postIdHex:           fakeDraftObjIdHex,
+			fileIdHex:           fakeAttachmentObjIdHex,
+			authorHeader:        fakeAuthorObjIdHex,
+			expectedResponse:    fakeAttachmentContent,
+			expectedContentType: "text/plain",
+			expectedCode:        http.StatusOK,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			if st.postIdHex == "" {
+				st.postIdHex = fakePostObjIdHex
+			}
+			a := &App{thumbs: &thumbnailer{sizes: []int{fakeThumbnailSize, 128}}}
+			router := mux.NewRouter()
+			subRouter := router.PathPrefix("/post").Subrouter()
+			subRouter.HandleFunc("/{id:[a-z0-9]+}/attachments/{fileId:[a-z0-9]+}", a.handleGetPostAttachment(NewMockPost, fakeDbName, st.collection)).Methods(http.MethodGet)
+
+			w := httptest.NewRecorder()
+			r, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/post/%v/attachments/%v%v", st.postIdHex, st.fileIdHex, st.query), nil)
+			if st.authorHeader != "" {
+				r.Header.Set("X-Author-Id", st.authorHeader)
+			}
+			if st.rangeHeader != "" {
+				r.Header.Set("Range", st.rangeHeader)
+			}
+			router.ServeHTTP(w, r)
+
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedCode, w.Code)
+				assert.EqualValues(t, st.expectedContentRange, w.Header().Get("Content-Range"))
+				if st.expectedCode == http.StatusOK {
+					assert.EqualValues(t, st.expectedContentType, w.Header().Get("Content-Type"))
+				}
+			}
+
+			b, err := io.ReadAll(w.Body)
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedResponse, strings.TrimSuffix(string(b), "\n"))
+			}
+		})
+	}
+}
+
+func TestRenderCache(t *testing.T) {
+	id, otherId := getObjId(fakePostObjIdHex), getObjId(fakeMarkdownObjIdHex)
+
+	t.Run("nil", func(t *testing.T) {
+		var c *renderCache
+		c.put(id, 1, "<p>fake</p>")
+		_, ok := c.get(id, 1)
+		assert.False(t, ok)
+	})
+
+	t.Run("versions", func(t *testing.T) {
+		c := newRenderCache(2)
+		c.put(id, 1, "<p>fake</p>")
+		html, ok := c.get(id, 1)
+		assert.True(t, ok)
+		assert.EqualValues(t, "<p>fake</p>", html)
+		_, ok = c.get(id, 2)
+		assert.False(t, ok)
+		c.put(id, 2, "<p>updated</p>")
+		html, _ = c.get(id, 2)
+		assert.EqualValues(t, "<p>updated</p>", html)
+		c.invalidate(id)
+		_, ok = c.get(id, 2)
+		assert.False(t, ok)
+	})
+
+	t.Run("evicts-least-recently-used", func(t *testing.T) {
+		c := newRenderCache(2)
+		thirdId := getObjId(fakeCommentObjIdHex)
+		c.put(id, 1, "<p>first</p>")
+		c.put(otherId, 1, "<p>second</p>")
+		_, _ = c.get(id, 1)
+		c.put(thirdId, 1, "<p>third</p>")
+		_, ok := c.get(otherId, 1)
+		assert.False(t, ok)
+		_, ok = c.get(id, 1)
+		assert.True(t, ok)
+		c.clear()
+		_, ok = c.get(thirdId, 1)
+		assert.False(t, ok)
+	})
+}
+
+func TestPublisher(t *testing.T) {
+	var runs int32
+	newPost := func() appDb.Post {
+		atomic.AddInt32(&runs, 1)
+		return NewMockPost()
+	}
+	// scheduled posts due are published right away, then every interval
+	pb := newPublisher(newPost, nil, time.Hour, fakeDbName, fakePostCol)
+	pb.start()
+	pb.stop()
+	assert.EqualValues(t, 1, atomic.LoadInt32(&runs))
+}
+
+func TestThumbnailer(t *testing.T) {
+	job := thumbnailJob{postId: getObjId(fakePostObjIdHex), fileId: getObjId(fakeAttachmentObjIdHex)}
+
+	t.Run("nil", func(t *testing.T) {
+		var thumbs *thumbnailer
+		assert.False(t, thumbs.enqueue(job))
+		assert.False(t, thumbs.hasSize(fakeThumbnailSize))
+	})
+
+	t.Run("full-queue", func(t *testing.T) {
+		thumbs := &thumbnailer{jobs: make(chan thumbnailJob, 1)}
+		assert.True(t, thumbs.enqueue(job))
+		assert.False(t, thumbs.enqueue(job))
+	})
+
+	t.Run("stop-drains-queue", func(t *testing.T) {
+		thumbs := newThumbnailer(NewMockPost, nil, []int{fakeThumbnailSize}, 2, fakeDbName, fakePostCol)
+		for i := 0; i < 5; i++ {
+			assert.True(t, thumbs.enqueue(job))
+		}
+		thumbs.start()
+		thumbs.stop()
+		assert.Empty(t, thumbs.jobs)
+	})
+
+	t.Run("enqueue-after-stop", func(t *testing.T) {
+		thumbs := newThumbnailer(NewMockPost, nil, []int{fakeThumbnailSize}, 2, fakeDbName, fakePostCol)
+		thumbs.start()
+		thumbs.stop()
+		assert.NotPanics(t, func() {
+			assert.False(t, thumbs.enqueue(job))
+		})
+	})
+}
+
+func TestHandleDeletePostAttachment(t *testing.T) {
+	subtests := []struct {
+		name             string
+		collection       string
+		fileIdHex        string
+		expectedResponse string
+		expectedCode     int
+	}{
+		{
+			name:             "happy-path",
+			collection:       fakePostCol,
+			fileIdHex:        fakeAttachmentObjIdHex,
+			expectedResponse: `{"msj":"attachment deleted"}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "return-error",
+			collection:       "fakeOtherCol",
+			fileIdHex:        fakeAttachmentObjIdHex,
+			expectedResponse: `{"error":"dummy error"}`,
+			expectedCode:     http.StatusInternalServerError,
+		},
+		{
+			name:             "return-error-missing-attachment",
+			collection:       fakePostCol,
+			fileIdHex:        fakeMissingObjIdHex,
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			a := new(App)
+			router := mux.NewRouter()
+			subRouter := router.PathPrefix("/post").Subrouter()
+			subRouter.HandleFunc("/{id:[a-z0-9]+}/attachments/{fileId:[a-z0-9]+}", a.handleDeletePostAttachment(NewMockPost, fakeDbName, st.collection)).Methods(http.MethodDelete)
+
+			w := httptest.NewRecorder()
+			r, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("/post/%v/attachments/%v", fakePostObjIdHex, st.fileIdHex), nil)
+			router.ServeHTTP(w, r)
+
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedCode, w.Code)
+			}
+
+			b, err := io.ReadAll(w.Body)
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedResponse, strings.TrimSuffix(string(b), "\n"))
+			}
+		})
+	}
+}
+
+func TestHandleCreateComment(t *testing.T) {
+	subtests := []struct {
+		name             string
+		collection       string
+		authorCollection string
+		postIdHex        string
+		parentId         string
+		moderationMode   string
+		expectedResponse string
+		expectedCode     int
+	}{
+		{
+			name:             "happy-path",
+			collection:       fakeCommentCol,
+			expectedResponse: `{"InsertedID":"` + fakeCommentObjIdHex + `"}`,
+			expectedCode:     http.StatusCreated,
+		},
+		{
+			name:             "return-error",
+			collection:       "fakeOtherCol",
+			expectedResponse: `{"error":"dummy error"}`,
+			expectedCode:     http.StatusInternalServerError,
+		},
+		{
+			name:             "author-not-found",
+			collection:       fakeCommentCol,
+			authorCollection: "NoDocs",
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+		{
+			name:             "reply",
+			collection:       fakeCommentCol,
+			parentId:         fakeCommentObjIdHex,
+			expectedResponse: `{"InsertedID":"` + fakeCommentObjIdHex + `"}`,
+			expectedCode:     http.StatusCreated,
+		},
+		{
+			name:             "parent-not-found",
+			collection:       "NoDocs",
+			parentId:         fakeCommentObjIdHex,
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+		{
+			name:             "return-error-parent-on-another-post",
+			collection:       fakeCommentCol,
+			parentId:         fakeForeignCommentObjIdHex,
+			expectedResponse: `{"error":"parent comment belongs to another post"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "return-error-invalid-parent-hex-id",
+			collection:       fakeCommentCol,
+			parentId:         "12345",
+			expectedResponse: `{"error":"the provided hex string is not a valid ObjectID"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "pending-on-moderated-post",
+			collection:       fakeCommentCol,
+			postIdHex:        fakeModeratedObjIdHex,
+			expectedResponse: `{"InsertedID":"` + fakeCommentObjIdHex + `"}`,
+			expectedCode:     http.StatusAccepted,
+		},
+		{
+			name:             "pending-when-moderation-configured",
+			collection:       fakeCommentCol,
+			moderationMode:   "pre",
+			expectedResponse: `{"InsertedID":"` + fakeCommentObjIdHex + `"}`,
+			expectedCode:     http.StatusAccepted,
+		},
+		{
+			name:             "live-when-moderation-off",
+			collection:       fakeCommentCol,
+			moderationMode:   "off",
+			expectedResponse: `{"InsertedID":"` + fakeCommentObjIdHex + `"}`,
+			expectedCode:     http.StatusCreated,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			a := &App{cfg: &env.AppConfig{ModerationMode: st.moderationMode}}
+			if st.postIdHex == "" {
+				st.postIdHex = fakePostObjIdHex
+			}
+
+			router := mux.NewRouter()
+			subRouter := router.PathPrefix("/comment").Subrouter()
+
+			mockModels := NewMockModels()
+			mockModels.CColName = st.collection
+			mockModels.PColName = fakePostCol
+			if st.authorCollection != "" {
+				mockModels.AColName = st.authorCollection
+			}
+			subRouter.HandleFunc("/", a.handleCreateComment(mockModels, fakeDbName)).Methods(http.MethodPost)
+
+			w := httptest.NewRecorder()
+			jsonBody := strings.NewReader(`{"content":"fake content", "authorId":"` + fakeAuthorObjIdHex + `", "postId":"` + st.postIdHex + `", "parentId":"` + st.parentId + `"}`)
+			r, err := http.NewRequest(http.MethodPost, "/comment/", jsonBody)
+			router.ServeHTTP(w, r)
+
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedCode, w.Code)
+			}
+
+			b, err := io.ReadAll(w.Body)
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedResponse, strings.TrimSuffix(string(b), "\n"))
+			}
+		})
+	}
+}
+
+func TestHandleListPostComments(t *testing.T) {
+	subtests := []struct {
+		name             string
+		postCollection   string
+		collection       string
+		postIdHex        string
+		query            string
+		authorHeader     string
+		expectedResponse string
+		expectedCode     int
+	}{
+		{
+			name:             "happy-path",
+			postCollection:   fakePostCol,
+			collection:       fakeCommentCol,
+			postIdHex:        fakePostObjIdHex,
+			expectedResponse: `{"items":[{"id":"` + fakeCommentObjIdHex + `","content":"fake content","author":"fake author","postId":"` + fakePostObjIdHex + `"}]}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "newest-first",
+			postCollection:   fakePostCol,
+			collection:       fakeCommentCol,
+			postIdHex:        fakePostObjIdHex,
+			query:            "?sort=newest",
+			expectedResponse: `{"items":[{"id":"` + fakeCommentObjIdHex + `","content":"fake content","author":"fake author","postId":"` + fakePostObjIdHex + `"}],"next":"` + fakeCommentObjIdHex + `"}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "return-error",
+			postCollection:   fakePostCol,
+			collection:       "fakeOtherCol",
+			postIdHex:        fakePostObjIdHex,
+			expectedResponse: `{"error":"dummy error"}`,
+			expectedCode:     http.StatusInternalServerError,
+		},
+		{
+			name:             "post-not-found",
+			postCollection:   "NoDocs",
+			collection:       fakeCommentCol,
+			postIdHex:        fakePostObjIdHex,
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+		{
+			name:             "return-error-invalid-sort",
+			postCollection:   fakePostCol,
+			collection:       fakeCommentCol,
+			postIdHex:        fakePostObjIdHex,
+			query:            "?sort=random",
+			expectedResponse: `{"error":"invalid query: cannot sort by \"random\""}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "return-error-invalid-author-header",
+			postCollection:   fakePostCol,
+			collection:       fakeCommentCol,
+			postIdHex:        fakePostObjIdHex,
+			authorHeader:     "12345",
+			expectedResponse: `{"error":"the provided hex string is not a valid ObjectID"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "return-error-invalid-hex-id",
+			postCollection:   fakePostCol,
+			collection:       fakeCommentCol,
+			postIdHex:        "12345",
+			expectedResponse: `{"error":"the provided hex string is not a valid ObjectID"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "return-error-draft-read-anonymously",
+			postCollection:   fakePostCol,
+			collection:       fakeCommentCol,
+			postIdHex:        fakeDraftObjIdHex,
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			a := new(App)
+			router := mux.NewRouter()
+			subRouter := router.PathPrefix("/post").Subrouter()
+
+			mockModels := NewMockModels()
+			mockModels.CColName = st.collection
+			mockModels.PColName = st.postCollection
+			subRouter.HandleFunc("/{id:[a-z0-9]+}/comments", a.handleListPostComments(mockModels, fakeDbName)).Methods(http.MethodGet)
+
+			w := httptest.NewRecorder()
+			url := fmt.Sprintf("/post/%v/comments%v", st.postIdHex, st.query)
+			r, err := http.NewRequest(http.MethodGet, url, nil)
+			if st.authorHeader != "" {
+				r.Header.Set("X-Author-Id", st.authorHeader)
+			}
+			router.ServeHTTP(w, r)
+
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedCode, w.Code)
+			}
+
+			b, err := io.ReadAll(w.Body)
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedResponse, strings.TrimSuffix(string(b), "\n"))
+			}
+		})
+	}
+}
+
+func TestHandleGetCommentTree(t *testing.T) {
+	subtests := []struct {
+		name             string
+		postCollection   string
+		collection       string
+		query            string
+		postIdHex        string
+		authorHeader     string
+		expectedResponse string
+		expectedCode     int
+	}{
+		{
+			name:             "happy-path",
+			postCollection:   fakePostCol,
+			collection:       fakeCommentCol,
+			expectedResponse: `{"items":[{"id":"` + fakeCommentObjIdHex + `","content":"fake content","postId":"` + fakePostObjIdHex + `","replies":[{"id":"` + fakeReplyObjIdHex + `","content":"fake reply","postId":"` + fakePostObjIdHex + `","parentId":"` + fakeCommentObjIdHex + `","depth":1}]}]}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "root-comments-only",
+			postCollection:   fakePostCol,
+			collection:       fakeCommentCol,
+			query:            "?maxDepth=0",
+			expectedResponse: `{"items":[{"id":"` + fakeCommentObjIdHex + `","content":"fake content","postId":"` + fakePostObjIdHex + `"}]}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "return-error",
+			postCollection:   fakePostCol,
+			collection:       "fakeOtherCol",
+			expectedResponse: `{"error":"dummy error"}`,
+			expectedCode:     http.StatusInternalServerError,
+		},
+		{
+			name:             "post-not-found",
+			postCollection:   "NoDocs",
+			collection:       fakeCommentCol,
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+		{
+			name:             "return-error-invalid-max-depth",
+			postCollection:   fakePostCol,
+			collection:       fakeCommentCol,
+			query:            "?maxDepth=100",
+			expectedResponse: `{"error":"maxDepth must be a number between 0 and 20"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "return-error-draft-read-anonymously",
+			postCollection:   fakePostCol,
+			collection:       fakeCommentCol,
+			postIdHex:        fakeDraftObjIdHex,
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			if st.postIdHex == "" {
+				st.postIdHex = fakePostObjIdHex
+			}
+			a := new(App)
+			router := mux.NewRouter()
+			subRouter := router.PathPrefix("/post").Subrouter()
+
+			mockModels := NewMockModels()
+			mockModels.CColName = st.collection
+			mockModels.PColName = st.postCollection
+			subRouter.HandleFunc("/{id:[a-z0-9]+}/comments/tree", a.handleGetCommentTree(mockModels, fakeDbName)).Methods(http.MethodGet)
+
+			w := httptest.NewRecorder()
+			url := fmt.Sprintf("/post/%v/comments/tree%v", st.postIdHex, st.query)
+			r, err := http.NewRequest(http.MethodGet, url, nil)
+			if st.authorHeader != "" {
+				r.Header.Set("X-Author-Id", st.authorHeader)
+			}
+			router.ServeHTTP(w, r)
+
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedCode, w.Code)
+			}
+
+			b, err := io.ReadAll(w.Body)
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedResponse, strings.TrimSuffix(string(b), "\n"))
+			}
+		})
+	}
+}
+
+func TestHandleAddCommentReaction(t *testing.T) {
+	subtests := []struct {
+		name             string
+		collection       string
+		authorCollection string
+		body             string
+		expectedResponse string
+		expectedCode     int
+	}{
+		{
+			name:             "happy-path",
+			collection:       fakeCommentCol,
+			authorCollection: fakeAuthorCol,
+			body:             `{"type":"like","authorId":"` + fakeAuthorObjIdHex + `"}`,
+			expectedResponse: `{"msj":"reaction added"}`,
+			expectedCode:     http.StatusCreated,
+		},
+		{
+			name:             "return-error",
+			collection:       "fakeOtherCol",
+			authorCollection: fakeAuthorCol,
+			body:             `{"type":"like","authorId":"` + fakeAuthorObjIdHex + `"}`,
+			expectedResponse: `{"error":"dummy ReadComment error"}`,
+			expectedCode:     http.StatusInternalServerError,
+		},
+		{
+			name:             "comment-not-found",
+			collection:       "NoDocs",
+			authorCollection: fakeAuthorCol,
+			body:             `{"type":"like","authorId":"` + fakeAuthorObjIdHex + `"}`,
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+		{
+			name:             "author-not-found",
+			collection:       fakeCommentCol,
+			authorCollection: "NoDocs",
+			body:             `{"type":"like","authorId":"` + fakeAuthorObjIdHex + `"}`,
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+		{
+			name:             "already-reacted",
+			collection:       fakeCommentCol,
+			authorCollection: fakeAuthorCol,
+			body:             `{"type":"love","authorId":"` + fakeAuthorObjIdHex + `"}`,
+			expectedResponse: `{"error":"author already reacted with this type"}`,
+			expectedCode:     http.StatusConflict,
+		},
+		{
+			name:             "return-error-invalid-type",
+			collection:       fakeCommentCol,
+			authorCollection: fakeAuthorCol,
+			body:             `{"type":"meh","authorId":"` + fakeAuthorObjIdHex + `"}`,
+			expectedResponse: `{"error":"reaction type must be one of like, love, laugh, wow, sad, angry"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			a := new(App)
+			router := mux.NewRouter()
+			subRouter := router.PathPrefix("/comment").Subrouter()
+
+			mockModels := NewMockModels()
+			mockModels.CColName = st.collection
+			mockModels.AColName = st.authorCollection
+			subRouter.HandleFunc("/{id:[a-z0-9]+}/reactions", a.handleAddCommentReaction(mockModels, fakeDbName)).Methods(http.MethodPost)
+
+			w := httptest.NewRecorder()
+			r, err := http.NewRequest(http.MethodPost, "/comment/"+fakeCommentObjIdHex+"/reactions", strings.NewReader(st.body))
+			router.ServeHTTP(w, r)
+
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedCode, w.Code)
+			}
+
+			b, err := io.ReadAll(w.Body)
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedResponse, strings.TrimSuffix(string(b), "\n"))
+			}
+		})
+	}
+}
+
+func TestHandleRemoveCommentReaction(t *testing.T) {
+	subtests := []struct {
+		name             string
+		collection       string
+		query            string
+		expectedResponse string
+		expectedCode     int
+	}{
+		{
+			name:             "happy-path",
+			collection:       fakeCommentCol,
+			query:            "?type=love&authorId=" + fakeAuthorObjIdHex,
+			expectedResponse: `{"msj":"reaction removed"}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "return-error",
+			collection:       "fakeOtherCol",
+			query:            "?type=love&authorId=" + fakeAuthorObjIdHex,
+			expectedResponse: `{"error":"dummy error"}`,
+			expectedCode:     http.StatusInternalServerError,
+		},
+		{
+			name:             "reaction-not-found",
+			collection:       fakeCommentCol,
+			query:            "?type=like&authorId=" + fakeAuthorObjIdHex,
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+		{
+			name:             "return-error-invalid-type",
+			collection:       fakeCommentCol,
+			query:            "?type=meh&authorId=" + fakeAuthorObjIdHex,
+			expectedResponse: `{"error":"reaction type must be one of like, love, laugh, wow, sad, angry"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "return-error-invalid-author-id",
+			collection:       fakeCommentCol,
+			query:            "?type=love",
+			expectedResponse: `{"error":"the provided hex string is not a valid ObjectID"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			a := new(App)
+			router := mux.NewRouter()
+			subRouter := router.PathPrefix("/comment").Subrouter()
+			subRouter.HandleFunc("/{id:[a-z0-9]+}/reactions", a.handleRemoveCommentReaction(NewMockComment, fakeDbName, st.collection)).Methods(http.MethodDelete)
+
+			w := httptest.NewRecorder()
+			r, err := http.NewRequest(http.MethodDelete, "/comment/"+fakeCommentObjIdHex+"/reactions"+st.query, nil)
+			router.ServeHTTP(w, r)
+
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedCode, w.Code)
+			}
+
+			b, err := io.ReadAll(w.Body)
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedResponse, strings.TrimSuffix(string(b), "\n"))
+			}
+		})
+	}
+}
+
+func TestHandleGetComment(t *testing.T) {
+	subtests := []struct {
+		name             string
+		collection       string
+		commentIdHex     string
+		query            string
+		authorHeader     string
+		expectedResponse string
+		expectedCode     int
+	}{
+		{
+			name:             "happy-path",
+			collection:       fakeCommentCol,
+			commentIdHex:     fakeCommentObjIdHex,
+			expectedResponse: `{"id":"` + fakeCommentObjIdHex + `","content":"fake content","author":"fake author","postId":"` + fakePostObjIdHex + `","version":1}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "selected-fields",
+			collection:       fakeCommentCol,
+			commentIdHex:     fakeCommentObjIdHex,
+			query:            "?fields=postId,content",
+			expectedResponse: `{"id":"` + fakeCommentObjIdHex + `","content":"fake content","postId":"` + fakePostObjIdHex + `"}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "return-error-hidden-field",
+			collection:       fakeCommentCol,
+			commentIdHex:     fakeCommentObjIdHex,
+			query:            "?fields=ancestors",
+			expectedResponse: `{"error":"invalid query: unknown field \"ancestors\""}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "return-error",
+			collection:       "fakeOtherCol",
+			commentIdHex:     fakeCommentObjIdHex,
+			expectedResponse: `{"error":"dummy ReadComment error"}`,
+			expectedCode:     http.StatusInternalServerError,
+		},
+		{
+			name:             "return-error-no-docs",
+			collection:       "NoDocs",
+			commentIdHex:     fakeCommentObjIdHex,
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+		{
+			name:             "return-error-invalid-hex-id",
+			collection:       fakeCommentCol,
+			commentIdHex:     "12345",
+			expectedResponse: `{"error":"the provided hex string is not a valid ObjectID"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "pending-read-by-author",
+			collection:       fakeCommentCol,
+			commentIdHex:     fakePendingObjIdHex,
+			query:            "?fields=id,status",
+			authorHeader:     fakeAuthorObjIdHex,
+			expectedResponse: `{"id":"` + fakePendingObjIdHex + `","status":"pending"}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "return-error-pending-read-by-other-author",
+			collection:       fakeCommentCol,
+			commentIdHex:     fakePendingObjIdHex,
+			authorHeader:     fakeBusyAuthorObjIdHex,
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+		{
+			name:             "return-error-pending-read-anonymously",
+			collection:       fakeCommentCol,
+			commentIdHex:     fakePendingObjIdHex,
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+		{
+			name:             "return-error-invalid-author-header",
+			collection:       fakeCommentCol,
+			commentIdHex:     fakeCommentObjIdHex,
+			authorHeader:     "12345",
+			expectedResponse: `{"error":"the provided hex string is not a valid ObjectID"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			a := new(App)
+
+			router := mux.NewRouter()
+			subRouter := router.PathPrefix("/comment").Subrouter()
+
+			subRouter.HandleFunc("/{id:[a-z0-9]+}", a.handleGetComment(NewMockComment, fakeDbName, st.collection)).Methods(http.MethodGet)
+
+			w := httptest.NewRecorder()
+			r, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/comment/%v%v", st.commentIdHex, st.query), nil)
+			if st.authorHeader != "" {
+				r.Header.Set("X-Author-Id", st.authorHeader)
+			}
+			router.ServeHTTP(w, r)
+
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedCode, w.Code)
+				if st.expectedCode == http.StatusOK && strings.Contains(st.expectedResponse, `"version"`) {
+					assert.EqualValues(t, `"1"`, w.Header().Get("ETag"))
+				}
+			}
+
+			b, err := io.ReadAll(w.Body)
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedResponse, strings.TrimSuffix(string(b), "\n"))
+			}
+		})
+	}
+}
+
+func TestHandlePutComment(t *testing.T) {
+	subtests := []struct {
+		name             string
+		ifMatch          string
+		collection       string
+		commentIdHex     string
+		expectedResponse string
+		expectedCode     int
+	}{
+		{
+			name:             "happy-path",
+			collection:       fakeCommentCol,
+			commentIdHex:     fakeCommentObjIdHex,
+			expectedResponse: `{"msj":"comment updated"}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "return-error",
+			collection:       "fakeOtherCol",
+			commentIdHex:     fakeCommentObjIdHex,
+			expectedResponse: `{"error":"dummy ReadComment error"}`,
+			expectedCode:     http.StatusInternalServerError,
+		},
+		{
+			name:             "no-docs",
+			collection:       "NoDocs",
+			commentIdHex:     fakeCommentObjIdHex,
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+		{
+			name:             "return-error-invalid-hex-id",
+			collection:       "fakePostCol",
+			commentIdHex:     "12345",
+			expectedResponse: `{"error":"the provided hex string is not a valid ObjectID"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "if-match",
+			collection:       fakeCommentCol,
+			commentIdHex:     fakeCommentObjIdHex,
+			ifMatch:          `"1"`,
+			expectedResponse: `{"msj":"comment updated"}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "version-mismatch",
+			collection:       fakeCommentCol,
+			commentIdHex:     fakeCommentObjIdHex,
+			ifMatch:          `"2"`,
+			expectedResponse: `{"error":"document version mismatch"}`,
+			expectedCode:     http.StatusPreconditionFailed,
+		},
+		{
+			name:             "return-error-invalid-if-match",
+			collection:       fakeCommentCol,
+			commentIdHex:     fakeCommentObjIdHex,
+			ifMatch:          "1",
+			expectedResponse: `{"error":"If-Match must be * or a list of entity tags as returned in ETag"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			a := new(App)
+			router := mux.NewRouter()
+			subRouter := router.PathPrefix("/comment").Subrouter()
+			subRouter.HandleFunc("/{id:[a-z0-9]+}", a.handlePutComment(NewMockComment, fakeDbName, st.collection)).Methods(http.MethodPut)
+
+			w := httptest.NewRecorder()
+			jsonBody := strings.NewReader(`{"content":"updated fake comment content"}`)
+			url := fmt.Sprintf("/comment/%v", st.commentIdHex)
+			r, err := http.NewRequest(http.MethodPut, url, jsonBody)
+			if st.ifMatch != "" {
+				r.Header.Set("If-Match", st.ifMatch)
+			}
+			router.ServeHTTP(w, r)
+
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedCode, w.Code)
+			}
+
+			b, err := io.ReadAll(w.Body)
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedResponse, strings.TrimSuffix(string(b), "\n"))
+			}
+		})
+	}
+}
+
+func TestHandlePatchComment(t *testing.T) {
+	subtests := []struct {
+		name             string
+		ifMatch          string
+		collection       string
+		commentIdHex     string
+		contentType      string
+		body             string
+		expectedResponse string
+		expectedCode     int
+	}{
+		{
+			name:             "happy-path",
+			collection:       fakeCommentCol,
+			commentIdHex:     fakeCommentObjIdHex,
+			contentType:      "application/merge-patch+json",
+			body:             `{"content":"patched fake content"}`,
+			expectedResponse: `{"msj":"comment updated"}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "return-error",
+			collection:       "fakeOtherCol",
+			commentIdHex:     fakeCommentObjIdHex,
+			contentType:      "application/merge-patch+json",
+			body:             `{"content":"patched fake content"}`,
+			expectedResponse: `{"error":"dummy ReadComment error"}`,
+			expectedCode:     http.StatusInternalServerError,
+		},
+		{
+			name:             "no-docs",
+			collection:       "NoDocs",
+			commentIdHex:     fakeCommentObjIdHex,
+			contentType:      "application/merge-patch+json",
+			body:             `{"content":"patched fake content"}`,
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+		{
+			name:             "return-error-read-only-field",
+			collection:       fakeCommentCol,
+			commentIdHex:     fakeCommentObjIdHex,
+			contentType:      "application/merge-patch+json",
+			body:             `{"id":"` + fakeCommentObjIdHex + `"}`,
+			expectedResponse: `{"error":"invalid merge patch: field \"id\" cannot be patched"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "return-error-not-an-object",
+			collection:       fakeCommentCol,
+			commentIdHex:     fakeCommentObjIdHex,
+			contentType:      "application/merge-patch+json",
+			body:             `null`,
+			expectedResponse: `{"error":"merge patch must be a json object"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "return-error-content-type",
+			collection:       fakeCommentCol,
+			commentIdHex:     fakeCommentObjIdHex,
+			contentType:      "application/json",
+			body:             `{"content":"patched fake content"}`,
+			expectedResponse: `{"error":"content type must be application/merge-patch+json"}`,
+			expectedCode:     http.StatusUnsupportedMediaType,
+		},
+		{
+			name:             "return-error-invalid-hex-id",
+			collection:       fakeCommentCol,
+			commentIdHex:     "12345",
+			contentType:      "application/merge-patch+json",
+			body:             `{"content":"patched fake content"}`,
+			expectedResponse: `{"error":"the provided hex string is not a valid ObjectID"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "if-match",
+			collection:       fakeCommentCol,
+			contentType:      "application/merge-patch+json",
+			body:             `{"content":"patched fake content"}`,
+			commentIdHex:     fakeCommentObjIdHex,
+			ifMatch:          `"1"`,
+			expectedResponse: `{"msj":"comment updated"}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "version-mismatch",
+			collection:       fakeCommentCol,
+			contentType:      "application/merge-patch+json",
+			body:             `{"content":"patched fake content"}`,
+			commentIdHex:     fakeCommentObjIdHex,
+			ifMatch:          `"2"`,
+			expectedResponse: `{"error":"document version mismatch"}`,
+			expectedCode:     http.StatusPreconditionFailed,
+		},
+		{
+			name:             "return-error-invalid-if-match",
+			collection:       fakeCommentCol,
+			contentType:      "application/merge-patch+json",
+			body:             `{"content":"patched fake content"}`,
+			commentIdHex:     fakeCommentObjIdHex,
+			ifMatch:          "1",
+			expectedResponse: `{"error":"If-Match must be * or a list of entity tags as returned in ETag"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			a := new(App)
+			router := mux.NewRouter()
+			subRouter := router.PathPrefix("/comment").Subrouter()
+			subRouter.HandleFunc("/{id:[a-z0-9]+}", a.handlePatchComment(NewMockComment, fakeDbName, st.collection)).Methods(http.MethodPatch)
+
+			w := httptest.NewRecorder()
+			url := fmt.Sprintf("/comment/%v", st.commentIdHex)
+			r, err := http.NewRequest(http.MethodPatch, url, strings.NewReader(st.body))
+			r.Header.Set("Content-Type", st.contentType)
+			if st.ifMatch != "" {
+				r.Header.Set("If-Match", st.ifMatch)
+			}
+			router.ServeHTTP(w, r)
+
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedCode, w.Code)
+			}
+
+			b, err := io.ReadAll(w.Body)
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedResponse, strings.TrimSuffix(string(b), "\n"))
+			}
+		})
+	}
+}
+
+func TestHandleDeleteComment(t *testing.T) {
+	subtests := []struct {
+		name             string
+		ifMatch          string
+		collection       string
+		commentIdHex     string
+		expectedResponse string
+		expectedCode     int
+	}{
+		{
+			name:             "happy-path",
+			collection:       fakeCommentCol,
+			commentIdHex:     fakeCommentObjIdHex,
+			expectedResponse: `{"msj":"comment deleted"}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "return-error",
+			collection:       "fakeOtherCol",
+			commentIdHex:     fakeCommentObjIdHex,
+			expectedResponse: `{"error":"dummy ReadComment error"}`,
+			expectedCode:     http.StatusInternalServerError,
+		},
+		{
+			name:             "no-docs",
+			collection:       "NoDocs",
+			commentIdHex:     fakeCommentObjIdHex,
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+		{
+			name:             "return-error-invalid-hex-id",
+			collection:       fakeCommentCol,
+			commentIdHex:     "12345",
+			expectedResponse: `{"error":"the provided hex string is not a valid ObjectID"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "if-match",
+			collection:       fakeCommentCol,
+			commentIdHex:     fakeCommentObjIdHex,
+			ifMatch:          `"1"`,
+			expectedResponse: `{"msj":"comment deleted"}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "version-mismatch",
+			collection:       fakeCommentCol,
+			commentIdHex:     fakeCommentObjIdHex,
+			ifMatch:          `"2"`,
+			expectedResponse: `{"error":"document version mismatch"}`,
+			expectedCode:     http.StatusPreconditionFailed,
+		},
+		{
+			name:             "return-error-invalid-if-match",
+			collection:       fakeCommentCol,
+			commentIdHex:     fakeCommentObjIdHex,
+			ifMatch:          "1",
+			expectedResponse: `{"error":"If-Match must be * or a list of entity tags as returned in ETag"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			a := new(App)
+			router := mux.NewRouter()
+			subRouter := router.PathPrefix("/comment").Subrouter()
+
+			mockModels := NewMockModels()
+			mockModels.CColName = st.collection
+			subRouter.HandleFunc("/{id:[a-z0-9]+}", a.handleDeleteComment(mockModels, fakeDbName)).Methods(http.MethodDelete)
+
+			w := httptest.NewRecorder()
+			url := fmt.Sprintf("/comment/%v", st.commentIdHex)
+			r, err := http.NewRequest(http.MethodDelete, url, nil)
+			if st.ifMatch != "" {
+				r.Header.Set("If-Match", st.ifMatch)
+			}
+			router.ServeHTTP(w, r)
+
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedCode, w.Code)
+			}
+
+			b, err := io.ReadAll(w.Body)
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedResponse, strings.TrimSuffix(string(b), "\n"))
+			}
+		})
+	}
+}
+
+func TestHandleBulkCreateComments(t *testing.T) {
+	created := `{"id":"` + fakeCommentObjIdHex + `","status":201}`
+	skipped := `{"status":424,"error":"skipped after an earlier item failed"}`
+	comment := func(postIdHex, parentIdHex string) string {
+		return `{"content":"fake content","postId":"` + postIdHex + `","authorId":"` + fakeAuthorObjIdHex + `","parentId":"` + parentIdHex + `"}`
+	}
+	subtests := []struct {
+		name             string
+		collection       string
+		query            string
+		body             string
+		expectedResponse string
+		expectedCode     int
+	}{
+		{
+			name:             "happy-path",
+			collection:       fakeCommentCol,
+			body:             `[` + comment(fakePostObjIdHex, "") + `,` + comment(fakePostObjIdHex, fakeCommentObjIdHex) + `]`,
+			expectedResponse: `{"errors":false,"items":[` + created + `,` + created + `]}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "ordered-skips-after-failure",
+			collection:       fakeCommentCol,
+			body:             `[` + comment(fakeMissingObjIdHex, "") + `,` + comment(fakePostObjIdHex, "") + `]`,
+			expectedResponse: `{"errors":true,"items":[{"status":404,"error":"not found post with id: ` + fakeMissingObjIdHex + `"},` + skipped + `]}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "unordered-goes-on-after-failure",
+			collection:       fakeCommentCol,
+			query:            "?ordered=false",
+			body:             `[` + comment(fakePostObjIdHex, fakeForeignCommentObjIdHex) + `,{"content":"` + fakeDuplicateContent + `","postId":"` + fakePostObjIdHex + `","authorId":"` + fakeAuthorObjIdHex + `"},` + comment(fakePostObjIdHex, "") + `]`,
+			expectedResponse: `{"errors":true,"items":[{"status":400,"error":"parent comment belongs to another post"},{"status":409,"error":"write exception: write errors: [E11000 duplicate key error]"},` + created + `]}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "return-error",
+			collection:       "fakeOtherCol",
+			body:             `[` + comment(fakePostObjIdHex, "") + `]`,
+			expectedResponse: `{"error":"dummy error"}`,
+			expectedCode:     http.StatusInternalServerError,
+		},
+		{
+			name:             "return-error-invalid-body",
+			collection:       fakeCommentCol,
+			body:             comment(fakePostObjIdHex, ""),
+			expectedResponse: `{"error":"json: cannot unmarshal object into Go value of type []*models.CommentDoc"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			a := new(App)
+			router := mux.NewRouter()
+			subRouter := router.PathPrefix("/comment").Subrouter()
+
+			mockModels := NewMockModels()
+			mockModels.PColName = fakePostCol
+			mockModels.CColName = st.collection
+			subRouter.HandleFunc("/_bulk", a.handleBulkCreateComments(mockModels, fakeDbName)).Methods(http.MethodPost)
+
+			w := httptest.NewRecorder()
+			r, err := http.NewRequest(http.MethodPost, "/comment/_bulk"+st.query, strings.NewReader(st.body))
+			router.ServeHTTP(w, r)
+
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedCode, w.Code)
+			}
+
+			b, err := io.ReadAll(w.Body)
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedResponse, strings.TrimSuffix(string(b), "\n"))
+			}
+		})
+	}
+}
+
+func TestHandleBulkDeleteComments(t *testing.T) {
+	deleted := `{"id":"` + fakeCommentObjIdHex + `","status":200}`
+	subtests := []struct {
+		name             string
+		collection       string
+		query            string
+		body             string
+		expectedResponse string
+		expectedCode     int
+	}{
+		{
+			name:             "happy-path",
+			collection:       fakeCommentCol,
+			body:             `["` + fakeCommentObjIdHex + `"]`,
+			expectedResponse: `{"errors":false,"items":[` + deleted + `]}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "ordered-skips-after-failure",
+			collection:       fakeCommentCol,
+			body:             `["` + fakeCommentObjIdHex + `","` + fakeMissingObjIdHex + `","` + fakeCommentObjIdHex + `"]`,
+			expectedResponse: `{"errors":true,"items":[` + deleted + `,{"status":404,"error":"mongo: no documents in result"},{"status":424,"error":"skipped after an earlier item failed"}]}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "unordered-goes-on-after-failure",
+			collection:       fakeCommentCol,
+			query:            "?ordered=false",
+			body:             `["12345","` + fakeCommentObjIdHex + `"]`,
+			expectedResponse: `{"errors":true,"items":[{"status":400,"error":"invalid comment id: the provided hex string is not a valid ObjectID"},` + deleted + `]}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "return-error",
+			collection:       "fakeOtherCol",
+			body:             `["` + fakeCommentObjIdHex + `"]`,
+			expectedResponse: `{"error":"dummy error"}`,
+			expectedCode:     http.StatusInternalServerError,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			a := new(App)
+			router := mux.NewRouter()
+			subRouter := router.PathPrefix("/comment").Subrouter()
+
+			mockModels := NewMockModels()
+			mockModels.CColName = st.collection
+			subRouter.HandleFunc("/_bulk/delete", a.handleBulkDeleteComments(mockModels, fakeDbName)).Methods(http.MethodPost)
+
+			w := httptest.NewRecorder()
+			r, err := http.NewRequest(http.MethodPost, "/comment/_bulk/delete"+st.query, strings.NewReader(st.body))
+			router.ServeHTTP(w, r)
+
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedCode, w.Code)
+			}
+
+			b, err := io.ReadAll(w.Body)
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedResponse, strings.TrimSuffix(string(b), "\n"))
+			}
+		})
+	}
+}
+
+func TestHandleListModerationQueue(t *testing.T) {
+	subtests := []struct {
+		name             string
+		collection       string
+		query            string
+		expectedResponse string
+		expectedCode     int
+	}{
+		{
+			name:             "happy-path",
+			collection:       fakeCommentCol,
+			expectedResponse: `{"items":[{"id":"` + fakePendingObjIdHex + `","content":"fake content","author":"fake author","postId":"` + fakePostObjIdHex + `","status":"pending"}]}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "rejected",
+			collection:       fakeCommentCol,
+			query:            "?status=rejected",
+			expectedResponse: `{"items":[{"id":"` + fakePendingObjIdHex + `","content":"fake content","author":"fake author","postId":"` + fakePostObjIdHex + `","status":"rejected"}]}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "next-page",
+			collection:       fakeCommentCol,
+			query:            "?cursor=" + fakePendingObjIdHex,
+			expectedResponse: `{"items":[]}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "return-error-invalid-status",
+			collection:       fakeCommentCol,
+			query:            "?status=approved",
+			expectedResponse: `{"error":"status must be one of pending, rejected"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "return-error",
+			collection:       "fakeOtherCol",
+			expectedResponse: `{"error":"dummy error"}`,
+			expectedCode:     http.StatusInternalServerError,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			a := new(App)
+
+			router := mux.NewRouter()
+			subRouter := router.PathPrefix("/moderation").Subrouter()
+
+			subRouter.HandleFunc("/comments", a.handleListModerationQueue(NewMockComment, fakeDbName, st.collection)).Methods(http.MethodGet)
+
+			w := httptest.NewRecorder()
+			r, err := http.NewRequest(http.MethodGet, "/moderation/comments"+st.query, nil)
+			router.ServeHTTP(w, r)
+
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedCode, w.Code)
+			}
+
+			b, err := io.ReadAll(w.Body)
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedResponse, strings.TrimSuffix(string(b), "\n"))
+			}
+		})
+	}
+}
+
+func TestHandleModerateComment(t *testing.T) {
+	subtests := []struct {
+		name             string
+		collection       string
+		commentIdHex     string
+		action           string
+		body             string
+		expectedResponse string
+		expectedCode     int
+	}{
+		{
+			name:             "approve",
+			collection:       fakeCommentCol,
+			commentIdHex:     fakePendingObjIdHex,
+			action:           "approve",
+			expectedResponse: `{"msj":"comment approved"}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "approve-with-reason",
+			collection:       fakeCommentCol,
+			commentIdHex:     fakePendingObjIdHex,
+			action:           "approve",
+			body:             `{"reason":"on topic"}`,
+			expectedResponse: `{"msj":"comment approved"}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "reject",
+			collection:       fakeCommentCol,
+			commentIdHex:     fakePendingObjIdHex,
+			action:           "reject",
+			body:             `{"reason":"spam"}`,
+			expectedResponse: `{"msj":"comment rejected"}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "return-error-reject-without-reason",
+			collection:       fakeCommentCol,
+			commentIdHex:     fakePendingObjIdHex,
+			action:           "reject",
+			body:             `{"reason":"  "}`,
+			expectedResponse: `{"error":"rejecting a comment takes a reason"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "return-error-bad-body",
+			collection:       fakeCommentCol,
+			commentIdHex:     fakePendingObjIdHex,
+			action:           "reject",
+			body:             `{"reason":`,
+			expectedResponse: `{"error":"unexpected EOF"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "return-error-no-docs",
+			collection:       fakeCommentCol,
+			commentIdHex:     fakeMissingObjIdHex,
+			action:           "approve",
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+		{
+			name:             "return-error",
+			collection:       "fakeOtherCol",
+			commentIdHex:     fakePendingObjIdHex,
+			action:           "approve",
+			expectedResponse: `{"error":"dummy error"}`,
+			expectedCode:     http.StatusInternalServerError,
+		},
+		{
+			name:             "return-error-invalid-hex-id",
+			collection:       fakeCommentCol,
+			commentIdHex:     "12345",
+			action:           "approve",
+			expectedResponse: `{"error":"the provided hex string is not a valid ObjectID"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			a := new(App)
+
+			router := mux.NewRouter()
+			subRouter := router.PathPrefix("/moderation").Subrouter()
+
+			mockModels := NewMockModels()
+			mockModels.CColName = st.collection
+			subRouter.HandleFunc("/comments/{id:[a-z0-9]+}/approve", a.handleModerateComment(mockModels, fakeDbName, appDb.CommentApproved)).Methods(http.MethodPost)
+			subRouter.HandleFunc("/comments/{id:[a-z0-9]+}/reject", a.handleModerateComment(mockModels, fakeDbName, appDb.CommentRejected)).Methods(http.MethodPost)
+
+			w := httptest.NewRecorder()
+			url := fmt.Sprintf("/moderation/comments/%v/%v", st.commentIdHex, st.action)
+			r, err := http.NewRequest(http.MethodPost, url, strings.NewReader(st.body))
+			router.ServeHTTP(w, r)
+
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedCode, w.Code)
+			}
+
+			b, err := io.ReadAll(w.Body)
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedResponse, strings.TrimSuffix(string(b), "\n"))
+			}
+		})
+	}
+}
+
+func TestRequireModerator(t *testing.T) {
+	subtests := []struct {
+		name          string
+		token         string
+		authorization string
+		expectedCode  int
+	}{
+		{
+			name:          "happy-path",
+			token:         fakeModeratorToken,
+			authorization: "Bearer " + fakeModeratorToken,
+			expectedCode:  http.StatusOK,
+		},
+		{
+			name:          "return-error-wrong-token",
+			token:         fakeModeratorToken,
+			authorization: "Bearer other token",
+			expectedCode:  http.StatusUnauthorized,
+		},
+		{
+			name:          "return-error-not-bearer",
+			token:         fakeModeratorToken,
+			authorization: fakeModeratorToken,
+			expectedCode:  http.StatusUnauthorized,
+		},
+		{
+			name:         "return-error-no-token",
+			token:        fakeModeratorToken,
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:          "return-error-moderation-disabled",
+			authorization: "Bearer ",
+			expectedCode:  http.StatusForbidden,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			h := requireModerator(st.token)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			w := httptest.NewRecorder()
+			r, err := http.NewRequest(http.MethodGet, "/moderation/comments", nil)
+			if st.authorization != "" {
+				r.Header.Set("Authorization", st.authorization)
+			}
+			h.ServeHTTP(w, r)
+
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedCode, w.Code)
+			}
+		})
+	}
+}
+
+// TestAdminRoutes checks the admin endpoints the app serves refuse requests without the admin token
+func TestAdminRoutes(t *testing.T) {
+	subtests := []struct {
+		name          string
+		method        string
+		path          string
+		token         string
+		authorization string
+		expectedCode  int
+	}{
+		{
+			name:         "return-error-export-without-token",
+			method:       http.MethodGet,
+			path:         "/admin/export",
+			token:        fakeAdminToken,
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "return-error-import-without-token",
+			method:       http.MethodPost,
+			path:         "/admin/import?mode=upsert",
+			token:        fakeAdminToken,
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:          "return-error-export-wrong-token",
+			method:        http.MethodGet,
+			path:          "/admin/export",
+			token:         fakeAdminToken,
+			authorization: "Bearer " + fakeModeratorToken,
+			expectedCode:  http.StatusUnauthorized,
+		},
+		{
+			name:          "return-error-import-moderator-token",
+			method:        http.MethodPost,
+			path:          "/admin/import",
+			token:         fakeAdminToken,
+			authorization: "Bearer " + fakeModeratorToken,
+			expectedCode:  http.StatusUnauthorized,
+		},
+		{
+			name:          "return-error-admin-disabled",
+			method:        http.MethodGet,
+			path:          "/admin/export",
+			authorization: "Bearer ",
+			expectedCode:  http.StatusForbidden,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			a := &App{cfg: &env.AppConfig{AdminToken: st.token, ModeratorToken: fakeModeratorToken}}
+
+			w := httptest.NewRecorder()
+			r, err := http.NewRequest(st.method, st.path, strings.NewReader(""))
+			if st.authorization != "" {
+				r.Header.Set("Authorization", st.authorization)
+			}
+			a.routes().ServeHTTP(w, r)
+
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedCode, w.Code)
+			}
+		})
+	}
+}
+
+func TestHandleCreateAuthor(t *testing.T) {
+	subtests := []struct {
+		name             string
+		collection       string
+		body             string
+		expectedResponse string
+		expectedCode     int
+	}{
+		{
+			name:             "happy-path",
+			collection:       fakeAuthorCol,
+			body:             `{"name":"fake author"}`,
+			expectedResponse: `{"InsertedID":"` + fakeAuthorObjIdHex + `"}`,
+			expectedCode:     http.StatusCreated,
+		},
+		{
+			name:             "return-error",
+			collection:       "fakeOtherCol",
+			body:             `{"name":"fake author"}`,
+			expectedResponse: `{"error":"dummy error"}`,
+			expectedCode:     http.StatusInternalServerError,
+		},
+		{
+			name:             "return-error-missing-name",
+			collection:       fakeAuthorCol,
+			body:             `{}`,
+			expectedResponse: `{"error":"author name is required"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "return-error-taken-name",
+			collection:       fakeAuthorCol,
+			body:             `{"name":"` + fakeTakenAuthorName + `"}`,
+			expectedResponse: `{"error":"write exception: write errors: [E11000 duplicate key error]"}`,
+			expectedCode:     http.StatusConflict,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			a := new(App)
+			router := mux.NewRouter()
+			subRouter := router.PathPrefix("/author").Subrouter()
+			subRouter.HandleFunc("/", a.handleCreateAuthor(NewMockAuthor, fakeDbName, st.collection)).Methods(http.MethodPost)
+
+			w := httptest.NewRecorder()
+			r, err := http.NewRequest(http.MethodPost, "/author/", strings.NewReader(st.body))
+			router.ServeHTTP(w, r)
+
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedCode, w.Code)
+			}
+
+			b, err := io.ReadAll(w.Body)
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedResponse, strings.TrimSuffix(string(b), "\n"))
+			}
+		})
+	}
+}
+
+func TestHandleGetAuthor(t *testing.T) {
+	subtests := []struct {
+		name             string
+		collection       string
+		authorIdHex      string
+		expectedResponse string
+		expectedCode     int
+	}{
+		{
+			name:             "happy-path",
+			collection:       fakeAuthorCol,
+			authorIdHex:      fakeAuthorObjIdHex,
+			expectedResponse: `{"id":"` + fakeAuthorObjIdHex + `","name":"fake author","version":1}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "return-error",
+			collection:       "fakeOtherCol",
+			authorIdHex:      fakeAuthorObjIdHex,
+			expectedResponse: `{"error":"dummy error"}`,
+			expectedCode:     http.StatusInternalServerError,
+		},
+		{
+			name:             "return-error-no-docs",
+			collection:       "NoDocs",
+			authorIdHex:      fakeAuthorObjIdHex,
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
+		{
+			name:             "return-error-invalid-hex-id",
+			collection:       fakeAuthorCol,
+			authorIdHex:      "12345",
+			expectedResponse: `{"error":"the provided hex string is not a valid ObjectID"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			a := new(App)
+			router := mux.NewRouter()
+			subRouter := router.PathPrefix("/author").Subrouter()
+			subRouter.HandleFunc("/{id:[a-z0-9]+}", a.handleGetAuthor(NewMockAuthor, fakeDbName, st.collection)).Methods(http.MethodGet)
+
+			w := httptest.NewRecorder()
+			r, err := http.NewRequest(http.MethodGet, "/author/"+st.authorIdHex, nil)
+			router.ServeHTTP(w, r)
+
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedCode, w.Code)
+				if st.expectedCode == http.StatusOK {
+					assert.EqualValues(t, `"1"`, w.Header().Get("ETag"))
+				}
+			}
+
+			b, err := io.ReadAll(w.Body)
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedResponse, strings.TrimSuffix(string(b), "\n"))
+			}
+		})
+	}
+}
+
+func TestHandleListAuthors(t *testing.T) {
+	subtests := []struct {
+		name             string
+		collection       string
+		query            string
+		expectedResponse string
+		expectedCode     int
+	}{
+		{
+			name:             "happy-path",
+			collection:       fakeAuthorCol,
+			expectedResponse: `{"items":[{"id":"` + fakeAuthorObjIdHex + `","name":"fake author"}]}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "next-cursor",
+			collection:       fakeAuthorCol,
+			query:            "?limit=1",
+			expectedResponse: `{"items":[{"id":"` + fakeAuthorObjIdHex + `","name":"fake author"}],"next":"` + fakeAuthorObjIdHex + `"}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "return-error",
+			collection:       "fakeOtherCol",
+			expectedResponse: `{"error":"dummy error"}`,
+			expectedCode:     http.StatusInternalServerError,
+		},
+		{
+			name:             "return-error-invalid-limit",
+			collection:       fakeAuthorCol,
+			query:            "?limit=0",
+			expectedResponse: `{"error":"limit must be a number between 1 and 100"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			a := new(App)
+			router := mux.NewRouter()
+			subRouter := router.PathPrefix("/author").Subrouter()
+			subRouter.HandleFunc("/", a.handleListAuthors(NewMockAuthor, fakeDbName, st.collection)).Methods(http.MethodGet)
+
+			w := httptest.NewRecorder()
+			r, err := http.NewRequest(http.MethodGet, "/author/"+st.query, nil)
+			router.ServeHTTP(w, r)
+
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedCode, w.Code)
+			}
+
+			b, err := io.ReadAll(w.Body)
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, st.expectedResponse, strings.TrimSuffix(string(b), "\n"))
+			}
+		})
+	}
+}
+
+func TestHandlePutAuthor(t *testing.T) {
+	subtests := []struct {
+		name             string
+		ifMatch          string
+		collection       string
+		postCollection   string
+		body             string
+		expectedResponse string
+		expectedCode     int
+	}{
+		{
+			name:             "happy-path",
+			collection:       fakeAuthorCol,
+			postCollection:   fakePostCol,
+			body:             `{"name":"renamed author"}`,
+			expectedResponse: `{"msj":"author updated"}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "return-error",
+			collection:       fakeAuthorCol,
+			postCollection:   "fakeOtherCol",
+			body:             `{"name":"renamed author"}`,
+			expectedResponse: `{"error":"dummy error"}`,
+			expectedCode:     http.StatusInternalServerError,
+		},
+		{
+			name:             "no-docs",
+			collection:       "NoDocs",
+			postCollection:   fakePostCol,
+			body:             `{"name":"renamed author"}`,
 			expectedResponse: `{"error":"mongo: no documents in result"}`,
 			expectedCode:     http.StatusNotFound,
 		},
 		{
-			name:             "return-error-invalid-hex-id",
-			collection:       "fakePostCol",
-			postIdHex:        "12345",
-			expectedResponse: `{"error":"the provided hex string is not a valid ObjectID"}`,
+			name:             "return-error-missing-name",
+			collection:       fakeAuthorCol,
+			postCollection:   fakePostCol,
+			body:             `{}`,
+			expectedResponse: `{"error":"author name is required"}`,
 			expectedCode:     http.StatusBadRequest,
 		},
+		{
+			name:             "return-error-taken-name",
+			collection:       fakeAuthorCol,
+			postCollection:   fakePostCol,
+			body:             `{"name":"` + fakeTakenAuthorName + `"}`,
+			expectedResponse: `{"error":"write exception: write errors: [E11000 duplicate key error]"}`,
+			expectedCode:     http.StatusConflict,
+		},
+		{
+			name:             "version-mismatch",
+			collection:       fakeAuthorCol,
+			postCollection:   fakePostCol,
+			ifMatch:          `"2"`,
+			body:             `{"name":"renamed author"}`,
+			expectedResponse: `{"error":"document version mismatch"}`,
+			expectedCode:     http.StatusPreconditionFailed,
+		},
 	}
 
 	for _, st := range subtests {
 		t.Run(st.name, func(t *testing.T) {
 			a := new(App)
 			router := mux.NewRouter()
-			subRouter := router.PathPrefix("/post").Subrouter()
+			subRouter := router.PathPrefix("/author").Subrouter()
 
-			subRouter.HandleFunc("/{id:[a-z0-9]+}", a.handleGetPost(new(MockPost), "fakeDb", st.collection)).Methods(http.MethodGet)
+			mockModels := NewMockModels()
+			mockModels.AColName = st.collection
+			mockModels.PColName = st.postCollection
+			mockModels.CColName = fakeCommentCol
+			subRouter.HandleFunc("/{id:[a-z0-9]+}", a.handlePutAuthor(mockModels, fakeDbName)).Methods(http.MethodPut)
 
 			w := httptest.NewRecorder()
-			url := fmt.Sprintf("/post/%v", st.postIdHex)
-			r, err := http.NewRequest(http.MethodGet, url, nil)
+			r, err := http.NewRequest(http.MethodPut, "/author/"+fakeAuthorObjIdHex, strings.NewReader(st.body))
+			if st.ifMatch != "" {
+				r.Header.Set("If-Match", st.ifMatch)
+			}
 			router.ServeHTTP(w, r)
 
 			if assert.NoError(t, err) {
@@ -120,39 +3651,55 @@ func TestHandleGetPost(t *testing.T) {
 	}
 }
 
-func TestHandlePutPost(t *testing.T) {
+func TestHandleDeleteAuthor(t *testing.T) {
 	subtests := []struct {
 		name             string
+		ifMatch          string
 		collection       string
-		postIdHex        string
+		authorIdHex      string
 		expectedResponse string
 		expectedCode     int
 	}{
 		{
 			name:             "happy-path",
-			collection:       fakePostCol,
-			postIdHex:        fakePostObjIdHex,
-			expectedResponse: `{"msj":"post updated"}`,
+			collection:       fakeAuthorCol,
+			authorIdHex:      fakeAuthorObjIdHex,
+			expectedResponse: `{"msj":"author deleted"}`,
 			expectedCode:     http.StatusOK,
 		},
 		{
 			name:             "return-error",
 			collection:       "fakeOtherCol",
-			postIdHex:        fakePostObjIdHex,
+			authorIdHex:      fakeAuthorObjIdHex,
 			expectedResponse: `{"error":"dummy error"}`,
 			expectedCode:     http.StatusInternalServerError,
 		},
 		{
 			name:             "no-docs",
 			collection:       "NoDocs",
-			postIdHex:        fakePostObjIdHex,
+			authorIdHex:      fakeAuthorObjIdHex,
 			expectedResponse: `{"error":"mongo: no documents in result"}`,
 			expectedCode:     http.StatusNotFound,
 		},
+		{
+			name:             "author-in-use",
+			collection:       fakeAuthorCol,
+			authorIdHex:      fakeBusyAuthorObjIdHex,
+			expectedResponse: `{"error":"author has posts or comments"}`,
+			expectedCode:     http.StatusConflict,
+		},
+		{
+			name:             "version-mismatch",
+			collection:       fakeAuthorCol,
+			authorIdHex:      fakeAuthorObjIdHex,
+			ifMatch:          `"2"`,
+			expectedResponse: `{"error":"document version mismatch"}`,
+			expectedCode:     http.StatusPreconditionFailed,
+		},
 		{
 			name:             "return-error-invalid-hex-id",
-			collection:       fakePostCol,
-			postIdHex:        "12345",
+			collection:       fakeAuthorCol,
+			authorIdHex:      "12345",
 			expectedResponse: `{"error":"the provided hex string is not a valid ObjectID"}`,
 			expectedCode:     http.StatusBadRequest,
 		},
@@ -162,13 +3709,19 @@ func TestHandlePutPost(t *testing.T) {
 		t.Run(st.name, func(t *testing.T) {
 			a := new(App)
 			router := mux.NewRouter()
-			subRouter := router.PathPrefix("/post").Subrouter()
-			subRouter.HandleFunc("/{id:[a-z0-9]+}", a.handlePutPost(new(MockPost), "fakeDb", st.collection)).Methods(http.MethodPut)
+			subRouter := router.PathPrefix("/author").Subrouter()
+
+			mockModels := NewMockModels()
+			mockModels.AColName = st.collection
+			mockModels.PColName = fakePostCol
+			mockModels.CColName = fakeCommentCol
+			subRouter.HandleFunc("/{id:[a-z0-9]+}", a.handleDeleteAuthor(mockModels, fakeDbName)).Methods(http.MethodDelete)
 
 			w := httptest.NewRecorder()
-			jsonBody := strings.NewReader(`{"content":"updated fake content", "author":"fake author"}`)
-			url := fmt.Sprintf("/post/%v", st.postIdHex)
-			r, err := http.NewRequest(http.MethodPut, url, jsonBody)
+			r, err := http.NewRequest(http.MethodDelete, "/author/"+st.authorIdHex, nil)
+			if st.ifMatch != "" {
+				r.Header.Set("If-Match", st.ifMatch)
+			}
 			router.ServeHTTP(w, r)
 
 			if assert.NoError(t, err) {
@@ -183,55 +3736,50 @@ func TestHandlePutPost(t *testing.T) {
 	}
 }
 
-func TestHandleDeletePost(t *testing.T) {
+func TestHandleListAuthorPosts(t *testing.T) {
 	subtests := []struct {
 		name             string
+		authorCollection string
 		collection       string
-		postIdHex        string
 		expectedResponse string
 		expectedCode     int
 	}{
 		{
 			name:             "happy-path",
+			authorCollection: fakeAuthorCol,
 			collection:       fakePostCol,
-			postIdHex:        fakePostObjIdHex,
-			expectedResponse: `{"msj":"post deleted"}`,
+			expectedResponse: `{"items":[{"id":"` + fakePostObjIdHex + `","content":"fake content","authorId":"` + fakeAuthorObjIdHex + `","author":"fake author"}]}`,
 			expectedCode:     http.StatusOK,
 		},
 		{
 			name:             "return-error",
+			authorCollection: fakeAuthorCol,
 			collection:       "fakeOtherCol",
-			postIdHex:        fakePostObjIdHex,
 			expectedResponse: `{"error":"dummy error"}`,
 			expectedCode:     http.StatusInternalServerError,
 		},
 		{
-			name:             "no-docs",
-			collection:       "NoDocs",
-			postIdHex:        fakePostObjIdHex,
+			name:             "author-not-found",
+			authorCollection: "NoDocs",
+			collection:       fakePostCol,
 			expectedResponse: `{"error":"mongo: no documents in result"}`,
 			expectedCode:     http.StatusNotFound,
 		},
-		{
-			name:             "return-error-invalid-hex-id",
-			collection:       "fakePostCol",
-			postIdHex:        "12345",
-			expectedResponse: `{"error":"the provided hex string is not a valid ObjectID"}`,
-			expectedCode:     http.StatusBadRequest,
-		},
 	}
 
 	for _, st := range subtests {
 		t.Run(st.name, func(t *testing.T) {
 			a := new(App)
 			router := mux.NewRouter()
-			subRouter := router.PathPrefix("/post").Subrouter()
+			subRouter := router.PathPrefix("/author").Subrouter()
 
-			subRouter.HandleFunc("/{id:[a-z0-9]+}", a.handleDeletePost(new(MockPost), "fakeDb", st.collection)).Methods(http.MethodDelete)
+			mockModels := NewMockModels()
+			mockModels.AColName = st.authorCollection
+			mockModels.PColName = st.collection
+			subRouter.HandleFunc("/{id:[a-z0-9]+}/posts", a.handleListAuthorPosts(mockModels, fakeDbName)).Methods(http.MethodGet)
 
 			w := httptest.NewRecorder()
-			url := fmt.Sprintf("/post/%v", st.postIdHex)
-			r, err := http.NewRequest(http.MethodDelete, url, nil)
+			r, err := http.NewRequest(http.MethodGet, "/author/"+fakeAuthorObjIdHex+"/posts", nil)
 			router.ServeHTTP(w, r)
 
 			if assert.NoError(t, err) {
@@ -246,42 +3794,63 @@ func TestHandleDeletePost(t *testing.T) {
 	}
 }
 
-func TestHandleCreateComment(t *testing.T) {
+func TestHandleListAuthorComments(t *testing.T) {
 	subtests := []struct {
 		name             string
+		authorCollection string
 		collection       string
+		viewer           string
 		expectedResponse string
 		expectedCode     int
 	}{
 		{
 			name:             "happy-path",
+			authorCollection: fakeAuthorCol,
 			collection:       fakeCommentCol,
-			expectedResponse: `{"InsertedID":"` + fakeCommentObjIdHex + `"}`,
-			expectedCode:     http.StatusCreated,
+			expectedResponse: `{"items":[{"id":"` + fakeCommentObjIdHex + `","content":"fake content","authorId":"` + fakeAuthorObjIdHex + `","author":"fake author","postId":"` + fakePostObjIdHex + `"}]}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "comments-of-draft-listed-to-its-author",
+			authorCollection: fakeAuthorCol,
+			collection:       fakeCommentCol,
+			viewer:           fakeAuthorObjIdHex,
+			expectedResponse: `{"items":[{"id":"` + fakeCommentObjIdHex + `","content":"fake content","authorId":"` + fakeAuthorObjIdHex + `","author":"fake author","postId":"` + fakePostObjIdHex + `"},` +
+				`{"id":"` + fakeReplyObjIdHex + `","content":"fake content","authorId":"` + fakeAuthorObjIdHex + `","author":"fake author","postId":"` + fakeDraftObjIdHex + `"}]}`,
+			expectedCode: http.StatusOK,
 		},
 		{
 			name:             "return-error",
+			authorCollection: fakeAuthorCol,
 			collection:       "fakeOtherCol",
 			expectedResponse: `{"error":"dummy error"}`,
 			expectedCode:     http.StatusInternalServerError,
 		},
+		{
+			name:             "author-not-found",
+			authorCollection: "NoDocs",
+			collection:       fakeCommentCol,
+			expectedResponse: `{"error":"mongo: no documents in result"}`,
+			expectedCode:     http.StatusNotFound,
+		},
 	}
 
 	for _, st := range subtests {
 		t.Run(st.name, func(t *testing.T) {
 			a := new(App)
-
 			router := mux.NewRouter()
-			subRouter := router.PathPrefix("/comment").Subrouter()
+			subRouter := router.PathPrefix("/author").Subrouter()
 
 			mockModels := NewMockModels()
+			mockModels.AColName = st.authorCollection
 			mockModels.CColName = st.collection
-			mockModels.PColName = fakePostCol
-			subRouter.HandleFunc("/", a.handleCreateComment(mockModels, fakeDbName)).Methods(http.MethodPost)
+			subRouter.HandleFunc("/{id:[a-z0-9]+}/comments", a.handleListAuthorComments(mockModels, fakeDbName)).Methods(http.MethodGet)
 
 			w := httptest.NewRecorder()
-			jsonBody := strings.NewReader(`{"content":"fake content", "author":"fake author", "postId":"89372c88c133e1e4deb0e10a"}`)
-			r, err := http.NewRequest(http.MethodPost, "/comment/", jsonBody)
+			r, err := http.NewRequest(http.MethodGet, "/author/"+fakeAuthorObjIdHex+"/comments", nil)
+			if st.viewer != "" {
+				r.Header.Set(appConstants.AuthorHeader, st.viewer)
+			}
 			router.ServeHTTP(w, r)
 
 			if assert.NoError(t, err) {
@@ -296,40 +3865,71 @@ func TestHandleCreateComment(t *testing.T) {
 	}
 }
 
-func TestHandleGetComment(t *testing.T) {
+func TestHandleSearch(t *testing.T) {
+	postHit := `{"type":"post","id":"` + fakePostObjIdHex + `","author":"fake author","snippet":"fake \u003cmark\u003econtent\u003c/mark\u003e","score":1.5}`
+	commentHit := `{"type":"comment","id":"` + fakeCommentObjIdHex + `","postId":"` + fakePostObjIdHex + `","author":"fake author","snippet":"fake \u003cmark\u003econtent\u003c/mark\u003e","score":0.75}`
+
 	subtests := []struct {
 		name             string
 		collection       string
-		commentIdHex     string
+		query            string
 		expectedResponse string
 		expectedCode     int
 	}{
 		{
 			name:             "happy-path",
-			collection:       fakeCommentCol,
-			commentIdHex:     fakeCommentObjIdHex,
-			expectedResponse: `{"id":"` + fakeCommentObjIdHex + `","content":"fake content","author":"fake author","postId":"` + fakePostObjIdHex + `"}`,
+			collection:       fakePostCol,
+			query:            "?q=content",
+			expectedResponse: `{"items":[` + postHit + `,` + commentHit + `]}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "comments-only",
+			collection:       fakePostCol,
+			query:            "?q=content&type=comment",
+			expectedResponse: `{"items":[` + commentHit + `]}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "next-cursor",
+			collection:       fakePostCol,
+			query:            "?q=content&limit=1",
+			expectedResponse: `{"items":[` + postHit + `],"next":"1"}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "last-page",
+			collection:       fakePostCol,
+			query:            "?q=content&limit=1&cursor=1",
+			expectedResponse: `{"items":[` + commentHit + `]}`,
 			expectedCode:     http.StatusOK,
 		},
 		{
 			name:             "return-error",
 			collection:       "fakeOtherCol",
-			commentIdHex:     fakeCommentObjIdHex,
-			expectedResponse: `{"error":"dummy ReadComment error"}`,
+			query:            "?q=content",
+			expectedResponse: `{"error":"dummy error"}`,
 			expectedCode:     http.StatusInternalServerError,
 		},
 		{
-			name:             "return-error-no-docs",
-			collection:       "NoDocs",
-			commentIdHex:     fakeCommentObjIdHex,
-			expectedResponse: `{"error":"mongo: no documents in result"}`,
-			expectedCode:     http.StatusNotFound,
+			name:             "return-error-missing-query",
+			collection:       fakePostCol,
+			query:            "?q=%20",
+			expectedResponse: `{"error":"q must not be empty"}`,
+			expectedCode:     http.StatusBadRequest,
 		},
 		{
-			name:             "return-error-invalid-hex-id",
-			collection:       fakeCommentCol,
-			commentIdHex:     "12345",
-			expectedResponse: `{"error":"the provided hex string is not a valid ObjectID"}`,
+			name:             "return-error-invalid-type",
+			collection:       fakePostCol,
+			query:            "?q=content&type=author",
+			expectedResponse: `{"error":"type must be either post or comment"}`,
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "return-error-invalid-cursor",
+			collection:       fakePostCol,
+			query:            "?q=content&cursor=" + fakePostObjIdHex,
+			expectedResponse: `{"error":"cursor must be a number between 0 and 1000"}`,
 			expectedCode:     http.StatusBadRequest,
 		},
 	}
@@ -337,14 +3937,15 @@ func TestHandleGetComment(t *testing.T) {
 	for _, st := range subtests {
 		t.Run(st.name, func(t *testing.T) {
 			a := new(App)
-
 			router := mux.NewRouter()
-			subRouter := router.PathPrefix("/comment").Subrouter()
 
-			subRouter.HandleFunc("/{id:[a-z0-9]+}", a.handleGetComment(new(MockComment), fakeDbName, st.collection)).Methods(http.MethodGet)
+			mockModels := NewMockModels()
+			mockModels.PColName = st.collection
+			mockModels.CColName = fakeCommentCol
+			router.HandleFunc("/search", a.handleSearch(mockModels, fakeDbName)).Methods(http.MethodGet)
 
 			w := httptest.NewRecorder()
-			r, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/comment/%v", st.commentIdHex), nil)
+			r, err := http.NewRequest(http.MethodGet, "/search"+st.query, nil)
 			router.ServeHTTP(w, r)
 
 			if assert.NoError(t, err) {
@@ -359,41 +3960,187 @@ func TestHandleGetComment(t *testing.T) {
 	}
 }
 
-func TestHandlePutComment(t *testing.T) {
+func TestRequestTimeout(t *testing.T) {
 	subtests := []struct {
-		name             string
-		collection       string
-		commentIdHex     string
-		expectedResponse string
-		expectedCode     int
+		name            string
+		path            string
+		expectedTimeout time.Duration
 	}{
 		{
-			name:             "happy-path",
-			collection:       fakeCommentCol,
-			commentIdHex:     fakeCommentObjIdHex,
-			expectedResponse: `{"msj":"comment updated"}`,
-			expectedCode:     http.StatusOK,
+			name:            "api-request",
+			path:            "/post/",
+			expectedTimeout: appConstants.RequestTimeout,
 		},
 		{
-			name:             "return-error",
-			collection:       "fakeOtherCol",
-			commentIdHex:     fakeCommentObjIdHex,
-			expectedResponse: `{"error":"dummy ReadComment error"}`,
-			expectedCode:     http.StatusInternalServerError,
+			name:            "admin-request",
+			path:            "/admin/export",
+			expectedTimeout: appConstants.TransferTimeout,
 		},
 		{
-			name:             "no-docs",
-			collection:       "NoDocs",
-			commentIdHex:     fakeCommentObjIdHex,
-			expectedResponse: `{"error":"mongo: no documents in result"}`,
-			expectedCode:     http.StatusNotFound,
+			name:            "attachment-request",
+			path:            "/post/" + fakePostObjIdHex + "/attachments/" + fakeAttachmentObjIdHex,
+			expectedTimeout: appConstants.TransferTimeout,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			var deadline time.Time
+			var ok bool
+			h := requestTimeout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				deadline, ok = r.Context().Deadline()
+			}))
+
+			w := httptest.NewRecorder()
+			r, err := http.NewRequest(http.MethodGet, st.path, nil)
+			h.ServeHTTP(w, r)
+
+			if assert.NoError(t, err) && assert.True(t, ok) {
+				assert.WithinDuration(t, time.Now().Add(st.expectedTimeout), deadline, time.Second)
+			}
+		})
+	}
+}
+
+func TestListQueryParams(t *testing.T) {
+	subtests := []struct {
+		name           string
+		query          string
+		expectedFilter bson.M
+		expectedSort   bson.D
+	}{
+		{
+			name:           "defaults",
+			query:          "",
+			expectedFilter: bson.M{},
+			expectedSort:   bson.D{{Key: "_id", Value: 1}},
 		},
 		{
-			name:             "return-error-invalid-hex-id",
-			collection:       "fakePostCol",
-			commentIdHex:     "12345",
-			expectedResponse: `{"error":"the provided hex string is not a valid ObjectID"}`,
-			expectedCode:     http.StatusBadRequest,
+			name:  "and-binds-tighter-than-or",
+			query: "?filter=" + url.QueryEscape("author eq 'o''brien' or content startswith 'a.b' AND version ge 2"),
+			expectedFilter: bson.M{"$or": bson.A{
+				bson.M{"author": bson.M{"$eq": "o'brien"}},
+				bson.M{"$and": bson.A{
+					bson.M{"content": bson.M{"$regex": `^a\.b`, "$options": "i"}},
+					bson.M{"version": bson.M{"$gte": int64(2)}},
+				}},
+			}},
+			expectedSort: bson.D{{Key: "_id", Value: 1}},
+		},
+		{
+			name:           "operators-as-values",
+			query:          "?filter=" + url.QueryEscape("author eq '{\"$ne\": null}'"),
+			expectedFilter: bson.M{"author": bson.M{"$eq": `{"$ne": null}`}},
+			expectedSort:   bson.D{{Key: "_id", Value: 1}},
+		},
+		{
+			name:  "missing-zero-fields",
+			query: "?filter=" + url.QueryEscape("commentCount lt 3"),
+			expectedFilter: bson.M{"$or": bson.A{
+				bson.M{"commentCount": bson.M{"$lt": int64(3)}},
+				bson.M{"commentCount": bson.M{"$eq": nil}},
+			}},
+			expectedSort: bson.D{{Key: "_id", Value: 1}},
+		},
+		{
+			name:  "shortcuts-and-sort",
+			query: "?author=alice&createdAfter=2023-01-01&sort=-createdAt,author",
+			expectedFilter: bson.M{"$and": bson.A{
+				bson.M{"author": bson.M{"$eq": "alice"}},
+				bson.M{"createdAt": bson.M{"$gt": time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)}},
+			}},
+			expectedSort: bson.D{{Key: "createdAt", Value: -1}, {Key: "author", Value: 1}, {Key: "_id", Value: 1}},
+		},
+		{
+			name:           "newest",
+			query:          "?sort=newest",
+			expectedFilter: bson.M{},
+			expectedSort:   bson.D{{Key: "_id", Value: -1}},
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodGet, "/post/"+st.query, nil)
+			if assert.NoError(t, err) {
+				query, _, err := listQueryParams(r, appDb.PostQueryFields, appDb.PostFieldNames)
+				if assert.NoError(t, err) {
+					assert.Equal(t, st.expectedFilter, query.Filter())
+					assert.Equal(t, st.expectedSort, query.Sort())
+				}
+			}
+		})
+	}
+}
+
+func TestIfMatch(t *testing.T) {
+	subtests := []struct {
+		name            string
+		ifMatch         []string
+		expectedVersion int64
+		expectedReads   int
+		expectedErr     error
+	}{
+		{name: "missing"},
+		{name: "any", ifMatch: []string{"*"}},
+		{name: "single", ifMatch: []string{`"3"`}, expectedVersion: 3},
+		{name: "single-not-current", ifMatch: []string{`"2"`}, expectedVersion: 2},
+		{name: "list-with-current", ifMatch: []string{`"2", "3"`}, expectedVersion: 3, expectedReads: 1},
+		{name: "headers-with-current", ifMatch: []string{`"2"`, `"3"`}, expectedVersion: 3, expectedReads: 1},
+		{name: "list-without-current", ifMatch: []string{`"1", "2"`}, expectedReads: 1, expectedErr: appDb.ErrVersionMismatch},
+		{name: "weak-never-matches", ifMatch: []string{`W/"3"`}, expectedErr: appDb.ErrVersionMismatch},
+		{name: "weak-left-out-of-list", ifMatch: []string{`W/"2", "3"`}, expectedVersion: 3},
+		{name: "not-a-version", ifMatch: []string{`"abc"`}, expectedErr: appDb.ErrVersionMismatch},
+		{name: "empty-list-elements", ifMatch: []string{`, "3",`}, expectedVersion: 3},
+		{name: "return-error-unquoted", ifMatch: []string{"3"}, expectedErr: errInvalidIfMatch},
+		{name: "return-error-unterminated", ifMatch: []string{`"3`}, expectedErr: errInvalidIfMatch},
+		{name: "return-error-missing-comma", ifMatch: []string{`"2" "3"`}, expectedErr: errInvalidIfMatch},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPut, "/", nil)
+			for _, h := range st.ifMatch {
+				r.Header.Add("If-Match", h)
+			}
+			reads := 0
+			version, err := ifMatch(r, func() (int64, error) {
+				reads++
+				return 3, nil
+			})
+			assert.Equal(t, st.expectedReads, reads)
+			if st.expectedErr != nil {
+				assert.ErrorIs(t, err, st.expectedErr)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, st.expectedVersion, version)
+			}
+		})
+	}
+}
+
+func TestHandleExport(t *testing.T) {
+	subtests := []struct {
+		name                string
+		collection          string
+		expectedContentType string
+		expectedResponse    string
+		expectedCode        int
+	}{
+		{
+			name:                "happy-path",
+			collection:          fakePostCol,
+			expectedContentType: appConstants.NDJSONContentType,
+			expectedResponse:    fakeExport,
+			expectedCode:        http.StatusOK,
+		},
+		{
+			name:                "return-error",
+			collection:          "fakeOtherCol",
+			expectedContentType: "application/json",
+			expectedResponse:    `{"error":"dummy error"}` + "\n",
+			expectedCode:        http.StatusInternalServerError,
 		},
 	}
 
@@ -401,76 +4148,98 @@ func TestHandlePutComment(t *testing.T) {
 		t.Run(st.name, func(t *testing.T) {
 			a := new(App)
 			router := mux.NewRouter()
-			subRouter := router.PathPrefix("/comment").Subrouter()
-			subRouter.HandleFunc("/{id:[a-z0-9]+}", a.handlePutComment(new(MockComment), fakeDbName, st.collection)).Methods(http.MethodPut)
+			subRouter := router.PathPrefix("/admin").Subrouter()
+
+			mockModels := NewMockModels()
+			mockModels.PColName = st.collection
+			subRouter.HandleFunc("/export", a.handleExport(mockModels, fakeDbName)).Methods(http.MethodGet)
 
 			w := httptest.NewRecorder()
-			jsonBody := strings.NewReader(`{"content":"updated fake comment content", "author":"fake author"}`)
-			url := fmt.Sprintf("/comment/%v", st.commentIdHex)
-			r, err := http.NewRequest(http.MethodPut, url, jsonBody)
+			r, err := http.NewRequest(http.MethodGet, "/admin/export", nil)
 			router.ServeHTTP(w, r)
 
 			if assert.NoError(t, err) {
 				assert.EqualValues(t, st.expectedCode, w.Code)
+				assert.EqualValues(t, st.expectedContentType, w.Header().Get("Content-Type"))
 			}
 
 			b, err := io.ReadAll(w.Body)
 			if assert.NoError(t, err) {
-				assert.EqualValues(t, st.expectedResponse, strings.TrimSuffix(string(b), "\n"))
+				assert.EqualValues(t, st.expectedResponse, string(b))
 			}
 		})
 	}
 }
 
-func TestHandleDeleteComment(t *testing.T) {
+func TestHandleImport(t *testing.T) {
 	subtests := []struct {
 		name             string
 		collection       string
-		commentIdHex     string
+		contentType      string
+		query            string
 		expectedResponse string
 		expectedCode     int
 	}{
 		{
 			name:             "happy-path",
-			collection:       fakeCommentCol,
-			commentIdHex:     fakeCommentObjIdHex,
-			expectedResponse: `{"msj":"comment deleted"}`,
+			collection:       fakePostCol,
+			contentType:      appConstants.NDJSONContentType,
+			expectedResponse: `{"inserted":2,"updated":0,"skipped":0,"failed":0,"reconciled":0}`,
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "upsert-regenerating-ids",
+			collection:       fakePostCol,
+			contentType:      appConstants.NDJSONContentType,
+			query:            "?mode=upsert&ids=regenerate",
+			expectedResponse: `{"inserted":0,"updated":2,"skipped":0,"failed":0,"reconciled":0}`,
 			expectedCode:     http.StatusOK,
 		},
 		{
 			name:             "return-error",
 			collection:       "fakeOtherCol",
-			commentIdHex:     fakeCommentObjIdHex,
-			expectedResponse: `{"error":"dummy ReadComment error"}`,
+			contentType:      appConstants.NDJSONContentType,
+			expectedResponse: `{"error":"dummy error"}`,
 			expectedCode:     http.StatusInternalServerError,
 		},
 		{
-			name:             "no-docs",
-			collection:       "NoDocs",
-			commentIdHex:     fakeCommentObjIdHex,
-			expectedResponse: `{"error":"mongo: no documents in result"}`,
-			expectedCode:     http.StatusNotFound,
+			name:             "return-error-invalid-mode",
+			collection:       fakePostCol,
+			contentType:      appConstants.NDJSONContentType,
+			query:            "?mode=overwrite",
+			expectedResponse: `{"error":"mode must be either skip or upsert"}`,
+			expectedCode:     http.StatusBadRequest,
 		},
 		{
-			name:             "return-error-invalid-hex-id",
-			collection:       fakeCommentCol,
-			commentIdHex:     "12345",
-			expectedResponse: `{"error":"the provided hex string is not a valid ObjectID"}`,
+			name:             "return-error-invalid-ids",
+			collection:       fakePostCol,
+			contentType:      appConstants.NDJSONContentType,
+			query:            "?ids=new",
+			expectedResponse: `{"error":"ids must be either keep or regenerate"}`,
 			expectedCode:     http.StatusBadRequest,
 		},
+		{
+			name:             "return-error-wrong-content-type",
+			collection:       fakePostCol,
+			contentType:      "application/json",
+			expectedResponse: `{"error":"content type must be application/x-ndjson"}`,
+			expectedCode:     http.StatusUnsupportedMediaType,
+		},
 	}
 
 	for _, st := range subtests {
 		t.Run(st.name, func(t *testing.T) {
 			a := new(App)
 			router := mux.NewRouter()
-			subRouter := router.PathPrefix("/comment").Subrouter()
+			subRouter := router.PathPrefix("/admin").Subrouter()
 
-			subRouter.HandleFunc("/{id:[a-z0-9]+}", a.handleDeleteComment(new(MockComment), fakeDbName, st.collection)).Methods(http.MethodDelete)
+			mockModels := NewMockModels()
+			mockModels.PColName = st.collection
+			subRouter.HandleFunc("/import", a.handleImport(mockModels, fakeDbName)).Methods(http.MethodPost)
 
 			w := httptest.NewRecorder()
-			url := fmt.Sprintf("/comment/%v", st.commentIdHex)
-			r, err := http.NewRequest(http.MethodDelete, url, nil)
+			r, err := http.NewRequest(http.MethodPost, "/admin/import"+st.query, strings.NewReader(fakeExport))
+			r.Header.Set("Content-Type", st.contentType)
 			router.ServeHTTP(w, r)
 
 			if assert.NoError(t, err) {
@@ -484,3 +4253,118 @@ func TestHandleDeleteComment(t *testing.T) {
 		})
 	}
 }
+
+func TestConcurrentPostRequests(t *testing.T) {
+	const n = 50
+
+	// keeps every post handed out to the handlers
+	var mu sync.Mutex
+	var posts []*MockPost
+	newPost := func() appDb.Post {
+		p := new(MockPost)
+		mu.Lock()
+		posts = append(posts, p)
+		mu.Unlock()
+		return p
+	}
+
+	a := new(App)
+	router := mux.NewRouter()
+	subRouter := router.PathPrefix("/post").Subrouter()
+	mockModels := NewMockModels()
+	mockModels.P = newPost
+	mockModels.PColName = fakePostCol
+	subRouter.HandleFunc("/", a.handleCreatePost(mockModels, fakeDbName)).Methods(http.MethodPost)
+	subRouter.HandleFunc("/{id:[a-z0-9]+}", a.handlePutPost(newPost, fakeDbName, fakePostCol)).Methods(http.MethodPut)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			jsonBody := strings.NewReader(fmt.Sprintf(`{"content":"created %d", "authorId":"%v"}`, i, fakeAuthorObjIdHex))
+			r := httptest.NewRequest(http.MethodPost, "/post/", jsonBody)
+			router.ServeHTTP(w, r)
+			assert.EqualValues(t, http.StatusCreated, w.Code)
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			jsonBody := strings.NewReader(fmt.Sprintf(`{"content":"updated %d"}`, i))
+			r := httptest.NewRequest(http.MethodPut, "/post/"+fakePostObjIdHex, jsonBody)
+			router.ServeHTTP(w, r)
+			assert.EqualValues(t, http.StatusOK, w.Code)
+		}(i)
+	}
+	wg.Wait()
+
+	// each request decoded its body into a document of its own
+	decoded, contents := 0, map[string]bool{}
+	for _, p := range posts {
+		if p.Content != "" {
+			decoded++
+			contents[p.Content] = true
+		}
+	}
+	assert.EqualValues(t, 2*n, decoded)
+	assert.Len(t, contents, 2*n)
+}
+
+func TestConcurrentCommentRequests(t *testing.T) {
+	const n = 50
+
+	// keeps every comment handed out to the handlers
+	var mu sync.Mutex
+	var comments []*MockComment
+	newComment := func() appDb.Comment {
+		c := new(MockComment)
+		mu.Lock()
+		comments = append(comments, c)
+		mu.Unlock()
+		return c
+	}
+
+	a := new(App)
+	router := mux.NewRouter()
+	subRouter := router.PathPrefix("/comment").Subrouter()
+	mockModels := NewMockModels()
+	mockModels.C = newComment
+	mockModels.PColName = fakePostCol
+	mockModels.CColName = fakeCommentCol
+	subRouter.HandleFunc("/", a.handleCreateComment(mockModels, fakeDbName)).Methods(http.MethodPost)
+	subRouter.HandleFunc("/{id:[a-z0-9]+}", a.handlePutComment(newComment, fakeDbName, fakeCommentCol)).Methods(http.MethodPut)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			jsonBody := strings.NewReader(fmt.Sprintf(`{"content":"created %d", "authorId":"%v", "postId":"%v"}`, i, fakeAuthorObjIdHex, fakePostObjIdHex))
+			r := httptest.NewRequest(http.MethodPost, "/comment/", jsonBody)
+			router.ServeHTTP(w, r)
+			assert.EqualValues(t, http.StatusCreated, w.Code)
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			jsonBody := strings.NewReader(fmt.Sprintf(`{"content":"updated %d"}`, i))
+			r := httptest.NewRequest(http.MethodPut, "/comment/"+fakeCommentObjIdHex, jsonBody)
+			router.ServeHTTP(w, r)
+			assert.EqualValues(t, http.StatusOK, w.Code)
+		}(i)
+	}
+	wg.Wait()
+
+	// each request decoded its body into a document of its own
+	decoded, contents := 0, map[string]bool{}
+	for _, c := range comments {
+		if c.Content != "" {
+			decoded++
+			contents[c.Content] = true
+		}
+	}
+	assert.EqualValues(t, 2*n, decoded)
+	assert.Len(t, contents, 2*n)
+}
@@ -0,0 +1,57 @@
+package app
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	appConstants "github.com/gjbastidas/GoSimpleAPIWithMongoDB/constants"
+	"github.com/gorilla/mux"
+)
+
+// requestTimeout bounds every request with a deadline derived from the request context,
+// so db operations are cancelled on timeout, client disconnect or server shutdown.
+// Admin requests move the whole dataset, and attachment requests whole files, so they get a longer deadline
+func requestTimeout(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeout := appConstants.RequestTimeout
+		if strings.HasPrefix(r.URL.Path, "/admin/") || strings.Contains(r.URL.Path, "/attachments") {
+			timeout = appConstants.TransferTimeout
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requireModerator lets through the requests bearing the moderator token
+func requireModerator(token string) mux.MiddlewareFunc {
+	return requireToken(token, "moderator")
+}
+
+// requireAdmin lets through the requests bearing the admin token
+func requireAdmin(token string) mux.MiddlewareFunc {
+	return requireToken(token, "admin")
+}
+
+// requireToken lets through the requests bearing token in their Authorization header.
+// The endpoints of role are forbidden when no token is configured
+func requireToken(token, role string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token == "" {
+				jsonPrintError(w, http.StatusForbidden, role+" endpoints are disabled", role+" request refused")
+				return
+			}
+			h := r.Header.Get("Authorization")
+			given := strings.TrimPrefix(h, "Bearer ")
+			if given == h || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				jsonPrintError(w, http.StatusUnauthorized, "invalid "+role+" token", role+" request refused")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -1,8 +1,15 @@
 package app
 
 import (
+	"context"
+
 	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
 
+	appConstants "github.com/gjbastidas/GoSimpleAPIWithMongoDB/constants"
 	appDb "github.com/gjbastidas/GoSimpleAPIWithMongoDB/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -13,10 +20,68 @@ const (
 	fakeDbName          = "fakeDb"
 	fakePostCol         = "fakePostCol"
 	fakeCommentCol      = "fakeCommentCol"
+	fakeAuthorCol       = "fakeAuthorCol"
 	fakePostObjIdHex    = "89372c88c133e1e4deb0e10a"
 	fakeCommentObjIdHex = "bfc80a35195ed2079d97c43b"
+	fakeReplyObjIdHex   = "c3a1d8e0f2b4a6c8e0f2b4a6"
+	fakeAuthorObjIdHex  = "5f1e2d3c4b5a69788796a5b4"
+	// fakeBusyAuthorObjIdHex is an author that still has posts or comments
+	fakeBusyAuthorObjIdHex = "e1d2c3b4a5968778695a4b3c"
+	// fakeTakenAuthorName is the name of an author that already exists
+	fakeTakenAuthorName = "taken author"
+	// fakeForeignCommentObjIdHex is a comment that belongs to another post
+	fakeForeignCommentObjIdHex = "d4e5f60718293a4b5c6d7e8f"
+	// fakeMarkdownObjIdHex is a post written in markdown
+	fakeMarkdownObjIdHex = "7a6b5c4d3e2f1a0b9c8d7e6f"
+	// fakeDraftObjIdHex is a draft post of the fakeAuthorObjIdHex author
+	fakeDraftObjIdHex = "6e5d4c3b2a1908f7e6d5c4b3"
+	// fakeModeratedObjIdHex is a post whose comments wait for a moderator
+	fakeModeratedObjIdHex = "3c4d5e6f708192a3b4c5d6e7"
+	// fakePendingObjIdHex is a comment of the fakeAuthorObjIdHex author waiting for a moderator
+	fakePendingObjIdHex = "9f8e7d6c5b4a39281706f5e4"
+	// fakeModeratorToken is the token moderators authenticate with
+	fakeModeratorToken = "fake moderator token"
+	// fakeAdminToken is the token admins authenticate with
+	fakeAdminToken = "fake admin token"
+	// fakeMissingObjIdHex is a post, comment or author that does not exist
+	fakeMissingObjIdHex = "a0a0a0a0a0a0a0a0a0a0a0a0"
+	// fakeDuplicateContent is the content of posts and comments conflicting with a stored one
+	fakeDuplicateContent = "duplicate content"
+	// fakeAttachmentObjIdHex is the only file attached to posts
+	fakeAttachmentObjIdHex = "0f1e2d3c4b5a69788796a5b4"
+	fakeAttachmentContent  = "fake attachment content"
+	// fakeThumbnailSize is the only size the attachment has a thumbnail in
+	fakeThumbnailSize    = 64
+	fakeThumbnailContent = "fake thumbnail content"
 )
 
+// mockProject drops from the document doc points to the fields projection does not select
+func mockProject[D any](doc *D, projection appDb.Projection) error {
+	if projection == nil {
+		return nil
+	}
+	b, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	fields := bson.M{}
+	err = bson.Unmarshal(b, &fields)
+	if err != nil {
+		return err
+	}
+	for k := range fields {
+		if projection[k] != 1 {
+			delete(fields, k)
+		}
+	}
+	b, err = bson.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	*doc = *new(D)
+	return bson.Unmarshal(b, doc)
+}
+
 func getObjId(hex string) primitive.ObjectID {
 	out, _ := primitive.ObjectIDFromHex(hex)
 	return out
@@ -24,15 +89,33 @@ func getObjId(hex string) primitive.ObjectID {
 
 func NewMockModels() *appDb.Models {
 	return &appDb.Models{
-		P: &MockPost{},
-		C: &MockComment{},
+		P:        NewMockPost,
+		C:        NewMockComment,
+		A:        NewMockAuthor,
+		AColName: fakeAuthorCol,
+		S:        NewMockSearch,
+		T:        NewMockTransfer,
 	}
 }
 
+func NewMockPost() appDb.Post {
+	return new(MockPost)
+}
+
 type MockPost struct {
+	Id        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Content   string             `json:"content,omitempty" bson:"content,omitempty"`
+	Format    appDb.Format       `json:"format,omitempty" bson:"format,omitempty"`
+	AuthorId  string             `json:"authorId,omitempty" bson:"authorId,omitempty"`
+	Author    string             `json:"author,omitempty" bson:"author,omitempty"`
+	Status    appDb.PostStatus   `json:"status,omitempty" bson:"status,omitempty"`
+	PublishAt *time.Time         `json:"publishAt,omitempty" bson:"publishAt,omitempty"`
 }
 
-func (mP *MockPost) CreatePost(mCl *mongo.Client, dbName, colName string) (*mongo.InsertOneResult, error) {
+func (mP *MockPost) CreatePost(ctx context.Context, mCl *mongo.Client, dbName, colName string) (*mongo.InsertOneResult, error) {
+	if mP.Status == appDb.StatusScheduled && mP.PublishAt == nil {
+		return nil, appDb.ErrPublishAtRequired
+	}
 	if dbName == fakeDbName {
 		out := &mongo.InsertOneResult{}
 		if colName != fakePostCol {
@@ -45,23 +128,145 @@ func (mP *MockPost) CreatePost(mCl *mongo.Client, dbName, colName string) (*mong
 	return &mongo.InsertOneResult{}, nil
 }
 
-func (mP *MockPost) ReadPost(mCl *mongo.Client, objId primitive.ObjectID, dbName, colName string) (*appDb.PostDoc, error) {
+func (mP *MockPost) CreatePosts(ctx context.Context, mCl *mongo.Client, posts []*appDb.PostDoc, ordered bool, dbName, colName string) ([]*appDb.BulkResult, error) {
+	if dbName == fakeDbName && colName != fakePostCol {
+		return nil, errors.New("dummy error")
+	}
+	return mockBulk(len(posts), ordered, func(i int) (primitive.ObjectID, error) {
+		if posts[i].Content == fakeDuplicateContent {
+			return primitive.NilObjectID, duplicateKeyError
+		}
+		return getObjId(fakePostObjIdHex), nil
+	}), nil
+}
+
+func (mP *MockPost) ReadPost(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, dbName, colName string) (*appDb.PostDoc, error) {
 	if dbName == fakeDbName {
 		out := new(appDb.PostDoc)
+		if objId.Hex() == fakeMissingObjIdHex {
+			return out, mongo.ErrNoDocuments
+		}
 		if colName != fakePostCol && colName != fakeCommentCol {
 			if colName == "NoDocs" {
 				return out, mongo.ErrNoDocuments
 			}
 			return out, errors.New("dummy error")
 		}
-		res, _ := bson.Marshal(bson.M{"_id": objId, "content": "fake content", "author": "fake author"})
+		doc := bson.M{"_id": objId, "content": "fake content", "author": "fake author", "version": 1}
+		switch objId.Hex() {
+		case fakeMarkdownObjIdHex:
+			doc["content"], doc["format"] = "**fake** <script>alert(1)</script>[content](javascript:alert(1))", appDb.FormatMarkdown
+		case fakeDraftObjIdHex:
+			doc["authorId"], doc["status"] = getObjId(fakeAuthorObjIdHex), appDb.StatusDraft
+		case fakeModeratedObjIdHex:
+			doc["moderation"] = appDb.ModerationPre
+		}
+		res, _ := bson.Marshal(doc)
 		_ = bson.Unmarshal(res, out)
 		return out, nil
 	}
 	return &appDb.PostDoc{}, nil
 }
 
-func (mP *MockPost) UpdatePost(mCl *mongo.Client, objId primitive.ObjectID, dbName, colName string) error {
+func (mP *MockPost) ReadPostFields(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, projection appDb.Projection, dbName, colName string) (*appDb.PostDoc, error) {
+	out, err := mP.ReadPost(ctx, mCl, objId, dbName, colName)
+	if err != nil {
+		return out, err
+	}
+	return out, mockProject(out, projection)
+}
+
+// ReadPostExpanded embeds a single comment, telling there is a next page when commentsLimit is 1
+func (mP *MockPost) ReadPostExpanded(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, projection appDb.Projection, expand []string, commentsLimit int64, dbName, colName, cColName, aColName string) (*appDb.ExpandedPost, error) {
+	post, err := mP.ReadPostFields(ctx, mCl, objId, projection, dbName, colName)
+	if err != nil {
+		return nil, err
+	}
+	if dbName == fakeDbName && (cColName != fakeCommentCol || aColName != fakeAuthorCol) {
+		return nil, errors.New("dummy error")
+	}
+	out := &appDb.ExpandedPost{PostDoc: post}
+	for _, e := range expand {
+		switch e {
+		case appDb.ExpandComments:
+			out.Comments = &appDb.Page[*appDb.CommentDoc]{Items: []*appDb.CommentDoc{{Id: getObjId(fakeCommentObjIdHex), Content: "fake content", PostId: objId.Hex()}}}
+			if commentsLimit == 1 {
+				out.Comments.Next = fakeCommentObjIdHex
+			}
+		case appDb.ExpandAuthor:
+			out.AuthorDetails = &appDb.AuthorDoc{Id: getObjId(fakeAuthorObjIdHex), Name: "fake author"}
+		}
+	}
+	return out, nil
+}
+
+// AddAttachment takes text files only
+func (mP *MockPost) AddAttachment(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, name string, r io.Reader, dbName, colName string) (*appDb.AttachmentDoc, error) {
+	if objId.Hex() == fakeMissingObjIdHex {
+		return nil, mongo.ErrNoDocuments
+	}
+	if dbName == fakeDbName && colName != fakePostCol {
+		return nil, errors.New("dummy error")
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(name, ".txt") {
+		return nil, appDb.ErrAttachmentType
+	}
+	return &appDb.AttachmentDoc{Id: getObjId(fakeAttachmentObjIdHex), Name: name, ContentType: "text/plain", Size: int64(len(b))}, nil
+}
+
+// OpenAttachment has thumbnails made in fakeThumbnailSize only
+func (mP *MockPost) OpenAttachment(ctx context.Context, mCl *mongo.Client, objId, fileId primitive.ObjectID, size int, dbName, colName string) (*appDb.AttachmentDoc, io.ReadSeekCloser, error) {
+	if dbName == fakeDbName && colName != fakePostCol {
+		return nil, nil, errors.New("dummy error")
+	}
+	if fileId.Hex() != fakeAttachmentObjIdHex {
+		return nil, nil, mongo.ErrNoDocuments
+	}
+	switch size {
+	case 0:
+		a := &appDb.AttachmentDoc{Id: fileId, Name: "fake.txt", ContentType: "text/plain", Size: int64(len(fakeAttachmentContent))}
+		return a, nopCloser{strings.NewReader(fakeAttachmentContent)}, nil
+	case fakeThumbnailSize:
+		a := &appDb.AttachmentDoc{Id: fileId, Name: "fake.png", ContentType: "image/png", Size: int64(len(fakeThumbnailContent))}
+		return a, nopCloser{strings.NewReader(fakeThumbnailContent)}, nil
+	}
+	return nil, nil, mongo.ErrNoDocuments
+}
+
+func (mP *MockPost) AddThumbnails(ctx context.Context, mCl *mongo.Client, objId, fileId primitive.ObjectID, sizes []int, dbName, colName string) error {
+	if dbName == fakeDbName && colName != fakePostCol {
+		return errors.New("dummy error")
+	}
+	return nil
+}
+
+func (mP *MockPost) RemoveAttachment(ctx context.Context, mCl *mongo.Client, objId, fileId primitive.ObjectID, dbName, colName string) error {
+	if dbName == fakeDbName && colName != fakePostCol {
+		return errors.New("dummy error")
+	}
+	if fileId.Hex() != fakeAttachmentObjIdHex {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// nopCloser adds a Close method doing nothing to a ReadSeeker
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+func (mP *MockPost) ReplacePost(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, version int64, dbName, colName string) error {
+	if version > 1 {
+		return appDb.ErrVersionMismatch
+	}
 	if dbName == fakeDbName && colName != fakePostCol {
 		if colName == "NoDocs" {
 			return mongo.ErrNoDocuments
@@ -71,24 +276,190 @@ func (mP *MockPost) UpdatePost(mCl *mongo.Client, objId primitive.ObjectID, dbNa
 	return nil
 }
 
-func (mP *MockPost) DeletePost(mCl *mongo.Client, objId primitive.ObjectID, dbName, colName string) error {
+func (mP *MockPost) PatchPost(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, patch map[string]any, version int64, dbName, colName string) error {
+	if version > 1 {
+		return appDb.ErrVersionMismatch
+	}
+	if dbName == fakeDbName && colName != fakePostCol {
+		return errors.New("dummy error")
+	}
+	if _, ok := patch["id"]; ok {
+		return fmt.Errorf("%w: field %q cannot be patched", appDb.ErrInvalidPatch, "id")
+	}
+	// the stored post is published, so it can only become scheduled along with a publishAt time
+	patched := new(appDb.PostDoc)
+	if s, ok := patch["status"].(string); ok {
+		patched.Status = appDb.PostStatus(s)
+	}
+	if _, ok := patch["publishAt"].(string); ok {
+		now := time.Now()
+		patched.PublishAt = &now
+	}
+	return patched.CheckSchedule()
+}
+
+func (mP *MockPost) DeletePost(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, version int64, detachComments bool, dbName, colName, cColName string) (int64, error) {
+	if version > 1 {
+		return 0, appDb.ErrVersionMismatch
+	}
 	if dbName == fakeDbName && colName != fakePostCol {
 		if colName == "NoDocs" {
-			return mongo.ErrNoDocuments
+			return 0, mongo.ErrNoDocuments
+		}
+		return 0, errors.New("dummy error")
+	}
+	if dbName == fakeDbName && cColName != fakeCommentCol {
+		return 0, errors.New("dummy error")
+	}
+	return 2, nil
+}
+
+func (mP *MockPost) DeletePosts(ctx context.Context, mCl *mongo.Client, objIds []primitive.ObjectID, ordered, detachComments bool, dbName, colName, cColName string) ([]*appDb.BulkResult, error) {
+	if dbName == fakeDbName && colName != fakePostCol {
+		return nil, errors.New("dummy error")
+	}
+	return mockBulk(len(objIds), ordered, func(i int) (primitive.ObjectID, error) {
+		if objIds[i].Hex() == fakeMissingObjIdHex {
+			return primitive.NilObjectID, mongo.ErrNoDocuments
+		}
+		return objIds[i], nil
+	}), nil
+}
+
+// ListPosts knows of a single post, tagged go and mongodb
+func (mP *MockPost) ListPosts(ctx context.Context, mCl *mongo.Client, tags []string, anyTag bool, query *appDb.ListQuery, limit int64, dbName, colName string) (*appDb.Page[*appDb.PostDoc], error) {
+	if dbName == fakeDbName && colName != fakePostCol {
+		return nil, errors.New("dummy error")
+	}
+	postTags := map[string]bool{"go": true, "mongodb": true}
+	matches := len(tags) == 0 || !anyTag
+	for _, t := range tags {
+		if anyTag {
+			matches = matches || postTags[t]
+		} else {
+			matches = matches && postTags[t]
+		}
+	}
+	out := &appDb.Page[*appDb.PostDoc]{Items: []*appDb.PostDoc{}}
+	if query.IsFirstPage() && matches {
+		out.Items = append(out.Items, &appDb.PostDoc{Id: getObjId(fakePostObjIdHex), Content: "fake content", Author: "fake author", Tags: []string{"go", "mongodb"}})
+		if limit == 1 {
+			out.Next = fakePostObjIdHex
 		}
+	}
+	return out, nil
+}
+
+func (mP *MockPost) ListAuthorPosts(ctx context.Context, mCl *mongo.Client, authorId primitive.ObjectID, query *appDb.ListQuery, limit int64, dbName, colName string) (*appDb.Page[*appDb.PostDoc], error) {
+	if dbName == fakeDbName && colName != fakePostCol {
+		return nil, errors.New("dummy error")
+	}
+	out := &appDb.Page[*appDb.PostDoc]{Items: []*appDb.PostDoc{}}
+	if query.IsFirstPage() {
+		out.Items = append(out.Items, &appDb.PostDoc{Id: getObjId(fakePostObjIdHex), Content: "fake content", AuthorId: &authorId, Author: "fake author"})
+	}
+	return out, nil
+}
+
+func NewMockComment() appDb.Comment {
+	return new(MockComment)
+}
+
+func (mP *MockPost) ListRevisions(ctx context.Context, mCl *mongo.Client, objId, cursor primitive.ObjectID, limit int64, dbName, colName string) (*appDb.Page[*appDb.RevisionDoc], error) {
+	if dbName == fakeDbName && colName != fakePostCol {
+		return nil, errors.New("dummy error")
+	}
+	rev, _ := mP.ReadRevision(ctx, mCl, objId, 1, dbName, colName)
+	return &appDb.Page[*appDb.RevisionDoc]{Items: []*appDb.RevisionDoc{rev}}, nil
+}
+
+// ReadRevision knows of revision 1 and of the current version 2 of any post
+func (mP *MockPost) ReadRevision(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, n int64, dbName, colName string) (*appDb.RevisionDoc, error) {
+	if dbName == fakeDbName && colName != fakePostCol {
+		return nil, errors.New("dummy error")
+	}
+	switch n {
+	case 1:
+		post := &appDb.PostDoc{Id: objId, Content: "fake content", Author: "fake author", Version: 1}
+		return &appDb.RevisionDoc{PostId: objId, Revision: 1, Post: post}, nil
+	case 2:
+		post := &appDb.PostDoc{Id: objId, Content: "fake content\nmore fake content", Author: "fake author", Version: 2}
+		return &appDb.RevisionDoc{PostId: objId, Revision: 2, Post: post}, nil
+	case 3:
+		post := &appDb.PostDoc{Id: objId, Content: strings.Repeat("fake content\n", appConstants.MaxDiffLines), Author: "fake author", Version: 3}
+		return &appDb.RevisionDoc{PostId: objId, Revision: 3, Post: post}, nil
+	case 4:
+		post := &appDb.PostDoc{Id: objId, Content: "fake content", Status: appDb.StatusScheduled, Version: 4}
+		return &appDb.RevisionDoc{PostId: objId, Revision: 4, Post: post}, nil
+	default:
+		return nil, mongo.ErrNoDocuments
+	}
+}
+
+func (mP *MockPost) RestoreRevision(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, n, version int64, dbName, colName string) error {
+	if version > 2 {
+		return appDb.ErrVersionMismatch
+	}
+	rev, err := mP.ReadRevision(ctx, mCl, objId, n, dbName, colName)
+	if err != nil {
+		return err
+	}
+	return rev.Post.CheckSchedule()
+}
+
+func (mP *MockPost) AddReaction(ctx context.Context, mCl *mongo.Client, objId, authorId primitive.ObjectID, reactionType, dbName, colName string) error {
+	if dbName == fakeDbName && colName != fakePostCol {
 		return errors.New("dummy error")
 	}
-	return nil
+	return mockAddReaction(reactionType)
+}
+
+func (mP *MockPost) RemoveReaction(ctx context.Context, mCl *mongo.Client, objId, authorId primitive.ObjectID, reactionType, dbName, colName string) error {
+	if dbName == fakeDbName && colName != fakePostCol {
+		return errors.New("dummy error")
+	}
+	return mockRemoveReaction(reactionType)
+}
+
+func (mP *MockPost) CountTags(ctx context.Context, mCl *mongo.Client, limit int64, dbName, colName string) ([]*appDb.TagCount, error) {
+	if dbName == fakeDbName && colName != fakePostCol {
+		return nil, errors.New("dummy error")
+	}
+	out := []*appDb.TagCount{{Tag: "go", Count: 2}, {Tag: "mongodb", Count: 1}}
+	if int64(len(out)) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+// PublishScheduled has a single post to publish
+func (mP *MockPost) PublishScheduled(ctx context.Context, mCl *mongo.Client, now time.Time, dbName, colName string) (int64, error) {
+	if dbName == fakeDbName && colName != fakePostCol {
+		return 0, errors.New("dummy error")
+	}
+	return 1, nil
+}
+
+func (mP *MockPost) SetAuthor(author *appDb.AuthorDoc) {
+	mP.Author = author.Name
+}
+
+func (mP *MockPost) GetAuthorId() string {
+	return mP.AuthorId
 }
 
 type MockComment struct {
-	Id      primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
-	Content string             `json:"content,omitempty" bson:"content,omitempty"`
-	Author  string             `json:"author,omitempty" bson:"author,omitempty"`
-	PostId  primitive.ObjectID `json:"postId,omitempty" bson:"post,omitempty"`
+	Id       primitive.ObjectID  `json:"id,omitempty" bson:"_id,omitempty"`
+	Content  string              `json:"content,omitempty" bson:"content,omitempty"`
+	Format   appDb.Format        `json:"format,omitempty" bson:"format,omitempty"`
+	AuthorId string              `json:"authorId,omitempty" bson:"authorId,omitempty"`
+	Author   string              `json:"author,omitempty" bson:"author,omitempty"`
+	PostId   primitive.ObjectID  `json:"postId,omitempty" bson:"post,omitempty"`
+	ParentId string              `json:"parentId,omitempty" bson:"parentId,omitempty"`
+	Status   appDb.CommentStatus `json:"status,omitempty" bson:"status,omitempty"`
 }
 
-func (mC *MockComment) CreateComment(mCl *mongo.Client, dbName, colName string) (*mongo.InsertOneResult, error) {
+func (mC *MockComment) CreateComment(ctx context.Context, mCl *mongo.Client, dbName, colName, pColName string) (*mongo.InsertOneResult, error) {
 	if dbName == fakeDbName {
 		out := &mongo.InsertOneResult{}
 		if colName != fakeCommentCol {
@@ -101,7 +472,19 @@ func (mC *MockComment) CreateComment(mCl *mongo.Client, dbName, colName string)
 	return &mongo.InsertOneResult{}, nil
 }
 
-func (mC *MockComment) ReadComment(mCl *mongo.Client, objId primitive.ObjectID, dbName, colName string) (*appDb.CommentDoc, error) {
+func (mC *MockComment) CreateComments(ctx context.Context, mCl *mongo.Client, comments []*appDb.CommentDoc, ordered bool, dbName, colName, pColName string) ([]*appDb.BulkResult, error) {
+	if dbName == fakeDbName && colName != fakeCommentCol {
+		return nil, errors.New("dummy error")
+	}
+	return mockBulk(len(comments), ordered, func(i int) (primitive.ObjectID, error) {
+		if comments[i].Content == fakeDuplicateContent {
+			return primitive.NilObjectID, duplicateKeyError
+		}
+		return getObjId(fakeCommentObjIdHex), nil
+	}), nil
+}
+
+func (mC *MockComment) ReadComment(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, dbName, colName string) (*appDb.CommentDoc, error) {
 	if dbName == fakeDbName {
 		out := new(appDb.CommentDoc)
 		if colName != fakePostCol && colName != fakeCommentCol {
@@ -110,14 +493,32 @@ func (mC *MockComment) ReadComment(mCl *mongo.Client, objId primitive.ObjectID,
 			}
 			return out, errors.New("dummy ReadComment error")
 		}
-		res, _ := bson.Marshal(bson.M{"_id": objId, "content": "fake content", "author": "fake author", "postId": fakePostObjIdHex})
+		doc := bson.M{"_id": objId, "content": "fake content", "author": "fake author", "postId": fakePostObjIdHex, "version": 1}
+		switch objId.Hex() {
+		case fakeForeignCommentObjIdHex:
+			doc["postId"] = "000000000000000000000000"
+		case fakePendingObjIdHex:
+			doc["authorId"], doc["status"] = getObjId(fakeAuthorObjIdHex), appDb.CommentPending
+		}
+		res, _ := bson.Marshal(doc)
 		_ = bson.Unmarshal(res, out)
 		return out, nil
 	}
 	return &appDb.CommentDoc{}, nil
 }
 
-func (mC *MockComment) UpdateComment(mCl *mongo.Client, objId primitive.ObjectID, dbName, colName string) error {
+func (mC *MockComment) ReadCommentFields(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, projection appDb.Projection, dbName, colName string) (*appDb.CommentDoc, error) {
+	out, err := mC.ReadComment(ctx, mCl, objId, dbName, colName)
+	if err != nil {
+		return out, err
+	}
+	return out, mockProject(out, projection)
+}
+
+func (mC *MockComment) ReplaceComment(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, version int64, dbName, colName string) error {
+	if version > 1 {
+		return appDb.ErrVersionMismatch
+	}
 	if dbName == fakeDbName && colName != fakePostCol && colName != fakeCommentCol {
 		if colName == "NoDocs" {
 			return mongo.ErrNoDocuments
@@ -126,7 +527,23 @@ func (mC *MockComment) UpdateComment(mCl *mongo.Client, objId primitive.ObjectID
 	return nil
 }
 
-func (mC *MockComment) DeleteComment(mCl *mongo.Client, objId primitive.ObjectID, dbName, colName string) error {
+func (mC *MockComment) PatchComment(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, patch map[string]any, version int64, dbName, colName string) error {
+	if version > 1 {
+		return appDb.ErrVersionMismatch
+	}
+	if dbName == fakeDbName && colName != fakeCommentCol {
+		return errors.New("dummy error")
+	}
+	if _, ok := patch["id"]; ok {
+		return fmt.Errorf("%w: field %q cannot be patched", appDb.ErrInvalidPatch, "id")
+	}
+	return nil
+}
+
+func (mC *MockComment) DeleteComment(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, version int64, dbName, colName, pColName string) error {
+	if version > 1 {
+		return appDb.ErrVersionMismatch
+	}
 	if dbName == fakeDbName && colName != fakePostCol && colName != fakeCommentCol {
 		if colName == "NoDocs" {
 			return mongo.ErrNoDocuments
@@ -136,6 +553,323 @@ func (mC *MockComment) DeleteComment(mCl *mongo.Client, objId primitive.ObjectID
 	return nil
 }
 
+func (mC *MockComment) DeleteComments(ctx context.Context, mCl *mongo.Client, objIds []primitive.ObjectID, ordered bool, dbName, colName, pColName string) ([]*appDb.BulkResult, error) {
+	if dbName == fakeDbName && colName != fakeCommentCol {
+		return nil, errors.New("dummy error")
+	}
+	return mockBulk(len(objIds), ordered, func(i int) (primitive.ObjectID, error) {
+		if objIds[i].Hex() == fakeMissingObjIdHex {
+			return primitive.NilObjectID, mongo.ErrNoDocuments
+		}
+		return objIds[i], nil
+	}), nil
+}
+
+func (mC *MockComment) ListPostComments(ctx context.Context, mCl *mongo.Client, postId primitive.ObjectID, query *appDb.ListQuery, limit int64, dbName, colName string) (*appDb.Page[*appDb.CommentDoc], error) {
+	if dbName == fakeDbName && colName != fakeCommentCol {
+		return nil, errors.New("dummy error")
+	}
+	out := &appDb.Page[*appDb.CommentDoc]{Items: []*appDb.CommentDoc{}}
+	if query.IsFirstPage() {
+		out.Items = append(out.Items, &appDb.CommentDoc{Id: getObjId(fakeCommentObjIdHex), Content: "fake content", Author: "fake author", PostId: postId.Hex()})
+		if query.Sort()[0].Value == -1 {
+			out.Next = fakeCommentObjIdHex
+		}
+	}
+	return out, nil
+}
+
+func (mC *MockComment) ListAuthorComments(ctx context.Context, mCl *mongo.Client, authorId primitive.ObjectID, viewer *primitive.ObjectID, query *appDb.ListQuery, limit int64, dbName, colName, pColName string) (*appDb.Page[*appDb.CommentDoc], error) {
+	if dbName == fakeDbName && colName != fakeCommentCol {
+		return nil, errors.New("dummy error")
+	}
+	out := &appDb.Page[*appDb.CommentDoc]{Items: []*appDb.CommentDoc{}}
+	if query.IsFirstPage() {
+		out.Items = append(out.Items, &appDb.CommentDoc{Id: getObjId(fakeCommentObjIdHex), Content: "fake content", AuthorId: &authorId, Author: "fake author", PostId: fakePostObjIdHex})
+		// comments of the draft are only listed to its author
+		if viewer != nil && viewer.Hex() == fakeAuthorObjIdHex {
+			out.Items = append(out.Items, &appDb.CommentDoc{Id: getObjId(fakeReplyObjIdHex), Content: "fake content", AuthorId: &authorId, Author: "fake author", PostId: fakeDraftObjIdHex})
+		}
+	}
+	return out, nil
+}
+
+func (mC *MockComment) AddReaction(ctx context.Context, mCl *mongo.Client, objId, authorId primitive.ObjectID, reactionType, dbName, colName string) error {
+	if dbName == fakeDbName && colName != fakeCommentCol {
+		return errors.New("dummy error")
+	}
+	return mockAddReaction(reactionType)
+}
+
+func (mC *MockComment) RemoveReaction(ctx context.Context, mCl *mongo.Client, objId, authorId primitive.ObjectID, reactionType, dbName, colName string) error {
+	if dbName == fakeDbName && colName != fakeCommentCol {
+		return errors.New("dummy error")
+	}
+	return mockRemoveReaction(reactionType)
+}
+
+func (mC *MockComment) ReadCommentTree(ctx context.Context, mCl *mongo.Client, postId primitive.ObjectID, maxDepth int64, dbName, colName string) ([]*appDb.CommentNode, error) {
+	if dbName == fakeDbName && colName != fakeCommentCol {
+		return nil, errors.New("dummy error")
+	}
+	root := &appDb.CommentNode{CommentDoc: &appDb.CommentDoc{Id: getObjId(fakeCommentObjIdHex), Content: "fake content", PostId: postId.Hex()}}
+	if maxDepth > 0 {
+		reply := &appDb.CommentDoc{Id: getObjId(fakeReplyObjIdHex), Content: "fake reply", PostId: postId.Hex(), ParentId: fakeCommentObjIdHex, Depth: 1}
+		root.Replies = []*appDb.CommentNode{{CommentDoc: reply}}
+	}
+	return []*appDb.CommentNode{root}, nil
+}
+
+// ListModerationQueue lists a single comment with the status asked for
+func (mC *MockComment) ListModerationQueue(ctx context.Context, mCl *mongo.Client, status appDb.CommentStatus, cursor primitive.ObjectID, limit int64, dbName, colName string) (*appDb.Page[*appDb.CommentDoc], error) {
+	if dbName == fakeDbName && colName != fakeCommentCol {
+		return nil, errors.New("dummy error")
+	}
+	out := &appDb.Page[*appDb.CommentDoc]{Items: []*appDb.CommentDoc{}}
+	if cursor.IsZero() {
+		out.Items = append(out.Items, &appDb.CommentDoc{Id: getObjId(fakePendingObjIdHex), Content: "fake content", Author: "fake author", PostId: fakePostObjIdHex, Status: status})
+	}
+	return out, nil
+}
+
+func (mC *MockComment) ModerateComment(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, status appDb.CommentStatus, reason string, dbName, colName, pColName string) error {
+	if status == appDb.CommentRejected && reason == "" {
+		return appDb.ErrReasonRequired
+	}
+	if objId.Hex() == fakeMissingObjIdHex {
+		return mongo.ErrNoDocuments
+	}
+	if dbName == fakeDbName && colName != fakeCommentCol {
+		return errors.New("dummy error")
+	}
+	return nil
+}
+
+func (mC *MockComment) ReplyTo(parent *appDb.CommentDoc) {
+	mC.ParentId = parent.Id.Hex()
+}
+
+func (mC *MockComment) SetAuthor(author *appDb.AuthorDoc) {
+	mC.Author = author.Name
+}
+
+func (mC *MockComment) SetStatus(status appDb.CommentStatus) {
+	mC.Status = status
+}
+
 func (mC *MockComment) GetRelatedPostId() string {
+	if !mC.PostId.IsZero() {
+		return mC.PostId.Hex()
+	}
 	return fakePostObjIdHex
 }
+
+func (mC *MockComment) GetParentId() string {
+	return mC.ParentId
+}
+
+func (mC *MockComment) GetAuthorId() string {
+	return mC.AuthorId
+}
+
+func NewMockAuthor() appDb.Author {
+	return new(MockAuthor)
+}
+
+type MockAuthor struct {
+	Id   primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Name string             `json:"name,omitempty" bson:"name,omitempty"`
+}
+
+// duplicateKeyError mimics the error MongoDB returns when a unique index is violated
+var duplicateKeyError = mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000, Message: "E11000 duplicate key error"}}}
+
+func (mA *MockAuthor) CreateAuthor(ctx context.Context, mCl *mongo.Client, dbName, colName string) (*mongo.InsertOneResult, error) {
+	switch mA.Name {
+	case "":
+		return nil, appDb.ErrAuthorNameRequired
+	case fakeTakenAuthorName:
+		return nil, duplicateKeyError
+	}
+	if dbName == fakeDbName {
+		out := &mongo.InsertOneResult{}
+		if colName != fakeAuthorCol {
+			return out, errors.New("dummy error")
+		}
+		out.InsertedID = getObjId(fakeAuthorObjIdHex)
+		return out, nil
+	}
+	return &mongo.InsertOneResult{}, nil
+}
+
+func (mA *MockAuthor) ReadAuthor(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, dbName, colName string) (*appDb.AuthorDoc, error) {
+	if objId.Hex() == fakeMissingObjIdHex {
+		return new(appDb.AuthorDoc), mongo.ErrNoDocuments
+	}
+	if dbName == fakeDbName && colName != fakeAuthorCol {
+		if colName == "NoDocs" {
+			return new(appDb.AuthorDoc), mongo.ErrNoDocuments
+		}
+		return new(appDb.AuthorDoc), errors.New("dummy error")
+	}
+	return &appDb.AuthorDoc{Id: objId, Name: "fake author", Version: 1}, nil
+}
+
+func (mA *MockAuthor) ReplaceAuthor(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, version int64, dbName, colName, pColName, cColName string) error {
+	if version > 1 {
+		return appDb.ErrVersionMismatch
+	}
+	switch mA.Name {
+	case "":
+		return appDb.ErrAuthorNameRequired
+	case fakeTakenAuthorName:
+		return duplicateKeyError
+	}
+	if dbName == fakeDbName && (pColName != fakePostCol || cColName != fakeCommentCol) {
+		return errors.New("dummy error")
+	}
+	return nil
+}
+
+func (mA *MockAuthor) DeleteAuthor(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, version int64, dbName, colName, pColName, cColName string) error {
+	if version > 1 {
+		return appDb.ErrVersionMismatch
+	}
+	if objId.Hex() == fakeBusyAuthorObjIdHex {
+		return appDb.ErrAuthorInUse
+	}
+	if dbName == fakeDbName && (pColName != fakePostCol || cColName != fakeCommentCol) {
+		return errors.New("dummy error")
+	}
+	return nil
+}
+
+func (mA *MockAuthor) ListAuthors(ctx context.Context, mCl *mongo.Client, cursor primitive.ObjectID, limit int64, dbName, colName string) (*appDb.Page[*appDb.AuthorDoc], error) {
+	if dbName == fakeDbName && colName != fakeAuthorCol {
+		return nil, errors.New("dummy error")
+	}
+	out := &appDb.Page[*appDb.AuthorDoc]{Items: []*appDb.AuthorDoc{}}
+	if cursor.IsZero() {
+		out.Items = append(out.Items, &appDb.AuthorDoc{Id: getObjId(fakeAuthorObjIdHex), Name: "fake author"})
+		if limit == 1 {
+			out.Next = fakeAuthorObjIdHex
+		}
+	}
+	return out, nil
+}
+
+func NewMockSearch() appDb.Search {
+	return new(MockSearch)
+}
+
+type MockSearch struct{}
+
+// Search finds the fake post and comment, ranked in that order, for any query
+func (mS *MockSearch) Search(ctx context.Context, mCl *mongo.Client, q, hitType string, offset, limit int64, dbName, pColName, cColName string) (*appDb.Page[*appDb.SearchHit], error) {
+	if dbName == fakeDbName && (pColName != fakePostCol || cColName != fakeCommentCol) {
+		return nil, errors.New("dummy error")
+	}
+	hits := []*appDb.SearchHit{
+		{Type: appDb.HitPost, Id: getObjId(fakePostObjIdHex), Author: "fake author", Snippet: "fake <mark>content</mark>", Score: 1.5},
+		{Type: appDb.HitComment, Id: getObjId(fakeCommentObjIdHex), PostId: fakePostObjIdHex, Author: "fake author", Snippet: "fake <mark>content</mark>", Score: 0.75},
+	}
+	out := &appDb.Page[*appDb.SearchHit]{Items: []*appDb.SearchHit{}}
+	for _, h := range hits {
+		if hitType == "" || h.Type == hitType {
+			out.Items = append(out.Items, h)
+		}
+	}
+	if offset < int64(len(out.Items)) {
+		out.Items = out.Items[offset:]
+	} else {
+		out.Items = []*appDb.SearchHit{}
+	}
+	if int64(len(out.Items)) > limit {
+		out.Items = out.Items[:limit]
+		out.Next = fmt.Sprint(offset + limit)
+	}
+	return out, nil
+}
+
+// mockAddReaction acts as if every author had already reacted with love to any post or comment
+func mockAddReaction(reactionType string) error {
+	switch reactionType {
+	case "love":
+		return appDb.ErrAlreadyReacted
+	case "like", "laugh", "wow", "sad", "angry":
+		return nil
+	default:
+		return appDb.ErrInvalidReaction
+	}
+}
+
+func mockRemoveReaction(reactionType string) error {
+	switch reactionType {
+	case "love":
+		return nil
+	case "like", "laugh", "wow", "sad", "angry":
+		return mongo.ErrNoDocuments
+	default:
+		return appDb.ErrInvalidReaction
+	}
+}
+
+func NewMockTransfer() appDb.Transfer {
+	return new(MockTransfer)
+}
+
+type MockTransfer struct{}
+
+// fakeExport is what MockTransfer exports
+const fakeExport = `{"type":"author","doc":{"_id":{"$oid":"` + fakeAuthorObjIdHex + `"},"name":"fake author"}}
+{"type":"post","doc":{"_id":{"$oid":"` + fakePostObjIdHex + `"},"content":"fake content","authorId":{"$oid":"` + fakeAuthorObjIdHex + `"}}}
+`
+
+func (mT *MockTransfer) Export(ctx context.Context, mCl *mongo.Client, w io.Writer, dbName, aColName, pColName, cColName string) error {
+	if dbName == fakeDbName && pColName != fakePostCol {
+		return errors.New("dummy error")
+	}
+	_, err := io.WriteString(w, fakeExport)
+	return err
+}
+
+// Import counts the lines of r as inserted, or updated when upsert is set
+func (mT *MockTransfer) Import(ctx context.Context, mCl *mongo.Client, r io.Reader, upsert, keepIds bool, dbName, aColName, pColName, cColName string) (*appDb.ImportReport, error) {
+	if dbName == fakeDbName && pColName != fakePostCol {
+		return nil, errors.New("dummy error")
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var n int64
+	for _, line := range strings.Split(string(b), "\n") {
+		if strings.TrimSpace(line) != "" {
+			n++
+		}
+	}
+	out := new(appDb.ImportReport)
+	if upsert {
+		out.Updated = n
+	} else {
+		out.Inserted = n
+	}
+	return out, nil
+}
+
+// mockBulk runs the n items of a bulk operation through item, which returns the id of the
+// document it stands for or why it failed. Ordered operations skip the items after a failed one
+func mockBulk(n int, ordered bool, item func(i int) (primitive.ObjectID, error)) []*appDb.BulkResult {
+	out := make([]*appDb.BulkResult, n)
+	failed := false
+	for i := range out {
+		if failed && ordered {
+			out[i] = &appDb.BulkResult{Err: appDb.ErrSkipped}
+			continue
+		}
+		id, err := item(i)
+		out[i] = &appDb.BulkResult{Id: id, Err: err}
+		failed = failed || err != nil
+	}
+	return out
+}
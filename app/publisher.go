@@ -0,0 +1,71 @@
+package app
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	appConstants "github.com/gjbastidas/GoSimpleAPIWithMongoDB/constants"
+	appDb "github.com/gjbastidas/GoSimpleAPIWithMongoDB/models"
+	"go.mongodb.org/mongo-driver/mongo"
+	"k8s.io/klog"
+)
+
+// publisher publishes scheduled posts once their publishAt time comes, checking every interval.
+// Many instances of the app can run one, publishing a post twice does nothing
+type publisher struct {
+	newPost         appDb.PostFactory
+	mCl             *mongo.Client
+	interval        time.Duration
+	dbName, colName string
+	done            chan struct{}
+	wg              sync.WaitGroup
+}
+
+func newPublisher(newPost appDb.PostFactory, mCl *mongo.Client, interval time.Duration, dbName, colName string) *publisher {
+	return &publisher{
+		newPost:  newPost,
+		mCl:      mCl,
+		interval: interval,
+		dbName:   dbName,
+		colName:  colName,
+		done:     make(chan struct{}),
+	}
+}
+
+// start publishes the posts due right away and then every interval, until stop is called
+func (pb *publisher) start() {
+	pb.wg.Add(1)
+	go func() {
+		defer pb.wg.Done()
+		ticker := time.NewTicker(pb.interval)
+		defer ticker.Stop()
+		for {
+			pb.publishDue()
+			select {
+			case <-ticker.C:
+			case <-pb.done:
+				return
+			}
+		}
+	}()
+}
+
+func (pb *publisher) publishDue() {
+	ctx, cancel := context.WithTimeout(context.Background(), appConstants.RequestTimeout)
+	defer cancel()
+	n, err := pb.newPost().PublishScheduled(ctx, pb.mCl, time.Now().UTC(), pb.dbName, pb.colName)
+	if err != nil {
+		klog.Errorf("cannot publish scheduled posts: %v", err)
+		return
+	}
+	if n > 0 {
+		klog.Infof("%d scheduled posts published", n)
+	}
+}
+
+// stop waits for the publishing in progress to be done
+func (pb *publisher) stop() {
+	close(pb.done)
+	pb.wg.Wait()
+}
@@ -0,0 +1,108 @@
+package app
+
+import (
+	"container/list"
+	"sync"
+
+	appDb "github.com/gjbastidas/GoSimpleAPIWithMongoDB/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// renderPost renders the content of a post as HTML, or reads it from the cache when the same
+// version was rendered before
+func (a *App) renderPost(p *appDb.PostDoc) (string, error) {
+	if html, ok := a.renders.get(p.Id, p.Version); ok {
+		return html, nil
+	}
+	html, err := appDb.RenderHTML(p.Format, p.Content)
+	if err != nil {
+		return "", err
+	}
+	a.renders.put(p.Id, p.Version, html)
+	return html, nil
+}
+
+// renderEntry is the HTML of a version of a post. Updates change the version of a post, so
+// entries are never served stale, even when the post is updated by another instance of the app
+type renderEntry struct {
+	id      primitive.ObjectID
+	version int64
+	html    string
+}
+
+// renderCache keeps the HTML of the posts rendered last, up to size of them. A nil renderCache
+// keeps nothing
+type renderCache struct {
+	size    int
+	mu      sync.Mutex
+	order   *list.List // most recently used first
+	entries map[primitive.ObjectID]*list.Element
+}
+
+func newRenderCache(size int) *renderCache {
+	return &renderCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[primitive.ObjectID]*list.Element),
+	}
+}
+
+// get returns the HTML of version of the post id, when kept
+func (c *renderCache) get(id primitive.ObjectID, version int64) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[id]
+	if !ok || e.Value.(*renderEntry).version != version {
+		return "", false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*renderEntry).html, true
+}
+
+// put keeps the HTML of version of the post id, in place of any other version of it
+func (c *renderCache) put(id primitive.ObjectID, version int64, html string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := &renderEntry{id: id, version: version, html: html}
+	if e, ok := c.entries[id]; ok {
+		e.Value = entry
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[id] = c.order.PushFront(entry)
+	if c.order.Len() > c.size {
+		last := c.order.Back()
+		c.order.Remove(last)
+		delete(c.entries, last.Value.(*renderEntry).id)
+	}
+}
+
+// invalidate drops the HTML of the post id
+func (c *renderCache) invalidate(id primitive.ObjectID) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[id]; ok {
+		c.order.Remove(e)
+		delete(c.entries, id)
+	}
+}
+
+// clear drops the HTML of every post
+func (c *renderCache) clear() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	c.entries = make(map[primitive.ObjectID]*list.Element)
+}
@@ -0,0 +1,117 @@
+package app
+
+import (
+	"context"
+	"sync"
+
+	appConstants "github.com/gjbastidas/GoSimpleAPIWithMongoDB/constants"
+	appDb "github.com/gjbastidas/GoSimpleAPIWithMongoDB/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"k8s.io/klog"
+)
+
+// thumbnailJob asks for the thumbnails of an image attached to a post
+type thumbnailJob struct {
+	postId primitive.ObjectID
+	fileId primitive.ObjectID
+}
+
+// thumbnailer makes the thumbnails of attached images in the background. It has a bounded number
+// of workers and a bounded queue, so uploads never wait for it: images coming while the queue is
+// full are left without thumbnails
+type thumbnailer struct {
+	newPost         appDb.PostFactory
+	mCl             *mongo.Client
+	sizes           []int
+	workers         int
+	dbName, colName string
+	jobs            chan thumbnailJob
+	wg              sync.WaitGroup
+	// mu guards stopped, so nothing is sent on jobs once closed
+	mu      sync.Mutex
+	stopped bool
+}
+
+func newThumbnailer(newPost appDb.PostFactory, mCl *mongo.Client, sizes []int, workers int, dbName, colName string) *thumbnailer {
+	return &thumbnailer{
+		newPost: newPost,
+		mCl:     mCl,
+		sizes:   sizes,
+		workers: workers,
+		dbName:  dbName,
+		colName: colName,
+		jobs:    make(chan thumbnailJob, appConstants.ThumbnailQueue),
+	}
+}
+
+// start runs the workers, until stop is called
+func (t *thumbnailer) start() {
+	for i := 0; i < t.workers; i++ {
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			for job := range t.jobs {
+				t.process(job)
+			}
+		}()
+	}
+}
+
+func (t *thumbnailer) process(job thumbnailJob) {
+	ctx, cancel := context.WithTimeout(context.Background(), appConstants.ThumbnailTimeout)
+	defer cancel()
+	err := t.newPost().AddThumbnails(ctx, t.mCl, job.postId, job.fileId, t.sizes, t.dbName, t.colName)
+	if err != nil {
+		klog.Errorf("cannot make thumbnails of attachment %v of post %v: %v", job.fileId.Hex(), job.postId.Hex(), err)
+	}
+}
+
+// stop waits for the queued jobs to be done. Images enqueued afterwards, by requests still
+// running, are left without thumbnails
+func (t *thumbnailer) stop() {
+	t.mu.Lock()
+	t.stopped = true
+	close(t.jobs)
+	t.mu.Unlock()
+	t.wg.Wait()
+}
+
+// enqueue asks for the thumbnails of an image without waiting, telling whether there was room
+// for it in the queue. A nil thumbnailer makes no thumbnails
+func (t *thumbnailer) enqueue(job thumbnailJob) bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopped {
+		klog.Warningf("thumbnailer is stopped, attachment %v of post %v is left without thumbnails", job.fileId.Hex(), job.postId.Hex())
+		return false
+	}
+	select {
+	case t.jobs <- job:
+		return true
+	default:
+		klog.Warningf("thumbnail queue is full, attachment %v of post %v is left without thumbnails", job.fileId.Hex(), job.postId.Hex())
+		return false
+	}
+}
+
+// thumbnailSizes returns the sizes thumbnails are made in
+func (t *thumbnailer) thumbnailSizes() []int {
+	if t == nil {
+		return nil
+	}
+	return t.sizes
+}
+
+// hasSize tells whether thumbnails are made in size
+func (t *thumbnailer) hasSize(size int) bool {
+	for _, s := range t.thumbnailSizes() {
+		if s == size {
+			return true
+		}
+	}
+	return false
+}
@@ -2,11 +2,47 @@ package app
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"strconv"
+	"strings"
 
+	appConstants "github.com/gjbastidas/GoSimpleAPIWithMongoDB/constants"
+	appDb "github.com/gjbastidas/GoSimpleAPIWithMongoDB/models"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"k8s.io/klog"
 )
 
+// reactionBody is the request body of reaction endpoints
+type reactionBody struct {
+	Type     string `json:"type"`
+	AuthorId string `json:"authorId"`
+}
+
+// moderationBody is the request body of moderation endpoints
+type moderationBody struct {
+	Reason string `json:"reason"`
+}
+
+// bulkItem is the outcome of one item of a bulk request
+type bulkItem struct {
+	Id     string `json:"id,omitempty"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// bulkResponse is the response body of bulk endpoints, holding an item per item of the request
+type bulkResponse struct {
+	Errors bool        `json:"errors"`
+	Items  []*bulkItem `json:"items"`
+}
+
 // jsonPrint prints output in json format
 func jsonPrint(w http.ResponseWriter, code int, res any) {
 	w.Header().Add("Content-Type", "application/json")
@@ -22,3 +58,522 @@ func jsonPrintError(w http.ResponseWriter, code int, errMsj, consoleMsj string)
 	klog.Errorf(consoleMsj+": %v", errMsj)
 	jsonPrint(w, code, map[string]string{"error": errMsj})
 }
+
+// pageParams reads the cursor and limit query parameters used by list endpoints
+func pageParams(r *http.Request) (primitive.ObjectID, int64, error) {
+	q := r.URL.Query()
+
+	cursor := primitive.NilObjectID
+	if c := q.Get("cursor"); c != "" {
+		var err error
+		cursor, err = primitive.ObjectIDFromHex(c)
+		if err != nil {
+			return cursor, 0, err
+		}
+	}
+
+	limit, err := limitParam(r)
+	return cursor, limit, err
+}
+
+// offsetPageParams reads the cursor and limit query parameters of endpoints paged by offset,
+// where the cursor is the number of results to skip
+func offsetPageParams(r *http.Request) (int64, int64, error) {
+	var offset int64
+	if c := r.URL.Query().Get("cursor"); c != "" {
+		var err error
+		offset, err = strconv.ParseInt(c, 10, 64)
+		if err != nil || offset < 0 || offset > appConstants.MaxSearchOffset {
+			return 0, 0, fmt.Errorf("cursor must be a number between 0 and %d", appConstants.MaxSearchOffset)
+		}
+	}
+
+	limit, err := limitParam(r)
+	return offset, limit, err
+}
+
+func limitParam(r *http.Request) (int64, error) {
+	return pageSizeParam(r, "limit")
+}
+
+// pageSizeParam reads the query parameter name, which holds the size of a page
+func pageSizeParam(r *http.Request, name string) (int64, error) {
+	limit := appConstants.DefaultPageLimit
+	if l := r.URL.Query().Get(name); l != "" {
+		var err error
+		limit, err = strconv.ParseInt(l, 10, 64)
+		if err != nil || limit < 1 || limit > appConstants.MaxPageLimit {
+			return 0, fmt.Errorf("%v must be a number between 1 and %d", name, appConstants.MaxPageLimit)
+		}
+	}
+	return limit, nil
+}
+
+// expandParams reads the documents the expand query parameter asks to embed in a post, and
+// the commentsLimit one sizing the page of comments embedded
+func expandParams(r *http.Request) ([]string, int64, error) {
+	var expand []string
+	if e := r.URL.Query().Get("expand"); e != "" {
+		for _, name := range strings.Split(e, ",") {
+			switch name = strings.TrimSpace(name); name {
+			case appDb.ExpandComments, appDb.ExpandAuthor:
+				expand = append(expand, name)
+			default:
+				return nil, 0, fmt.Errorf("expand takes a comma separated list of %v and %v", appDb.ExpandComments, appDb.ExpandAuthor)
+			}
+		}
+	}
+	commentsLimit, err := pageSizeParam(r, "commentsLimit")
+	return expand, commentsLimit, err
+}
+
+// viewerParam reads the id of the author making the request, nil when anonymous. Posts not
+// published yet and comments not approved are only shown to their author. The header is taken
+// as sent, it is up to a proxy in front of the app to authenticate it
+func viewerParam(r *http.Request) (*primitive.ObjectID, error) {
+	h := strings.TrimSpace(r.Header.Get(appConstants.AuthorHeader))
+	if h == "" {
+		return nil, nil
+	}
+	objId, err := primitive.ObjectIDFromHex(h)
+	if err != nil {
+		return nil, err
+	}
+	return &objId, nil
+}
+
+// moderationStatusParam reads the status of the comments a moderation queue lists, pending when missing
+func moderationStatusParam(r *http.Request) (appDb.CommentStatus, error) {
+	switch s := appDb.CommentStatus(r.URL.Query().Get("status")); s {
+	case "":
+		return appDb.CommentPending, nil
+	case appDb.CommentPending, appDb.CommentRejected:
+		return s, nil
+	}
+	return "", fmt.Errorf("status must be one of %v, %v", appDb.CommentPending, appDb.CommentRejected)
+}
+
+// renderParam tells whether the content of a document is asked rendered as HTML
+func renderParam(r *http.Request) (bool, error) {
+	switch r.URL.Query().Get("render") {
+	case "":
+		return false, nil
+	case "html":
+		return true, nil
+	}
+	return false, errors.New("render must be html")
+}
+
+// boolParam reads a boolean query parameter, which is def when missing
+func boolParam(r *http.Request, name string, def bool) (bool, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%v must be either true or false", name)
+	}
+	return b, nil
+}
+
+// fieldsParam reads the fields query parameter, selecting the fields out of names documents are
+// returned with
+func fieldsParam(r *http.Request, names appDb.FieldNames) (appDb.Projection, error) {
+	return appDb.NewProjection(r.URL.Query().Get("fields"), names)
+}
+
+// listQueryParams reads the query parameters filtering and sorting list endpoints, along with
+// the fields, cursor and limit ones. Lists take a filter expression, shortcut parameters for the
+// author and creation time, and a sort where oldest and newest stand for ascending and descending ids
+func listQueryParams(r *http.Request, fields appDb.QueryFields, names appDb.FieldNames) (*appDb.ListQuery, int64, error) {
+	q := r.URL.Query()
+	query := appDb.NewListQuery(fields)
+
+	projection, err := fieldsParam(r, names)
+	if err != nil {
+		return nil, 0, err
+	}
+	query.Select(projection)
+
+	sort := q.Get("sort")
+	switch sort {
+	case "oldest":
+		sort = "id"
+	case "newest":
+		sort = "-id"
+	}
+	err = query.SortBy(sort)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = query.AddFilter(q.Get("filter"))
+	if err != nil {
+		return nil, 0, err
+	}
+	shortcuts := []struct{ param, field, op string }{
+		{"author", "author", "eq"},
+		{"createdAfter", "createdAt", "gt"},
+		{"createdBefore", "createdAt", "lt"},
+	}
+	for _, s := range shortcuts {
+		if v := q.Get(s.param); v != "" {
+			err = query.Where(s.field, s.op, v)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+
+	err = query.After(q.Get("cursor"))
+	if err != nil {
+		return nil, 0, err
+	}
+	limit, err := limitParam(r)
+	return query, limit, err
+}
+
+// tagModeParam tells whether the tagMode query parameter asks for posts having any of the
+// requested tags, instead of all of them
+func tagModeParam(r *http.Request) (bool, error) {
+	switch r.URL.Query().Get("tagMode") {
+	case "", "all":
+		return false, nil
+	case "any":
+		return true, nil
+	default:
+		return false, errors.New("tagMode must be either all or any")
+	}
+}
+
+// decodeBulk reads the json array of items of a bulk request
+func decodeBulk[T any](r *http.Request) ([]T, error) {
+	var items []T
+	err := json.NewDecoder(r.Body).Decode(&items)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 || len(items) > appConstants.MaxBulkItems {
+		return nil, fmt.Errorf("a bulk request takes between 1 and %d items", appConstants.MaxBulkItems)
+	}
+	return items, nil
+}
+
+// bulkObjIds reads the ids of a bulk request, named what in errors. Along with the outcome of the
+// ids failing, it returns the valid ones and where they are in idStrs. In ordered mode the ids
+// following an invalid one are left out
+func bulkObjIds(idStrs []string, what string, ordered bool) ([]*bulkItem, []primitive.ObjectID, []int) {
+	items := make([]*bulkItem, len(idStrs))
+	objIds, at := make([]primitive.ObjectID, 0, len(idStrs)), make([]int, 0, len(idStrs))
+	for i, idStr := range idStrs {
+		objId, err := primitive.ObjectIDFromHex(idStr)
+		if err != nil {
+			items[i] = &bulkItem{Status: http.StatusBadRequest, Error: fmt.Sprintf("invalid %v id: %v", what, err)}
+			if ordered {
+				break
+			}
+			continue
+		}
+		objIds, at = append(objIds, objId), append(at, i)
+	}
+	return items, objIds, at
+}
+
+// bulkRead reads the document an item of a bulk request refers to, named what in errors.
+// Failures are returned as the outcome of the item
+func bulkRead[D any](idStr, what string, read func(objId primitive.ObjectID) (D, error)) (D, *bulkItem) {
+	var out D
+	objId, err := primitive.ObjectIDFromHex(idStr)
+	if err != nil {
+		return out, &bulkItem{Status: http.StatusBadRequest, Error: fmt.Sprintf("invalid %v id: %v", what, err)}
+	}
+	out, err = read(objId)
+	switch err {
+	case nil:
+		return out, nil
+	case mongo.ErrNoDocuments:
+		return out, &bulkItem{Status: http.StatusNotFound, Error: fmt.Sprintf("not found %v with id: %v", what, idStr)}
+	default:
+		return out, &bulkItem{Status: http.StatusInternalServerError, Error: err.Error()}
+	}
+}
+
+// memo caches the results of read, so the documents items of a bulk request share are read only once
+func memo[D any](read func(idStr string) (D, *bulkItem)) func(idStr string) (D, *bulkItem) {
+	type result struct {
+		doc  D
+		item *bulkItem
+	}
+	seen := make(map[string]result)
+	return func(idStr string) (D, *bulkItem) {
+		r, ok := seen[idStr]
+		if !ok {
+			r.doc, r.item = read(idStr)
+			seen[idStr] = r
+		}
+		return r.doc, r.item
+	}
+}
+
+// bulkItemOf turns the outcome of an item of a bulk operation into its response, with
+// status code okCode when it went well
+func bulkItemOf(res *appDb.BulkResult, okCode int) *bulkItem {
+	switch {
+	case res.Err == nil:
+		return &bulkItem{Id: res.Id.Hex(), Status: okCode}
+	case errors.Is(res.Err, appDb.ErrSkipped):
+		return &bulkItem{Status: http.StatusFailedDependency, Error: res.Err.Error()}
+	case errors.Is(res.Err, mongo.ErrNoDocuments):
+		return &bulkItem{Status: http.StatusNotFound, Error: res.Err.Error()}
+	case mongo.IsDuplicateKeyError(res.Err):
+		return &bulkItem{Status: http.StatusConflict, Error: res.Err.Error()}
+	default:
+		return &bulkItem{Status: http.StatusInternalServerError, Error: res.Err.Error()}
+	}
+}
+
+// bulkResponseOf gathers the outcome of every item of a bulk request. Items left without one,
+// or following a failed item in ordered mode, were skipped
+func bulkResponseOf(items []*bulkItem, ordered bool) *bulkResponse {
+	out := &bulkResponse{Items: items}
+	for i, item := range items {
+		if item == nil || (ordered && out.Errors) {
+			items[i] = bulkItemOf(&appDb.BulkResult{Err: appDb.ErrSkipped}, 0)
+		}
+		out.Errors = out.Errors || items[i].Error != ""
+	}
+	return out
+}
+
+// importParams reads whether an import replaces the records already stored instead of
+// skipping them, and whether it keeps the ids of the records instead of giving them new ones
+func importParams(r *http.Request) (bool, bool, error) {
+	q := r.URL.Query()
+	var upsert, keepIds bool
+	switch q.Get("mode") {
+	case "", "skip":
+	case "upsert":
+		upsert = true
+	default:
+		return false, false, errors.New("mode must be either skip or upsert")
+	}
+	switch q.Get("ids") {
+	case "", "keep":
+		keepIds = true
+	case "regenerate":
+	default:
+		return false, false, errors.New("ids must be either keep or regenerate")
+	}
+	return upsert, keepIds, nil
+}
+
+// ndjsonWriter writes the body of a newline-delimited JSON response. Headers are only sent
+// on the first write, so until then the response can still become an error
+type ndjsonWriter struct {
+	w       http.ResponseWriter
+	started bool
+}
+
+func (nw *ndjsonWriter) Write(p []byte) (int, error) {
+	nw.start()
+	return nw.w.Write(p)
+}
+
+// start sends the headers of the response, unless they were already sent
+func (nw *ndjsonWriter) start() {
+	if nw.started {
+		return
+	}
+	nw.started = true
+	nw.w.Header().Set("Content-Type", appConstants.NDJSONContentType)
+	nw.w.WriteHeader(http.StatusOK)
+}
+
+// filePart finds the file field of a multipart form, leaving the body positioned at its content.
+// On failure it also returns the status code to answer with
+func filePart(r *http.Request) (*multipart.Part, int, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, http.StatusUnsupportedMediaType, errors.New("content type must be multipart/form-data")
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, http.StatusBadRequest, errors.New("form must have a file field")
+		}
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, http.StatusRequestEntityTooLarge, err
+		}
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		if part.FormName() == "file" {
+			return part, 0, nil
+		}
+		part.Close()
+	}
+}
+
+// attachmentIds reads the post and file ids of attachment endpoints, answering with an error
+// when they are invalid
+func attachmentIds(w http.ResponseWriter, r *http.Request) (primitive.ObjectID, primitive.ObjectID, bool) {
+	vars := mux.Vars(r)
+	objId, err := primitive.ObjectIDFromHex(vars["id"])
+	if err != nil {
+		jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid post id")
+		return objId, objId, false
+	}
+	fileId, err := primitive.ObjectIDFromHex(vars["fileId"])
+	if err != nil {
+		jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid attachment id")
+		return objId, fileId, false
+	}
+	return objId, fileId, true
+}
+
+// decodeMergePatch reads a JSON merge patch (RFC 7396) from the request body.
+// On failure it also returns the status code to answer with
+func decodeMergePatch(r *http.Request) (map[string]any, int, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != appConstants.MergePatchContentType {
+		return nil, http.StatusUnsupportedMediaType, fmt.Errorf("content type must be %v", appConstants.MergePatchContentType)
+	}
+
+	var patch map[string]any
+	err = json.NewDecoder(r.Body).Decode(&patch)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if patch == nil {
+		return nil, http.StatusBadRequest, errors.New("merge patch must be a json object")
+	}
+	return patch, 0, nil
+}
+
+// setETag exposes the version of a document as its entity tag
+func setETag(w http.ResponseWriter, version int64) {
+	if version != 0 {
+		w.Header().Set("ETag", strconv.Quote(strconv.FormatInt(version, 10)))
+	}
+}
+
+// errInvalidIfMatch is returned by ifMatch for malformed If-Match headers
+var errInvalidIfMatch = errors.New("If-Match must be * or a list of entity tags as returned in ETag")
+
+// ifMatch reads the document version the If-Match header expects, which conditional writes are
+// made on. It returns 0, meaning any version, when the header is missing or "*". When it lists
+// several versions, current reads the version of the stored document, which is returned when
+// listed. If-Match compares entity tags strongly (RFC 9110), so weak ones never match, and
+// appDb.ErrVersionMismatch is returned when no listed tag can match
+func ifMatch(r *http.Request, current func() (int64, error)) (int64, error) {
+	h := strings.TrimSpace(strings.Join(r.Header.Values("If-Match"), ","))
+	if h == "" || h == "*" {
+		return 0, nil
+	}
+	versions, err := entityTagVersions(h)
+	if err != nil {
+		return 0, err
+	}
+
+	switch len(versions) {
+	case 0:
+		return 0, appDb.ErrVersionMismatch
+	case 1:
+		// the conditional write checks the version itself
+		return versions[0], nil
+	}
+	version, err := current()
+	if err != nil {
+		return 0, err
+	}
+	for _, v := range versions {
+		if v == version {
+			return version, nil
+		}
+	}
+	return 0, appDb.ErrVersionMismatch
+}
+
+// entityTagVersions returns the document versions named by the strong entity tags of h, a comma
+// separated list of entity tags. Weak tags and tags other than versions are left out
+func entityTagVersions(h string) ([]int64, error) {
+	versions := make([]int64, 0)
+	h = strings.TrimLeft(h, " \t,")
+	for h != "" {
+		weak := strings.HasPrefix(h, "W/")
+		if weak {
+			h = h[len("W/"):]
+		}
+		if !strings.HasPrefix(h, `"`) {
+			return nil, errInvalidIfMatch
+		}
+		end := strings.IndexByte(h[1:], '"')
+		if end < 0 {
+			return nil, errInvalidIfMatch
+		}
+		tag := h[1 : end+1]
+		h = strings.TrimLeft(h[end+2:], " \t")
+		if h != "" && h[0] != ',' {
+			return nil, errInvalidIfMatch
+		}
+		h = strings.TrimLeft(h, " \t,")
+
+		if weak {
+			continue
+		}
+		v, err := strconv.ParseInt(tag, 10, 64)
+		if err == nil && v > 0 {
+			versions = append(versions, v)
+		}
+	}
+	return versions, nil
+}
+
+// ifMatchError writes the error ifMatch returned for a document of type docType
+func ifMatchError(w http.ResponseWriter, err error, docType string) {
+	switch {
+	case errors.Is(err, errInvalidIfMatch):
+		jsonPrintError(w, http.StatusBadRequest, err.Error(), "invalid If-Match header")
+	case errors.Is(err, appDb.ErrVersionMismatch):
+		jsonPrintError(w, http.StatusPreconditionFailed, err.Error(), "If-Match does not match the "+docType)
+	case errors.Is(err, mongo.ErrNoDocuments):
+		jsonPrintError(w, http.StatusNotFound, err.Error(), docType+" not found")
+	default:
+		jsonPrintError(w, http.StatusInternalServerError, err.Error(), "cannot read "+docType)
+	}
+}
+
+// postVersion returns the function reading the version of a stored post for ifMatch
+func (a *App) postVersion(r *http.Request, p appDb.Post, objId primitive.ObjectID, dbName, colName string) func() (int64, error) {
+	return func() (int64, error) {
+		stored, err := p.ReadPost(r.Context(), a.mCl, objId, dbName, colName)
+		if err != nil {
+			return 0, err
+		}
+		return stored.Version, nil
+	}
+}
+
+// commentVersion returns the function reading the version of a stored comment for ifMatch
+func (a *App) commentVersion(r *http.Request, c appDb.Comment, objId primitive.ObjectID, dbName, colName string) func() (int64, error) {
+	return func() (int64, error) {
+		stored, err := c.ReadComment(r.Context(), a.mCl, objId, dbName, colName)
+		if err != nil {
+			return 0, err
+		}
+		return stored.Version, nil
+	}
+}
+
+// authorVersion returns the function reading the version of a stored author for ifMatch
+func (a *App) authorVersion(r *http.Request, au appDb.Author, objId primitive.ObjectID, dbName, colName string) func() (int64, error) {
+	return func() (int64, error) {
+		stored, err := au.ReadAuthor(r.Context(), a.mCl, objId, dbName, colName)
+		if err != nil {
+			return 0, err
+		}
+		return stored.Version, nil
+	}
+}
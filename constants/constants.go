@@ -3,9 +3,52 @@ package constants
 import "time"
 
 const (
-	ServerTimeout  = 1 * time.Second           // This is to timeout server shutdown
-	RequestTimeout = 10 * time.Second          // This is to timeout requests
-	DbName         = "simple-api-with-mongodb" // Database name
-	PColl          = "posts"                   // Post collection name
-	CColl          = "comments"                // Comments collection name
+	ServerTimeout    = 1 * time.Second           // This is to timeout server shutdown
+	RequestTimeout   = 10 * time.Second          // This is to timeout requests
+	TransferTimeout  = 30 * time.Minute          // This is to timeout exports, imports and attachment transfers
+	ReconcileTimeout = 5 * time.Minute           // This is to timeout the reconcile command
+	ThumbnailTimeout = 1 * time.Minute           // This is to timeout making the thumbnails of an image
+	PublishInterval  = 1 * time.Minute           // How often scheduled posts due are published
+	DbName           = "simple-api-with-mongodb" // Database name
+	PColl            = "posts"                   // Post collection name
+	CColl            = "comments"                // Comments collection name
+	RColl            = "post_revisions"          // Post revisions collection name
+	AColl            = "authors"                 // Authors collection name
+	ReactColl        = "reactions"               // Reactions to posts and comments collection name
+	AttachmentBucket = "attachments"             // GridFS bucket name of files attached to posts
+
+	MergePatchContentType = "application/merge-patch+json" // Content type of PATCH requests
+	NDJSONContentType     = "application/x-ndjson"         // Content type of exports and imports
+	AuthorHeader          = "X-Author-Id"                  // Header holding the id of the author making a request
+)
+
+const (
+	DefaultPageLimit int64 = 20  // Page size used by list endpoints when no limit is given
+	MaxPageLimit     int64 = 100 // Largest page size a client can request
+
+	DefaultTreeDepth int64 = 5    // Levels of replies returned by comment trees when no maxDepth is given
+	MaxTreeDepth     int64 = 20   // Deepest comment tree a client can request
+	MaxTreeComments  int64 = 1000 // Most comments a comment tree holds
+
+	MaxBulkItems int = 1000 // Most items a bulk request takes
+
+	MaxAttachmentSize int64 = 10 * 1024 * 1024 // Largest file a post can have attached
+	MaxAttachments          = 20               // Most files a post can have attached
+
+	MaxThumbnailPixels int64 = 50 * 1000 * 1000 // Largest image thumbnails are made of
+	ThumbnailQueue           = 100              // Most images waiting for thumbnails, more are left without
+
+	RenderCacheSize = 1000 // Most rendered posts kept in memory
+
+	MaxFilterLength = 1000 // Longest filter expression a list takes
+	MaxFilterDepth  = 5    // Deepest the parentheses of a filter expression can nest
+
+	MaxImportLine       = 32 * 1024 * 1024 // Longest line an import takes, room for the largest MongoDB document as extended JSON
+	MaxImportErrors int = 100              // Most failures an import reports
+
+	MaxDiffLines = 1000 // Most lines of each revision a diff compares
+
+	MaxSearchOffset int64 = 1000 // Deepest result a search can be paged to
+	SnippetLength         = 160  // Characters of content shown around the first match of a search result
+	SnippetContext        = 40   // Characters a snippet keeps before its first match
 )
@@ -9,6 +9,13 @@ type AppConfig struct {
 	DbPassword string `envconfig:"DB_PASSWORD" required:"true"`
 	DbHost     string `envconfig:"DB_HOST" required:"true"`
 	DbPort     string `envconfig:"DB_PORT" required:"true"`
+
+	ThumbnailSizes   []int `envconfig:"THUMBNAIL_SIZES" default:"128,512"`
+	ThumbnailWorkers int   `envconfig:"THUMBNAIL_WORKERS" default:"2"`
+
+	ModerationMode string `envconfig:"MODERATION_MODE" default:"off"`
+	ModeratorToken string `envconfig:"MODERATOR_TOKEN"`
+	AdminToken     string `envconfig:"ADMIN_TOKEN"`
 }
 
 func Config() (*AppConfig, error) {
@@ -1,7 +1,15 @@
 package main
 
-import "github.com/gjbastidas/GoSimpleAPIWithMongoDB/app"
+import (
+	"os"
+
+	"github.com/gjbastidas/GoSimpleAPIWithMongoDB/app"
+)
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		app.Reconcile()
+		return
+	}
 	app.New()
 }
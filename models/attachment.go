@@ -0,0 +1,247 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	appConstants "github.com/gjbastidas/GoSimpleAPIWithMongoDB/constants"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AttachmentTypes are the MIME types files attached to posts can have
+var AttachmentTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp", "application/pdf", "text/plain"}
+
+var (
+	// ErrAttachmentType is returned for files whose content is none of AttachmentTypes
+	ErrAttachmentType = fmt.Errorf("attachment type must be one of %v", strings.Join(AttachmentTypes, ", "))
+	// ErrAttachmentTooLarge is returned for files larger than MaxAttachmentSize
+	ErrAttachmentTooLarge = fmt.Errorf("attachment must not be larger than %d bytes", appConstants.MaxAttachmentSize)
+	// ErrTooManyAttachments is returned when attaching a file to a post already having MaxAttachments
+	ErrTooManyAttachments = fmt.Errorf("a post cannot have more than %d attachments", appConstants.MaxAttachments)
+)
+
+// AttachmentDoc describes a file attached to a post. Posts list them in their attachments field,
+// while files themselves are stored in GridFS under the id of their attachment. Images also list
+// the sizes of their thumbnails once made
+type AttachmentDoc struct {
+	Id          primitive.ObjectID `json:"id" bson:"_id"`
+	Name        string             `json:"name" bson:"name"`
+	ContentType string             `json:"contentType" bson:"contentType"`
+	Size        int64              `json:"size" bson:"size"`
+	Thumbnails  []int              `json:"thumbnails,omitempty" bson:"thumbnails,omitempty"`
+	CreatedAt   *time.Time         `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
+}
+
+// attachmentBucket returns the GridFS bucket of attachments, bound to the deadline of ctx
+func attachmentBucket(ctx context.Context, mCl *mongo.Client, dbName string) (*gridfs.Bucket, error) {
+	bucket, err := gridfs.NewBucket(mCl.Database(dbName), options.GridFSBucket().SetName(appConstants.AttachmentBucket))
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = bucket.SetReadDeadline(deadline)
+		_ = bucket.SetWriteDeadline(deadline)
+	}
+	return bucket, nil
+}
+
+// attachmentType tells the MIME type of a file from its first bytes, refusing the ones not
+// listed in AttachmentTypes. What clients claim is ignored
+func attachmentType(head []byte) (string, error) {
+	mediaType, _, err := mime.ParseMediaType(http.DetectContentType(head))
+	if err != nil || !contains(AttachmentTypes, mediaType) {
+		return "", ErrAttachmentType
+	}
+	return mediaType, nil
+}
+
+// AddAttachment stores the file read from r in GridFS and lists it in the attachments of the post.
+// Like reactions, attachments are kept apart from the content of the post and leave its version alone
+func (p *PostDoc) AddAttachment(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, name string, r io.Reader, dbName, colName string) (*AttachmentDoc, error) {
+	post, err := readOneRecord(ctx, mCl, new(PostDoc), objId, Projection{"attachments": 1}, dbName, colName)
+	if err != nil {
+		return nil, err
+	}
+	if len(post.Attachments) >= appConstants.MaxAttachments {
+		return nil, ErrTooManyAttachments
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	head = head[:n]
+	contentType, err := attachmentType(head)
+	if err != nil {
+		return nil, err
+	}
+
+	bucket, err := attachmentBucket(ctx, mCl, dbName)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	a := &AttachmentDoc{Id: primitive.NewObjectID(), Name: name, ContentType: contentType, CreatedAt: &now}
+	opts := options.GridFSUpload().SetMetadata(bson.M{"postId": objId, "contentType": contentType})
+	us, err := bucket.OpenUploadStreamWithID(a.Id, name, opts)
+	if err != nil {
+		return nil, err
+	}
+	// one byte past the limit tells the file is too large
+	src := io.LimitReader(io.MultiReader(bytes.NewReader(head), r), appConstants.MaxAttachmentSize+1)
+	a.Size, err = io.Copy(us, src)
+	if err == nil && a.Size > appConstants.MaxAttachmentSize {
+		err = ErrAttachmentTooLarge
+	}
+	if err != nil {
+		_ = us.Abort()
+		return nil, err
+	}
+	err = us.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// the post may have been deleted, or got attachments, while the file was uploading
+	filter := bson.M{"_id": objId, fmt.Sprintf("attachments.%d", appConstants.MaxAttachments-1): bson.M{"$exists": false}}
+	res, err := mCl.Database(dbName).Collection(colName).UpdateOne(ctx, filter, bson.M{"$push": bson.M{"attachments": a}})
+	if err == nil && res.MatchedCount == 0 {
+		err = ErrTooManyAttachments
+		if n, cErr := mCl.Database(dbName).Collection(colName).CountDocuments(ctx, bson.M{"_id": objId}); cErr == nil && n == 0 {
+			err = mongo.ErrNoDocuments
+		}
+	}
+	if err != nil {
+		_ = deleteAttachmentFiles(ctx, mCl, bson.M{"_id": a.Id}, dbName)
+		return nil, err
+	}
+	return a, nil
+}
+
+// OpenAttachment returns a file attached to the post, or its thumbnail of size unless size is 0,
+// along with a reader of its content. The reader must be closed
+func (p *PostDoc) OpenAttachment(ctx context.Context, mCl *mongo.Client, objId, fileId primitive.ObjectID, size int, dbName, colName string) (*AttachmentDoc, io.ReadSeekCloser, error) {
+	filter := bson.M{"_id": objId, "attachments._id": fileId}
+	opts := options.FindOne().SetProjection(bson.M{"attachments.$": 1})
+	err := mCl.Database(dbName).Collection(colName).FindOne(ctx, filter, opts).Decode(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	a := p.Attachments[0]
+	if size != 0 {
+		return openThumbnail(ctx, mCl, a, size, dbName)
+	}
+	bucket, err := attachmentBucket(ctx, mCl, dbName)
+	if err != nil {
+		return nil, nil, err
+	}
+	return a, &attachmentReader{bucket: bucket, fileId: fileId, size: a.Size}, nil
+}
+
+// RemoveAttachment deletes a file attached to the post, along with its thumbnails, and within the
+// same transaction removes it from the attachments of the post
+func (p *PostDoc) RemoveAttachment(ctx context.Context, mCl *mongo.Client, objId, fileId primitive.ObjectID, dbName, colName string) error {
+	_, err := withTransaction(ctx, mCl, func(sCtx mongo.SessionContext) (bool, error) {
+		filter := bson.M{"_id": objId, "attachments._id": fileId}
+		update := bson.M{"$pull": bson.M{"attachments": bson.M{"_id": fileId}}}
+		res, err := mCl.Database(dbName).Collection(colName).UpdateOne(sCtx, filter, update)
+		if err != nil {
+			return false, err
+		}
+		if res.MatchedCount == 0 {
+			return false, mongo.ErrNoDocuments
+		}
+		filter = bson.M{"$or": bson.A{bson.M{"_id": fileId}, bson.M{"metadata.thumbnailOf": fileId}}}
+		return true, deleteAttachmentFiles(sCtx, mCl, filter, dbName)
+	})
+	return err
+}
+
+// deleteAttachmentFiles deletes the GridFS files matching filter, along with their chunks.
+// Unlike the methods of gridfs.Bucket, it runs within the transaction of ctx if any
+func deleteAttachmentFiles(ctx context.Context, mCl *mongo.Client, filter bson.M, dbName string) error {
+	db := mCl.Database(dbName)
+	files := db.Collection(appConstants.AttachmentBucket + ".files")
+	fileIds, err := files.Distinct(ctx, "_id", filter)
+	if err != nil || len(fileIds) == 0 {
+		return err
+	}
+	_, err = files.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": fileIds}})
+	if err != nil {
+		return err
+	}
+	_, err = db.Collection(appConstants.AttachmentBucket+".chunks").DeleteMany(ctx, bson.M{"files_id": bson.M{"$in": fileIds}})
+	return err
+}
+
+// attachmentReader reads a GridFS file from any offset, as ranged downloads need. Download streams
+// only go forward, so seeking elsewhere opens a new one on the next read
+type attachmentReader struct {
+	bucket *gridfs.Bucket
+	fileId primitive.ObjectID
+	size   int64
+	offset int64
+	stream *gridfs.DownloadStream
+}
+
+func (ar *attachmentReader) Read(b []byte) (int, error) {
+	if ar.offset >= ar.size {
+		return 0, io.EOF
+	}
+	if ar.stream == nil {
+		stream, err := ar.bucket.OpenDownloadStream(ar.fileId)
+		if err != nil {
+			return 0, err
+		}
+		_, err = stream.Skip(ar.offset)
+		if err != nil {
+			_ = stream.Close()
+			return 0, err
+		}
+		ar.stream = stream
+	}
+	n, err := ar.stream.Read(b)
+	ar.offset += int64(n)
+	return n, err
+}
+
+func (ar *attachmentReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += ar.offset
+	case io.SeekEnd:
+		offset += ar.size
+	}
+	if offset < 0 {
+		return 0, errors.New("cannot seek before the start of the attachment")
+	}
+	if offset != ar.offset {
+		err := ar.Close()
+		if err != nil {
+			return 0, err
+		}
+		ar.offset = offset
+	}
+	return offset, nil
+}
+
+func (ar *attachmentReader) Close() error {
+	if ar.stream == nil {
+		return nil
+	}
+	err := ar.stream.Close()
+	ar.stream = nil
+	return err
+}
@@ -0,0 +1,108 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	// ErrAuthorInUse is returned when deleting an author still referenced by posts or comments
+	ErrAuthorInUse = errors.New("author has posts or comments")
+	// ErrAuthorNameRequired is returned when saving an author without a name
+	ErrAuthorNameRequired = errors.New("author name is required")
+)
+
+type Author interface {
+	CreateAuthor(ctx context.Context, mCl *mongo.Client, dbName, colName string) (*mongo.InsertOneResult, error)
+	ReadAuthor(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, dbName, colName string) (*AuthorDoc, error)
+	ReplaceAuthor(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, version int64, dbName, colName, pColName, cColName string) error
+	DeleteAuthor(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, version int64, dbName, colName, pColName, cColName string) error
+	ListAuthors(ctx context.Context, mCl *mongo.Client, cursor primitive.ObjectID, limit int64, dbName, colName string) (*Page[*AuthorDoc], error)
+}
+
+// AuthorFactory returns an empty Author, see PostFactory
+type AuthorFactory func() Author
+
+func NewAuthor() Author {
+	return new(AuthorDoc)
+}
+
+type AuthorDoc struct {
+	Id        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Name      string             `json:"name,omitempty" bson:"name,omitempty"`
+	Version   int64              `json:"version,omitempty" bson:"version,omitempty"`
+	CreatedAt *time.Time         `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
+	UpdatedAt *time.Time         `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+}
+
+func (a *AuthorDoc) CreateAuthor(ctx context.Context, mCl *mongo.Client, dbName, colName string) (*mongo.InsertOneResult, error) {
+	if a.Name == "" {
+		return nil, ErrAuthorNameRequired
+	}
+	return createOneRecord(ctx, mCl, a, dbName, colName)
+}
+
+func (a *AuthorDoc) ReadAuthor(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, dbName, colName string) (*AuthorDoc, error) {
+	return readOneRecord(ctx, mCl, a, objId, nil, dbName, colName)
+}
+
+// ReplaceAuthor overwrites the stored author and, within the same transaction, refreshes the
+// author name kept in its posts and comments. A version other than 0 must match the stored one
+func (a *AuthorDoc) ReplaceAuthor(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, version int64, dbName, colName, pColName, cColName string) error {
+	if a.Name == "" {
+		return ErrAuthorNameRequired
+	}
+	_, err := withTransaction(ctx, mCl, func(sCtx mongo.SessionContext) (bool, error) {
+		err := replaceOneRecord(sCtx, mCl, a, nil, objId, version, dbName, colName)
+		if err != nil {
+			return false, err
+		}
+		filter := bson.M{"authorId": objId}
+		update := bson.M{"$set": bson.M{"author": a.Name}}
+		for _, c := range []string{pColName, cColName} {
+			_, err = mCl.Database(dbName).Collection(c).UpdateMany(sCtx, filter, update)
+			if err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	})
+	return err
+}
+
+// DeleteAuthor removes the stored author, unless posts or comments still reference it.
+// A version other than 0 must match the stored one
+func (a *AuthorDoc) DeleteAuthor(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, version int64, dbName, colName, pColName, cColName string) error {
+	_, err := withTransaction(ctx, mCl, func(sCtx mongo.SessionContext) (bool, error) {
+		filter := bson.M{"authorId": objId}
+		for _, c := range []string{pColName, cColName} {
+			n, err := mCl.Database(dbName).Collection(c).CountDocuments(sCtx, filter)
+			if err != nil {
+				return false, err
+			}
+			if n > 0 {
+				return false, ErrAuthorInUse
+			}
+		}
+		return true, deleteOneRecord(sCtx, mCl, objId, version, dbName, colName)
+	})
+	return err
+}
+
+func (a *AuthorDoc) ListAuthors(ctx context.Context, mCl *mongo.Client, cursor primitive.ObjectID, limit int64, dbName, colName string) (*Page[*AuthorDoc], error) {
+	return findPage[*AuthorDoc](ctx, mCl, bson.M{}, cursor, limit, false, dbName, colName)
+}
+
+func (a *AuthorDoc) getId() primitive.ObjectID {
+	return a.Id
+}
+
+func (a *AuthorDoc) initialize(now time.Time) {
+	a.Version = 1
+	a.CreatedAt, a.UpdatedAt = &now, &now
+}
@@ -0,0 +1,111 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrSkipped is the outcome of the items of an ordered bulk operation following a failed one
+var ErrSkipped = errors.New("skipped after an earlier item failed")
+
+// errRetryBulk aborts the transaction of a bulk operation where some items failed, see CreateComments
+var errRetryBulk = errors.New("bulk operation to retry without its failed items")
+
+// BulkResult is the outcome of one item of a bulk operation: the id of the document
+// created or deleted, or the error that prevented it
+type BulkResult struct {
+	Id  primitive.ObjectID
+	Err error
+}
+
+// insertManyRecords stores docs with a single InsertMany and reports how each of them went.
+// Ordered inserts stop at the first document failing
+func insertManyRecords[D AnyDoc](ctx context.Context, mCl *mongo.Client, docs []D, ordered bool, dbName, colName string) ([]*BulkResult, error) {
+	if len(docs) == 0 {
+		return []*BulkResult{}, nil
+	}
+	now := time.Now().UTC()
+	records := make([]any, len(docs))
+	for i, d := range docs {
+		d.initialize(now)
+		records[i] = d
+	}
+
+	res, err := mCl.Database(dbName).Collection(colName).InsertMany(ctx, records, options.InsertMany().SetOrdered(ordered))
+	var bwe mongo.BulkWriteException
+	if err != nil && (!errors.As(err, &bwe) || bwe.WriteConcernError != nil || res == nil) {
+		return nil, err
+	}
+
+	out := make([]*BulkResult, len(docs))
+	for i := range out {
+		id, _ := res.InsertedIDs[i].(primitive.ObjectID)
+		out[i] = &BulkResult{Id: id}
+	}
+	failed := len(docs)
+	for _, we := range bwe.WriteErrors {
+		// kept as a WriteException so mongo.IsDuplicateKeyError and such still work
+		out[we.Index] = &BulkResult{Err: mongo.WriteException{WriteErrors: mongo.WriteErrors{we.WriteError}}}
+		if we.Index < failed {
+			failed = we.Index
+		}
+	}
+	if ordered {
+		for i := failed + 1; i < len(out); i++ {
+			out[i] = &BulkResult{Err: ErrSkipped}
+		}
+	}
+	return out, nil
+}
+
+// deleteManyRecords removes the documents with the given ids with a single DeleteMany and reports
+// how each of them went. It also returns the deleted documents, holding only the given fields.
+// Ordered deletes stop at the first document missing
+func deleteManyRecords[D AnyDoc](ctx context.Context, mCl *mongo.Client, objIds []primitive.ObjectID, ordered bool, fields bson.M, dbName, colName string) ([]*BulkResult, []D, error) {
+	deleted := make([]D, 0)
+	if len(objIds) == 0 {
+		return []*BulkResult{}, deleted, nil
+	}
+	filter := bson.M{"_id": bson.M{"$in": objIds}}
+	stored, err := findManyRecords[D](ctx, mCl, filter, options.Find().SetProjection(fields), dbName, colName)
+	if err != nil {
+		return nil, nil, err
+	}
+	byId := make(map[primitive.ObjectID]D, len(stored))
+	for _, d := range stored {
+		byId[d.getId()] = d
+	}
+
+	out := make([]*BulkResult, len(objIds))
+	ids, failed := make([]primitive.ObjectID, 0, len(stored)), false
+	for i, id := range objIds {
+		// a repeated id is missing by the time it is deleted again
+		d, ok := byId[id]
+		switch {
+		case failed && ordered:
+			out[i] = &BulkResult{Err: ErrSkipped}
+		case !ok:
+			out[i] = &BulkResult{Err: mongo.ErrNoDocuments}
+			failed = true
+		default:
+			out[i] = &BulkResult{Id: id}
+			deleted, ids = append(deleted, d), append(ids, id)
+			delete(byId, id)
+		}
+	}
+	if len(ids) == 0 {
+		return out, deleted, nil
+	}
+
+	_, err = mCl.Database(dbName).Collection(colName).DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, deleted, nil
+}
@@ -1,41 +1,327 @@
 package models
 
 import (
+	"context"
+	"errors"
+	"time"
+
+	appConstants "github.com/gjbastidas/GoSimpleAPIWithMongoDB/constants"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type Comment interface {
-	CreateComment(mCl *mongo.Client, dbName, colName string) (*mongo.InsertOneResult, error)
-	ReadComment(mCl *mongo.Client, objId primitive.ObjectID, dbName, colName string) (*CommentDoc, error)
-	UpdateComment(mCl *mongo.Client, objId primitive.ObjectID, dbName, colName string) error
-	DeleteComment(mCl *mongo.Client, objId primitive.ObjectID, dbName, colName string) error
+	CreateComment(ctx context.Context, mCl *mongo.Client, dbName, colName, pColName string) (*mongo.InsertOneResult, error)
+	CreateComments(ctx context.Context, mCl *mongo.Client, comments []*CommentDoc, ordered bool, dbName, colName, pColName string) ([]*BulkResult, error)
+	ReadComment(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, dbName, colName string) (*CommentDoc, error)
+	ReadCommentFields(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, projection Projection, dbName, colName string) (*CommentDoc, error)
+	ReplaceComment(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, version int64, dbName, colName string) error
+	PatchComment(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, patch map[string]any, version int64, dbName, colName string) error
+	DeleteComment(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, version int64, dbName, colName, pColName string) error
+	DeleteComments(ctx context.Context, mCl *mongo.Client, objIds []primitive.ObjectID, ordered bool, dbName, colName, pColName string) ([]*BulkResult, error)
+	ListPostComments(ctx context.Context, mCl *mongo.Client, postId primitive.ObjectID, query *ListQuery, limit int64, dbName, colName string) (*Page[*CommentDoc], error)
+	ListAuthorComments(ctx context.Context, mCl *mongo.Client, authorId primitive.ObjectID, viewer *primitive.ObjectID, query *ListQuery, limit int64, dbName, colName, pColName string) (*Page[*CommentDoc], error)
+	AddReaction(ctx context.Context, mCl *mongo.Client, objId, authorId primitive.ObjectID, reactionType, dbName, colName string) error
+	RemoveReaction(ctx context.Context, mCl *mongo.Client, objId, authorId primitive.ObjectID, reactionType, dbName, colName string) error
+	ReadCommentTree(ctx context.Context, mCl *mongo.Client, postId primitive.ObjectID, maxDepth int64, dbName, colName string) ([]*CommentNode, error)
+	ListModerationQueue(ctx context.Context, mCl *mongo.Client, status CommentStatus, cursor primitive.ObjectID, limit int64, dbName, colName string) (*Page[*CommentDoc], error)
+	ModerateComment(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, status CommentStatus, reason string, dbName, colName, pColName string) error
+	ReplyTo(parent *CommentDoc)
+	SetAuthor(author *AuthorDoc)
+	SetStatus(status CommentStatus)
 	GetRelatedPostId() string
+	GetParentId() string
+	GetAuthorId() string
+}
+
+// CommentFactory returns an empty Comment, see PostFactory
+type CommentFactory func() Comment
+
+func NewComment() Comment {
+	return new(CommentDoc)
+}
+
+var commentPatchRules = patchRules{
+	"content": stringValue,
+	"format":  formatValue,
 }
 
+// commentKeepFields cannot be changed once a comment is created. Besides its author, reactions
+// and moderation, they place the comment in a post and thread, see ReplyTo
+var commentKeepFields = []string{"authorId", "author", "reactions", "postId", "detachedFrom", "parentId", "ancestors", "depth", "status", "statusReason", "moderatedAt"}
+
 type CommentDoc struct {
-	Id      primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
-	Content string             `json:"content,omitempty" bson:"content,omitempty"`
-	Author  string             `json:"author,omitempty" bson:"author,omitempty"`
-	PostId  string             `json:"postId,omitempty" bson:"postId,omitempty"`
+	Id           primitive.ObjectID  `json:"id,omitempty" bson:"_id,omitempty"`
+	Content      string              `json:"content,omitempty" bson:"content,omitempty"`
+	Format       Format              `json:"format,omitempty" bson:"format,omitempty"`
+	AuthorId     *primitive.ObjectID `json:"authorId,omitempty" bson:"authorId,omitempty"`
+	Author       string              `json:"author,omitempty" bson:"author,omitempty"`
+	PostId       string              `json:"postId,omitempty" bson:"postId,omitempty"`
+	DetachedFrom string              `json:"detachedFrom,omitempty" bson:"detachedFrom,omitempty"`
+	ParentId     string              `json:"parentId,omitempty" bson:"parentId,omitempty"`
+	Ancestors    []string            `json:"-" bson:"ancestors,omitempty"`
+	Depth        int64               `json:"depth,omitempty" bson:"depth,omitempty"`
+	Reactions    map[string]int64    `json:"reactions,omitempty" bson:"reactions,omitempty"`
+	Status       CommentStatus       `json:"status,omitempty" bson:"status,omitempty"`
+	StatusReason string              `json:"statusReason,omitempty" bson:"statusReason,omitempty"`
+	ModeratedAt  *time.Time          `json:"moderatedAt,omitempty" bson:"moderatedAt,omitempty"`
+	Version      int64               `json:"version,omitempty" bson:"version,omitempty"`
+	CreatedAt    *time.Time          `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
+	UpdatedAt    *time.Time          `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+}
+
+// CreateComment stores the comment and, within the same transaction, counts it in its post.
+// Comments waiting for moderation are counted once approved, see ModerateComment
+func (c *CommentDoc) CreateComment(ctx context.Context, mCl *mongo.Client, dbName, colName, pColName string) (*mongo.InsertOneResult, error) {
+	return withTransaction(ctx, mCl, func(sCtx mongo.SessionContext) (*mongo.InsertOneResult, error) {
+		res, err := createOneRecord(sCtx, mCl, c, dbName, colName)
+		if err != nil || !c.approved() {
+			return res, err
+		}
+		return res, countComments(sCtx, mCl, []*CommentDoc{c}, dbName, pColName)
+	})
+}
+
+// CreateComments stores many comments at once, reporting how each of them went, and counts them in their
+// posts within the same transaction. Ordered creates stop at the first comment failing. Since a failing
+// comment aborts the whole transaction, it is retried without the comments that failed
+func (c *CommentDoc) CreateComments(ctx context.Context, mCl *mongo.Client, comments []*CommentDoc, ordered bool, dbName, colName, pColName string) ([]*BulkResult, error) {
+	out := make([]*BulkResult, len(comments))
+	// indexes in comments of the ones left to store
+	pending := make([]int, len(comments))
+	for i := range pending {
+		pending[i] = i
+	}
+	for len(pending) > 0 {
+		docs := make([]*CommentDoc, len(pending))
+		for j, i := range pending {
+			docs[j] = comments[i]
+		}
+		var results []*BulkResult
+		_, err := withTransaction(ctx, mCl, func(sCtx mongo.SessionContext) (bool, error) {
+			var err error
+			results, err = insertManyRecords(sCtx, mCl, docs, ordered, dbName, colName)
+			if err != nil {
+				return false, err
+			}
+			for _, r := range results {
+				if r.Err != nil {
+					return false, errRetryBulk
+				}
+			}
+			return true, countComments(sCtx, mCl, approvedOf(docs), dbName, pColName)
+		})
+		if err != nil && !errors.Is(err, errRetryBulk) {
+			return nil, err
+		}
+
+		left := make([]int, 0, len(pending))
+		for j, i := range pending {
+			switch {
+			case err == nil:
+				out[i] = results[j]
+			case results[j].Err != nil:
+				out[i] = results[j]
+			default:
+				left = append(left, i)
+			}
+		}
+		pending = left
+	}
+	return out, nil
+}
+
+func (c *CommentDoc) ReadComment(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, dbName, colName string) (*CommentDoc, error) {
+	return readOneRecord(ctx, mCl, c, objId, nil, dbName, colName)
+}
+
+// ReadCommentFields reads a comment with the fields of projection only
+func (c *CommentDoc) ReadCommentFields(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, projection Projection, dbName, colName string) (*CommentDoc, error) {
+	return readOneRecord(ctx, mCl, c, objId, projection, dbName, colName)
+}
+
+// ReplaceComment overwrites the whole stored comment, fields missing from c are removed.
+// Its author, reactions, post, thread and moderation status cannot be changed and are kept from the stored
+// comment, the ones sent in c are dropped. A version other than 0 must match the stored one
+func (c *CommentDoc) ReplaceComment(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, version int64, dbName, colName string) error {
+	c.AuthorId, c.Author = nil, ""
+	c.PostId, c.Status = "", ""
+	c.ParentId, c.Ancestors, c.Depth = "", nil, 0
+	c.dropServerFields()
+	return replaceOneRecord(ctx, mCl, c, commentKeepFields, objId, version, dbName, colName)
+}
+
+// PatchComment applies a JSON merge patch to the stored comment.
+// A version other than 0 must match the stored one
+func (c *CommentDoc) PatchComment(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, patch map[string]any, version int64, dbName, colName string) error {
+	return patchOneRecord(ctx, mCl, patch, commentPatchRules, objId, version, dbName, colName)
+}
+
+// DeleteComment removes the stored comment along with its reactions and, within the same
+// transaction, stops counting it in its post. A version other than 0 must match the stored one
+func (c *CommentDoc) DeleteComment(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, version int64, dbName, colName, pColName string) error {
+	_, err := withTransaction(ctx, mCl, func(sCtx mongo.SessionContext) (bool, error) {
+		deleted, err := findOneAndDeleteRecord(sCtx, mCl, new(CommentDoc), objId, version, dbName, colName)
+		if err != nil {
+			return false, err
+		}
+		err = deleteReactions(sCtx, mCl, []any{objId}, dbName)
+		if err != nil {
+			return false, err
+		}
+		// detached comments and the ones not approved are not counted anywhere
+		if deleted.PostId == "" || !deleted.approved() {
+			return true, nil
+		}
+		return true, uncountComments(sCtx, mCl, deleted.PostId, 1, dbName, colName, pColName)
+	})
+	return err
+}
+
+// DeleteComments removes many comments at once, reporting how each of them went. Their reactions and
+// the counters of their posts follow them like in DeleteComment, all within a single transaction.
+// Ordered deletes stop at the first comment missing
+func (c *CommentDoc) DeleteComments(ctx context.Context, mCl *mongo.Client, objIds []primitive.ObjectID, ordered bool, dbName, colName, pColName string) ([]*BulkResult, error) {
+	return withTransaction(ctx, mCl, func(sCtx mongo.SessionContext) ([]*BulkResult, error) {
+		out, deleted, err := deleteManyRecords[*CommentDoc](sCtx, mCl, objIds, ordered, bson.M{"postId": 1, "status": 1}, dbName, colName)
+		if err != nil || len(deleted) == 0 {
+			return out, err
+		}
+		reacted := make([]any, len(deleted))
+		perPost := make(map[string]int64)
+		for i, d := range deleted {
+			reacted[i] = d.Id
+			// detached comments and the ones not approved are not counted anywhere
+			if d.PostId != "" && d.approved() {
+				perPost[d.PostId]++
+			}
+		}
+		err = deleteReactions(sCtx, mCl, reacted, dbName)
+		if err != nil {
+			return nil, err
+		}
+		for postIdHex, n := range perPost {
+			err = uncountComments(sCtx, mCl, postIdHex, n, dbName, colName, pColName)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	})
 }
 
-func (c *CommentDoc) CreateComment(mCl *mongo.Client, dbName, colName string) (*mongo.InsertOneResult, error) {
-	return createOneRecord(mCl, c, dbName, colName)
+func (c *CommentDoc) ListPostComments(ctx context.Context, mCl *mongo.Client, postId primitive.ObjectID, query *ListQuery, limit int64, dbName, colName string) (*Page[*CommentDoc], error) {
+	return findQueryPage[*CommentDoc](ctx, mCl, bson.M{"postId": postId.Hex()}, query, limit, dbName, colName)
 }
 
-func (c *CommentDoc) ReadComment(mCl *mongo.Client, objId primitive.ObjectID, dbName, colName string) (*CommentDoc, error) {
-	return readOneRecord(mCl, c, objId, dbName, colName)
+// ListAuthorComments lists the comments of an author, leaving out the comments of the posts viewer
+// cannot read, see PostsVisibleTo, which are looked up in pColName
+func (c *CommentDoc) ListAuthorComments(ctx context.Context, mCl *mongo.Client, authorId primitive.ObjectID, viewer *primitive.ObjectID, query *ListQuery, limit int64, dbName, colName, pColName string) (*Page[*CommentDoc], error) {
+	stages := visiblePostStages(viewer, pColName)
+	return aggregateQueryPage[*CommentDoc](ctx, mCl, bson.M{"authorId": authorId}, query, stages, limit, dbName, colName)
 }
 
-func (c *CommentDoc) UpdateComment(mCl *mongo.Client, objId primitive.ObjectID, dbName, colName string) error {
-	return updateOneRecord(mCl, c, objId, dbName, colName)
+func (c *CommentDoc) AddReaction(ctx context.Context, mCl *mongo.Client, objId, authorId primitive.ObjectID, reactionType, dbName, colName string) error {
+	return addReaction(ctx, mCl, objId, authorId, reactionType, dbName, colName)
 }
 
-func (c *CommentDoc) DeleteComment(mCl *mongo.Client, objId primitive.ObjectID, dbName, colName string) error {
-	return deleteOneRecord(mCl, objId, dbName, colName)
+func (c *CommentDoc) RemoveReaction(ctx context.Context, mCl *mongo.Client, objId, authorId primitive.ObjectID, reactionType, dbName, colName string) error {
+	return removeReaction(ctx, mCl, objId, authorId, reactionType, dbName, colName)
+}
+
+// ReadCommentTree returns the comments of a post nested under the comment they reply to, down
+// to maxDepth levels of replies. Replies whose parent is gone hang from their closest ancestor.
+// Comments not approved are left out along with their replies
+func (c *CommentDoc) ReadCommentTree(ctx context.Context, mCl *mongo.Client, postId primitive.ObjectID, maxDepth int64, dbName, colName string) ([]*CommentNode, error) {
+	// root comments have no depth field, hence $not instead of $lte
+	filter := bson.M{"postId": postId.Hex(), "depth": bson.M{"$not": bson.M{"$gt": maxDepth}}, "status": approvedStatus}
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(appConstants.MaxTreeComments)
+	comments, err := findManyRecords[*CommentDoc](ctx, mCl, filter, opts, dbName, colName)
+	if err != nil {
+		return nil, err
+	}
+	return commentTree(comments), nil
+}
+
+// ReplyTo makes c a reply to parent, which must belong to the same post
+func (c *CommentDoc) ReplyTo(parent *CommentDoc) {
+	c.ParentId = parent.Id.Hex()
+	c.Ancestors = append(append([]string{}, parent.Ancestors...), c.ParentId)
+	c.Depth = parent.Depth + 1
+}
+
+// SetStatus sets the moderation status c is created with
+func (c *CommentDoc) SetStatus(status CommentStatus) {
+	c.Status = status
+}
+
+// SetAuthor makes author the author of c, keeping a copy of its name
+func (c *CommentDoc) SetAuthor(author *AuthorDoc) {
+	c.AuthorId, c.Author = &author.Id, author.Name
 }
 
 func (c *CommentDoc) GetRelatedPostId() string {
 	return c.PostId
 }
+
+func (c *CommentDoc) GetParentId() string {
+	return c.ParentId
+}
+
+func (c *CommentDoc) GetAuthorId() string {
+	if c.AuthorId == nil {
+		return ""
+	}
+	return c.AuthorId.Hex()
+}
+
+func (c *CommentDoc) getId() primitive.ObjectID {
+	return c.Id
+}
+
+// dropServerFields drops the reactions and moderation fields clients may have sent, which are only
+// changed by the operations maintaining them
+func (c *CommentDoc) dropServerFields() {
+	c.Reactions, c.DetachedFrom = nil, ""
+	c.StatusReason, c.ModeratedAt = "", nil
+}
+
+// initialize also drops the thread of comments not replying to another one, since only ReplyTo
+// places a comment in a thread
+func (c *CommentDoc) initialize(now time.Time) {
+	c.dropServerFields()
+	if c.ParentId == "" {
+		c.Ancestors, c.Depth = nil, 0
+	}
+	c.Version = 1
+	c.CreatedAt, c.UpdatedAt = &now, &now
+}
+
+// CommentNode is a comment along with its replies
+type CommentNode struct {
+	*CommentDoc
+	Replies []*CommentNode `json:"replies,omitempty"`
+}
+
+// commentTree nests comments, given in creation order, under the comment they reply to
+func commentTree(comments []*CommentDoc) []*CommentNode {
+	nodes := make(map[string]*CommentNode, len(comments))
+	roots := make([]*CommentNode, 0)
+	for _, c := range comments {
+		node := &CommentNode{CommentDoc: c}
+		nodes[c.Id.Hex()] = node
+
+		var parent *CommentNode
+		for i := len(c.Ancestors) - 1; i >= 0 && parent == nil; i-- {
+			parent = nodes[c.Ancestors[i]]
+		}
+		if parent == nil {
+			roots = append(roots, node)
+			continue
+		}
+		parent.Replies = append(parent.Replies, node)
+	}
+	return roots
+}
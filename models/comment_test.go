@@ -0,0 +1,148 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestCommentTree(t *testing.T) {
+	root := &CommentDoc{Id: primitive.NewObjectID(), Content: "root"}
+	other := &CommentDoc{Id: primitive.NewObjectID(), Content: "other root"}
+	reply := &CommentDoc{Id: primitive.NewObjectID(), Content: "reply"}
+	reply.ReplyTo(root)
+	nested := &CommentDoc{Id: primitive.NewObjectID(), Content: "nested reply"}
+	nested.ReplyTo(reply)
+	sibling := &CommentDoc{Id: primitive.NewObjectID(), Content: "sibling reply"}
+	sibling.ReplyTo(root)
+
+	subtests := []struct {
+		name         string
+		comments     []*CommentDoc
+		expectedTree []*CommentNode
+	}{
+		{
+			name:         "empty",
+			expectedTree: []*CommentNode{},
+		},
+		{
+			name:     "nested",
+			comments: []*CommentDoc{root, other, reply, sibling, nested},
+			expectedTree: []*CommentNode{
+				{CommentDoc: root, Replies: []*CommentNode{
+					{CommentDoc: reply, Replies: []*CommentNode{{CommentDoc: nested}}},
+					{CommentDoc: sibling},
+				}},
+				{CommentDoc: other},
+			},
+		},
+		{
+			name:     "missing-parent-hangs-from-closest-ancestor",
+			comments: []*CommentDoc{root, nested},
+			expectedTree: []*CommentNode{
+				{CommentDoc: root, Replies: []*CommentNode{{CommentDoc: nested}}},
+			},
+		},
+		{
+			name:     "missing-ancestors-become-roots",
+			comments: []*CommentDoc{nested, other},
+			expectedTree: []*CommentNode{
+				{CommentDoc: nested},
+				{CommentDoc: other},
+			},
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			assert.Equal(t, st.expectedTree, commentTree(st.comments))
+		})
+	}
+}
+
+func TestReplyTo(t *testing.T) {
+	root := &CommentDoc{Id: primitive.NewObjectID()}
+	reply := &CommentDoc{Id: primitive.NewObjectID()}
+	reply.ReplyTo(root)
+	nested := new(CommentDoc)
+	nested.ReplyTo(reply)
+
+	assert.Equal(t, reply.Id.Hex(), nested.ParentId)
+	assert.Equal(t, []string{root.Id.Hex(), reply.Id.Hex()}, nested.Ancestors)
+	assert.EqualValues(t, 2, nested.Depth)
+	// the ancestors of the parent are copied, not shared
+	assert.Equal(t, []string{root.Id.Hex()}, reply.Ancestors)
+}
+
+func TestReplaceComment(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("server-managed-fields-dropped", func(mt *mtest.T) {
+		now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+		authorId := primitive.NewObjectID()
+		parentId := primitive.NewObjectID().Hex()
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+
+		c := &CommentDoc{
+			Content:      "replaced comment",
+			AuthorId:     &authorId,
+			Author:       "fake author",
+			PostId:       primitive.NewObjectID().Hex(),
+			DetachedFrom: primitive.NewObjectID().Hex(),
+			ParentId:     parentId,
+			Ancestors:    []string{parentId},
+			Depth:        1,
+			Reactions:    map[string]int64{"like": 100},
+			Status:       CommentApproved,
+			StatusReason: "fake reason",
+			ModeratedAt:  &now,
+		}
+		err := c.ReplaceComment(context.Background(), mt.Client, primitive.NewObjectID(), 0, "fakeDb", "fakeCommentCol")
+		if assert.NoError(t, err) {
+			assert.Equal(t, &CommentDoc{Content: "replaced comment"}, c)
+		}
+	})
+}
+
+func TestListAuthorComments(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("comments-of-hidden-posts-left-out", func(mt *mtest.T) {
+		authorId, commentId := primitive.NewObjectID(), primitive.NewObjectID()
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "fakeDb.fakeCommentCol", mtest.FirstBatch,
+			bson.D{{Key: "_id", Value: commentId}, {Key: "content", Value: "fake comment"}},
+		))
+
+		query := NewListQuery(CommentQueryFields)
+		if !assert.NoError(t, query.SortBy("")) {
+			return
+		}
+		page, err := new(CommentDoc).ListAuthorComments(context.Background(), mt.Client, authorId, &authorId, query, 10, "fakeDb", "fakeCommentCol", "fakePostCol")
+		if assert.NoError(t, err) {
+			assert.Equal(t, []*CommentDoc{{Id: commentId, Content: "fake comment"}}, page.Items)
+		}
+
+		aggregate := mt.GetStartedEvent()
+		if assert.Equal(t, "aggregate", aggregate.CommandName) {
+			var cmd struct {
+				Pipeline []bson.D `bson:"pipeline"`
+			}
+			assert.NoError(t, bson.Unmarshal(aggregate.Command, &cmd))
+			stages := make([]string, len(cmd.Pipeline))
+			for i, s := range cmd.Pipeline {
+				stages[i] = s[0].Key
+			}
+			// the posts are looked up before the page is cut
+			assert.Equal(t, []string{"$match", "$sort", "$lookup", "$match", "$unset", "$limit"}, stages)
+			lookup := cmd.Pipeline[2][0].Value.(bson.D).Map()
+			assert.Equal(t, "fakePostCol", lookup["from"])
+		}
+	})
+}
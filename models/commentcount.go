@@ -0,0 +1,165 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// countComments adds newly created comments to the commentCount and lastCommentAt of their posts
+func countComments(ctx context.Context, mCl *mongo.Client, comments []*CommentDoc, dbName, pColName string) error {
+	counted := make(map[string]*PostDoc)
+	for _, c := range comments {
+		p, ok := counted[c.PostId]
+		if !ok {
+			p = new(PostDoc)
+			counted[c.PostId] = p
+		}
+		p.CommentCount++
+		if p.LastCommentAt == nil || c.CreatedAt.After(*p.LastCommentAt) {
+			p.LastCommentAt = c.CreatedAt
+		}
+	}
+
+	updates := make([]mongo.WriteModel, 0, len(counted))
+	for postIdHex, p := range counted {
+		postId, err := primitive.ObjectIDFromHex(postIdHex)
+		if err != nil {
+			return err
+		}
+		update := bson.M{
+			"$inc": bson.M{"commentCount": p.CommentCount},
+			"$max": bson.M{"lastCommentAt": p.LastCommentAt},
+		}
+		updates = append(updates, mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": postId}).SetUpdate(update))
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	res, err := mCl.Database(dbName).Collection(pColName).BulkWrite(ctx, updates)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount < int64(len(updates)) {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// uncountComments removes n deleted comments from the commentCount of their post and sets its
+// lastCommentAt back to the newest approved comment left
+func uncountComments(ctx context.Context, mCl *mongo.Client, postIdHex string, n int64, dbName, colName, pColName string) error {
+	postId, err := primitive.ObjectIDFromHex(postIdHex)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{"$inc": bson.M{"commentCount": -n}}
+	newest := new(CommentDoc)
+	opts := options.FindOne().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetProjection(bson.M{"createdAt": 1})
+	err = mCl.Database(dbName).Collection(colName).FindOne(ctx, bson.M{"postId": postIdHex, "status": approvedStatus}, opts).Decode(newest)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		update["$unset"] = bson.M{"lastCommentAt": ""}
+	case err != nil:
+		return err
+	default:
+		update["$set"] = bson.M{"lastCommentAt": newest.CreatedAt}
+	}
+	_, err = mCl.Database(dbName).Collection(pColName).UpdateOne(ctx, bson.M{"_id": postId}, update)
+	return err
+}
+
+// ReconcileCommentCounts recomputes the commentCount and lastCommentAt of every post from its
+// approved comments and fixes the ones that drifted, returning how many were fixed. Comments created
+// or deleted while it runs may be counted wrong until it runs again
+func ReconcileCommentCounts(ctx context.Context, mCl *mongo.Client, dbName, pColName, cColName string) (int64, error) {
+	db := mCl.Database(dbName)
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"postId": bson.M{"$exists": true}, "status": approvedStatus}}},
+		{{Key: "$group", Value: bson.M{"_id": "$postId", "commentCount": bson.M{"$sum": 1}, "lastCommentAt": bson.M{"$max": "$createdAt"}}}},
+	}
+	cur, err := db.Collection(cColName).Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, err
+	}
+	var counted []struct {
+		PostId        string     `bson:"_id"`
+		CommentCount  int64      `bson:"commentCount"`
+		LastCommentAt *time.Time `bson:"lastCommentAt"`
+	}
+	err = cur.All(ctx, &counted)
+	if err != nil {
+		return 0, err
+	}
+	want := make(map[string]*PostDoc, len(counted))
+	for _, c := range counted {
+		want[c.PostId] = &PostDoc{CommentCount: c.CommentCount, LastCommentAt: c.LastCommentAt}
+	}
+
+	opts := options.Find().SetProjection(bson.M{"commentCount": 1, "lastCommentAt": 1})
+	cur, err = db.Collection(pColName).Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer cur.Close(ctx)
+	var fixes []mongo.WriteModel
+	for cur.Next(ctx) {
+		p := new(PostDoc)
+		err = cur.Decode(p)
+		if err != nil {
+			return 0, err
+		}
+		w, ok := want[p.Id.Hex()]
+		if !ok {
+			w = new(PostDoc)
+		}
+		if p.CommentCount == w.CommentCount && sameTime(p.LastCommentAt, w.LastCommentAt) {
+			continue
+		}
+
+		set, unset := bson.M{}, bson.M{}
+		if w.CommentCount > 0 {
+			set["commentCount"] = w.CommentCount
+		} else {
+			unset["commentCount"] = ""
+		}
+		if w.LastCommentAt != nil {
+			set["lastCommentAt"] = w.LastCommentAt
+		} else {
+			unset["lastCommentAt"] = ""
+		}
+		update := bson.M{}
+		if len(set) > 0 {
+			update["$set"] = set
+		}
+		if len(unset) > 0 {
+			update["$unset"] = unset
+		}
+		fixes = append(fixes, mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": p.Id}).SetUpdate(update))
+	}
+	if err = cur.Err(); err != nil {
+		return 0, err
+	}
+	if len(fixes) == 0 {
+		return 0, nil
+	}
+
+	res, err := db.Collection(pColName).BulkWrite(ctx, fixes, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
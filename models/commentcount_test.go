@@ -0,0 +1,91 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestReconcileCommentCounts(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	ctx := context.Background()
+	drifted, stale, synced := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	older := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	newer := older.Add(time.Hour)
+
+	mt.Run("fixes-drifted-posts", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			// approved comments grouped by post
+			mtest.CreateCursorResponse(0, "fakeDb.fakeCommentCol", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: drifted.Hex()}, {Key: "commentCount", Value: int64(2)}, {Key: "lastCommentAt", Value: newer}},
+				bson.D{{Key: "_id", Value: synced.Hex()}, {Key: "commentCount", Value: int64(1)}, {Key: "lastCommentAt", Value: older}},
+			),
+			// counters of every post
+			mtest.CreateCursorResponse(0, "fakeDb.fakePostCol", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: drifted}, {Key: "commentCount", Value: int64(1)}, {Key: "lastCommentAt", Value: older}},
+				bson.D{{Key: "_id", Value: stale}, {Key: "commentCount", Value: int64(3)}, {Key: "lastCommentAt", Value: older}},
+				bson.D{{Key: "_id", Value: synced}, {Key: "commentCount", Value: int64(1)}, {Key: "lastCommentAt", Value: older}},
+			),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 2}, bson.E{Key: "nModified", Value: 2}),
+		)
+
+		n, err := ReconcileCommentCounts(ctx, mt.Client, "fakeDb", "fakePostCol", "fakeCommentCol")
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.EqualValues(t, 2, n)
+
+		aggregate := mt.GetStartedEvent()
+		if assert.Equal(t, "aggregate", aggregate.CommandName) {
+			var cmd struct {
+				Pipeline []bson.M `bson:"pipeline"`
+			}
+			assert.NoError(t, bson.Unmarshal(aggregate.Command, &cmd))
+			assert.Equal(t, []bson.M{
+				{"$match": bson.M{"postId": bson.M{"$exists": true}, "status": bson.M{"$nin": bson.A{"pending", "rejected"}}}},
+				{"$group": bson.M{"_id": "$postId", "commentCount": bson.M{"$sum": int32(1)}, "lastCommentAt": bson.M{"$max": "$createdAt"}}},
+			}, cmd.Pipeline)
+		}
+		assert.Equal(t, "find", mt.GetStartedEvent().CommandName)
+
+		update := mt.GetStartedEvent()
+		if assert.Equal(t, "update", update.CommandName) {
+			var cmd struct {
+				Updates []bson.M `bson:"updates"`
+			}
+			assert.NoError(t, bson.Unmarshal(update.Command, &cmd))
+			assert.Equal(t, []bson.M{
+				{"q": bson.M{"_id": drifted}, "u": bson.M{"$set": bson.M{"commentCount": int64(2), "lastCommentAt": primitive.NewDateTimeFromTime(newer)}}},
+				{"q": bson.M{"_id": stale}, "u": bson.M{"$unset": bson.M{"commentCount": "", "lastCommentAt": ""}}},
+			}, cmd.Updates)
+		}
+	})
+
+	mt.Run("nothing-drifted", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "fakeDb.fakeCommentCol", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: synced.Hex()}, {Key: "commentCount", Value: int64(1)}, {Key: "lastCommentAt", Value: older}},
+			),
+			mtest.CreateCursorResponse(0, "fakeDb.fakePostCol", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: synced}, {Key: "commentCount", Value: int64(1)}, {Key: "lastCommentAt", Value: older}},
+				bson.D{{Key: "_id", Value: stale}},
+			),
+		)
+
+		n, err := ReconcileCommentCounts(ctx, mt.Client, "fakeDb", "fakePostCol", "fakeCommentCol")
+		if assert.NoError(t, err) {
+			assert.EqualValues(t, 0, n)
+		}
+		mt.GetStartedEvent()
+		mt.GetStartedEvent()
+		// no update is sent
+		assert.Nil(t, mt.GetStartedEvent())
+	})
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Documents a post can be expanded with
+const (
+	ExpandComments = "comments"
+	ExpandAuthor   = "author"
+)
+
+// ExpandedPost is a post along with the documents it was expanded with, and its content
+// rendered as HTML when asked
+type ExpandedPost struct {
+	*PostDoc
+	Comments      *Page[*CommentDoc] `json:"comments,omitempty"`
+	AuthorDetails *AuthorDoc         `json:"authorDetails,omitempty"`
+	ContentHTML   string             `json:"contentHtml,omitempty"`
+}
+
+// ReadPostExpanded reads a post with the fields of projection only, embedding the first page of
+// its approved comments, up to commentsLimit of them, and its author when expand asks for them
+func (p *PostDoc) ReadPostExpanded(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, projection Projection, expand []string, commentsLimit int64, dbName, colName, cColName, aColName string) (*ExpandedPost, error) {
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.M{"_id": objId}}}}
+	if contains(expand, ExpandComments) {
+		// comments keep the id of their post as hex string. One extra comment tells whether there is a next page
+		pipeline = append(pipeline, bson.D{{Key: "$lookup", Value: bson.M{
+			"from": cColName,
+			"let":  bson.M{"postId": bson.M{"$toString": "$_id"}},
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{"$expr": bson.M{"$eq": bson.A{"$postId", "$$postId"}}, "status": approvedStatus}},
+				bson.M{"$sort": bson.M{"_id": 1}},
+				bson.M{"$limit": commentsLimit + 1},
+			},
+			"as": "comments",
+		}}})
+	}
+	if contains(expand, ExpandAuthor) {
+		pipeline = append(pipeline, bson.D{{Key: "$lookup", Value: bson.M{
+			"from":         aColName,
+			"localField":   "authorId",
+			"foreignField": "_id",
+			"as":           "authors",
+		}}})
+	}
+	// lookups run first, so they still see the fields projection leaves out
+	if projection != nil {
+		pipeline = append(pipeline, bson.D{{Key: "$project", Value: projection.with("comments", "authors")}})
+	}
+
+	cur, err := mCl.Database(dbName).Collection(colName).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	found := make([]struct {
+		PostDoc  `bson:",inline"`
+		Comments []*CommentDoc `bson:"comments"`
+		Authors  []*AuthorDoc  `bson:"authors"`
+	}, 0)
+	err = cur.All(ctx, &found)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	doc := found[0]
+	*p = doc.PostDoc
+	out := &ExpandedPost{PostDoc: p}
+	if contains(expand, ExpandComments) {
+		out.Comments = &Page[*CommentDoc]{Items: doc.Comments}
+		if doc.Comments == nil {
+			out.Comments.Items = []*CommentDoc{}
+		}
+		if int64(len(doc.Comments)) > commentsLimit {
+			out.Comments.Items = doc.Comments[:commentsLimit]
+			out.Comments.Next = out.Comments.Items[commentsLimit-1].Id.Hex()
+		}
+	}
+	if len(doc.Authors) > 0 {
+		out.AuthorDetails = doc.Authors[0]
+	}
+	return out, nil
+}
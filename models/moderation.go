@@ -0,0 +1,146 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ModerationMode tells whether the comments of a post wait for a moderator before going live.
+// Posts without mode follow the one the app is configured with
+type ModerationMode string
+
+const (
+	ModerationOff ModerationMode = "off"
+	ModerationPre ModerationMode = "pre"
+)
+
+// ErrInvalidModerationMode is returned for modes other than ModerationOff and ModerationPre
+var ErrInvalidModerationMode = fmt.Errorf("moderation must be one of %v, %v", ModerationOff, ModerationPre)
+
+// CheckModerationMode tells whether m is a moderation mode, empty meaning the configured one
+func CheckModerationMode(m ModerationMode) error {
+	switch m {
+	case "", ModerationOff, ModerationPre:
+		return nil
+	}
+	return ErrInvalidModerationMode
+}
+
+// UnmarshalJSON refuses modes other than ModerationOff and ModerationPre
+func (m *ModerationMode) UnmarshalJSON(b []byte) error {
+	var s string
+	err := json.Unmarshal(b, &s)
+	if err != nil {
+		return err
+	}
+	err = CheckModerationMode(ModerationMode(s))
+	if err != nil {
+		return err
+	}
+	*m = ModerationMode(s)
+	return nil
+}
+
+func moderationValue(v any) (any, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, errors.New("expected a string")
+	}
+	err := CheckModerationMode(ModerationMode(s))
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// CommentStatus tells whether a comment went through moderation. Comments without status are approved
+type CommentStatus string
+
+const (
+	CommentPending  CommentStatus = "pending"
+	CommentApproved CommentStatus = "approved"
+	CommentRejected CommentStatus = "rejected"
+)
+
+// ErrReasonRequired is returned when rejecting a comment without a reason
+var ErrReasonRequired = errors.New("rejecting a comment takes a reason")
+
+// approvedStatus matches the status of the comments that went live. Only those are counted in their posts
+var approvedStatus = bson.M{"$nin": bson.A{CommentPending, CommentRejected}}
+
+func (c *CommentDoc) approved() bool {
+	return c.Status != CommentPending && c.Status != CommentRejected
+}
+
+// approvedOf returns the approved comments out of comments
+func approvedOf(comments []*CommentDoc) []*CommentDoc {
+	out := make([]*CommentDoc, 0, len(comments))
+	for _, c := range comments {
+		if c.approved() {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// VisibleTo tells whether viewer can read the comment. Comments not approved can only be read by
+// their author, and no one else is read when viewer is nil
+func (c *CommentDoc) VisibleTo(viewer *primitive.ObjectID) bool {
+	if c.approved() {
+		return true
+	}
+	return viewer != nil && c.AuthorId != nil && *viewer == *c.AuthorId
+}
+
+// CommentsVisibleTo is the filter of the comments viewer can read, see VisibleTo
+func CommentsVisibleTo(viewer *primitive.ObjectID) bson.M {
+	approved := bson.M{"status": approvedStatus}
+	if viewer == nil {
+		return approved
+	}
+	return bson.M{"$or": bson.A{approved, bson.M{"authorId": *viewer}}}
+}
+
+// ListModerationQueue lists the comments with status, the ones waiting for a moderator when
+// pending, oldest first
+func (c *CommentDoc) ListModerationQueue(ctx context.Context, mCl *mongo.Client, status CommentStatus, cursor primitive.ObjectID, limit int64, dbName, colName string) (*Page[*CommentDoc], error) {
+	return findPage[*CommentDoc](ctx, mCl, bson.M{"status": status}, cursor, limit, false, dbName, colName)
+}
+
+// ModerateComment sets the status of a comment along with the reason of the moderator and, within
+// the same transaction, counts it in its post when approved or stops counting it when rejected.
+// Like counters, moderation does not change the version of the comment
+func (c *CommentDoc) ModerateComment(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, status CommentStatus, reason string, dbName, colName, pColName string) error {
+	if status == CommentRejected && reason == "" {
+		return ErrReasonRequired
+	}
+	update := bson.M{"$set": bson.M{"status": status, "moderatedAt": time.Now().UTC()}}
+	if reason != "" {
+		update["$set"].(bson.M)["statusReason"] = reason
+	} else {
+		update["$unset"] = bson.M{"statusReason": ""}
+	}
+
+	_, err := withTransaction(ctx, mCl, func(sCtx mongo.SessionContext) (bool, error) {
+		before, err := findOneAndUpdateRecord(sCtx, mCl, new(CommentDoc), update, objId, 0, dbName, colName)
+		if err != nil {
+			return false, err
+		}
+		// detached comments are not counted anywhere
+		if before.PostId == "" || before.approved() == (status == CommentApproved) {
+			return true, nil
+		}
+		if status == CommentApproved {
+			return true, countComments(sCtx, mCl, []*CommentDoc{before}, dbName, pColName)
+		}
+		return true, uncountComments(sCtx, mCl, before.PostId, 1, dbName, colName, pColName)
+	})
+	return err
+}
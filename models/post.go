@@ -1,35 +1,311 @@
 package models
 
 import (
+	"context"
+	"io"
+	"time"
+
+	appConstants "github.com/gjbastidas/GoSimpleAPIWithMongoDB/constants"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type Post interface {
-	CreatePost(mCl *mongo.Client, dbName, colName string) (*mongo.InsertOneResult, error)
-	ReadPost(mCl *mongo.Client, objId primitive.ObjectID, dbName, colName string) (*PostDoc, error)
-	UpdatePost(mCl *mongo.Client, objId primitive.ObjectID, dbName, colName string) error
-	DeletePost(mCl *mongo.Client, objId primitive.ObjectID, dbName, colName string) error
+	CreatePost(ctx context.Context, mCl *mongo.Client, dbName, colName string) (*mongo.InsertOneResult, error)
+	CreatePosts(ctx context.Context, mCl *mongo.Client, posts []*PostDoc, ordered bool, dbName, colName string) ([]*BulkResult, error)
+	ReadPost(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, dbName, colName string) (*PostDoc, error)
+	ReadPostFields(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, projection Projection, dbName, colName string) (*PostDoc, error)
+	ReadPostExpanded(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, projection Projection, expand []string, commentsLimit int64, dbName, colName, cColName, aColName string) (*ExpandedPost, error)
+	ReplacePost(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, version int64, dbName, colName string) error
+	PatchPost(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, patch map[string]any, version int64, dbName, colName string) error
+	DeletePost(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, version int64, detachComments bool, dbName, colName, cColName string) (int64, error)
+	DeletePosts(ctx context.Context, mCl *mongo.Client, objIds []primitive.ObjectID, ordered, detachComments bool, dbName, colName, cColName string) ([]*BulkResult, error)
+	ListPosts(ctx context.Context, mCl *mongo.Client, tags []string, anyTag bool, query *ListQuery, limit int64, dbName, colName string) (*Page[*PostDoc], error)
+	ListAuthorPosts(ctx context.Context, mCl *mongo.Client, authorId primitive.ObjectID, query *ListQuery, limit int64, dbName, colName string) (*Page[*PostDoc], error)
+	ListRevisions(ctx context.Context, mCl *mongo.Client, objId, cursor primitive.ObjectID, limit int64, dbName, colName string) (*Page[*RevisionDoc], error)
+	ReadRevision(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, n int64, dbName, colName string) (*RevisionDoc, error)
+	RestoreRevision(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, n, version int64, dbName, colName string) error
+	AddReaction(ctx context.Context, mCl *mongo.Client, objId, authorId primitive.ObjectID, reactionType, dbName, colName string) error
+	RemoveReaction(ctx context.Context, mCl *mongo.Client, objId, authorId primitive.ObjectID, reactionType, dbName, colName string) error
+	AddAttachment(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, name string, r io.Reader, dbName, colName string) (*AttachmentDoc, error)
+	OpenAttachment(ctx context.Context, mCl *mongo.Client, objId, fileId primitive.ObjectID, size int, dbName, colName string) (*AttachmentDoc, io.ReadSeekCloser, error)
+	RemoveAttachment(ctx context.Context, mCl *mongo.Client, objId, fileId primitive.ObjectID, dbName, colName string) error
+	AddThumbnails(ctx context.Context, mCl *mongo.Client, objId, fileId primitive.ObjectID, sizes []int, dbName, colName string) error
+	CountTags(ctx context.Context, mCl *mongo.Client, limit int64, dbName, colName string) ([]*TagCount, error)
+	PublishScheduled(ctx context.Context, mCl *mongo.Client, now time.Time, dbName, colName string) (int64, error)
+	SetAuthor(author *AuthorDoc)
+	GetAuthorId() string
+}
+
+// PostFactory returns an empty Post. Handlers call it once per request so concurrent
+// requests never decode into the same document
+type PostFactory func() Post
+
+func NewPost() Post {
+	return new(PostDoc)
+}
+
+var postPatchRules = patchRules{
+	"content":    stringValue,
+	"format":     formatValue,
+	"tags":       tagsValue,
+	"status":     statusValue,
+	"publishAt":  timeValue,
+	"moderation": moderationValue,
 }
 
+// postKeepFields cannot be changed once a post is created. Its author is set by SetAuthor,
+// its reactions are counted by AddReaction and RemoveReaction, its attachments are listed by
+// AddAttachment and RemoveAttachment and its comments are counted by CreateComment and DeleteComment
+var postKeepFields = []string{"authorId", "author", "reactions", "attachments", "commentCount", "lastCommentAt"}
+
 type PostDoc struct {
-	Id      primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
-	Content string             `json:"content,omitempty" bson:"content,omitempty"`
-	Author  string             `json:"author,omitempty" bson:"author,omitempty"`
+	Id            primitive.ObjectID  `json:"id,omitempty" bson:"_id,omitempty"`
+	Content       string              `json:"content,omitempty" bson:"content,omitempty"`
+	Format        Format              `json:"format,omitempty" bson:"format,omitempty"`
+	AuthorId      *primitive.ObjectID `json:"authorId,omitempty" bson:"authorId,omitempty"`
+	Author        string              `json:"author,omitempty" bson:"author,omitempty"`
+	Tags          []string            `json:"tags,omitempty" bson:"tags,omitempty"`
+	Status        PostStatus          `json:"status,omitempty" bson:"status,omitempty"`
+	PublishAt     *time.Time          `json:"publishAt,omitempty" bson:"publishAt,omitempty"`
+	Moderation    ModerationMode      `json:"moderation,omitempty" bson:"moderation,omitempty"`
+	Reactions     map[string]int64    `json:"reactions,omitempty" bson:"reactions,omitempty"`
+	Attachments   []*AttachmentDoc    `json:"attachments,omitempty" bson:"attachments,omitempty"`
+	CommentCount  int64               `json:"commentCount,omitempty" bson:"commentCount,omitempty"`
+	LastCommentAt *time.Time          `json:"lastCommentAt,omitempty" bson:"lastCommentAt,omitempty"`
+	Version       int64               `json:"version,omitempty" bson:"version,omitempty"`
+	CreatedAt     *time.Time          `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
+	UpdatedAt     *time.Time          `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+}
+
+func (p *PostDoc) CreatePost(ctx context.Context, mCl *mongo.Client, dbName, colName string) (*mongo.InsertOneResult, error) {
+	err := p.CheckSchedule()
+	if err != nil {
+		return nil, err
+	}
+	p.Tags = normalizeTags(p.Tags)
+	return createOneRecord(ctx, mCl, p, dbName, colName)
+}
+
+// CreatePosts stores many posts at once, reporting how each of them went.
+// Ordered creates stop at the first post failing. Posts are expected to pass CheckSchedule
+func (p *PostDoc) CreatePosts(ctx context.Context, mCl *mongo.Client, posts []*PostDoc, ordered bool, dbName, colName string) ([]*BulkResult, error) {
+	for _, d := range posts {
+		d.Tags = normalizeTags(d.Tags)
+	}
+	return insertManyRecords(ctx, mCl, posts, ordered, dbName, colName)
+}
+
+func (p *PostDoc) ReadPost(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, dbName, colName string) (*PostDoc, error) {
+	return readOneRecord(ctx, mCl, p, objId, nil, dbName, colName)
+}
+
+// ReadPostFields reads a post with the fields of projection only
+func (p *PostDoc) ReadPostFields(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, projection Projection, dbName, colName string) (*PostDoc, error) {
+	return readOneRecord(ctx, mCl, p, objId, projection, dbName, colName)
+}
+
+// ReplacePost overwrites the whole stored post, fields missing from p are removed.
+// The author, reactions and comment counters of the post cannot be changed and are kept from the stored post,
+// the ones sent in p are dropped. The replaced version is kept as a revision. A version other than 0 must
+// match the stored one
+func (p *PostDoc) ReplacePost(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, version int64, dbName, colName string) error {
+	p.AuthorId, p.Author = nil, ""
+	p.dropServerFields()
+	err := p.CheckSchedule()
+	if err != nil {
+		return err
+	}
+	p.Tags = normalizeTags(p.Tags)
+	update, err := replacement(p, postKeepFields)
+	if err != nil {
+		return err
+	}
+	return updatePostWithRevision(ctx, mCl, update, nil, objId, version, dbName, colName)
+}
+
+// PatchPost applies a JSON merge patch to the stored post, which must pass CheckSchedule once patched.
+// The patched version is kept as a revision. A version other than 0 must match the stored one
+func (p *PostDoc) PatchPost(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, patch map[string]any, version int64, dbName, colName string) error {
+	update, err := mergePatchUpdate(patch, postPatchRules)
+	if err != nil {
+		return err
+	}
+	check := func(prev *PostDoc) error {
+		return patchedSchedule(prev, update).CheckSchedule()
+	}
+	return updatePostWithRevision(ctx, mCl, versionedUpdate(update), check, objId, version, dbName, colName)
+}
+
+// DeletePost removes the post with its revisions and reactions and, within the same transaction, deletes
+// its comments or detaches them from it when detachComments is set. It returns the number of affected comments.
+// A version other than 0 must match the stored one
+func (p *PostDoc) DeletePost(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, version int64, detachComments bool, dbName, colName, cColName string) (int64, error) {
+	return withTransaction(ctx, mCl, func(sCtx mongo.SessionContext) (int64, error) {
+		err := deleteOneRecord(sCtx, mCl, objId, version, dbName, colName)
+		if err != nil {
+			return 0, err
+		}
+		return deletePostsCascade(sCtx, mCl, []primitive.ObjectID{objId}, detachComments, dbName, cColName)
+	})
+}
+
+// DeletePosts removes many posts at once, reporting how each of them went. Their revisions, reactions
+// and comments follow them like in DeletePost, all within a single transaction.
+// Ordered deletes stop at the first post missing
+func (p *PostDoc) DeletePosts(ctx context.Context, mCl *mongo.Client, objIds []primitive.ObjectID, ordered, detachComments bool, dbName, colName, cColName string) ([]*BulkResult, error) {
+	return withTransaction(ctx, mCl, func(sCtx mongo.SessionContext) ([]*BulkResult, error) {
+		out, deleted, err := deleteManyRecords[*PostDoc](sCtx, mCl, objIds, ordered, bson.M{"_id": 1}, dbName, colName)
+		if err != nil || len(deleted) == 0 {
+			return out, err
+		}
+		postIds := make([]primitive.ObjectID, len(deleted))
+		for i, d := range deleted {
+			postIds[i] = d.Id
+		}
+		_, err = deletePostsCascade(sCtx, mCl, postIds, detachComments, dbName, cColName)
+		return out, err
+	})
+}
+
+// deletePostsCascade deletes the revisions, attached files and reactions of deleted posts, along with their comments
+// or detaching these from them when detachComments is set. It returns the number of affected comments
+func deletePostsCascade(ctx context.Context, mCl *mongo.Client, postIds []primitive.ObjectID, detachComments bool, dbName, cColName string) (int64, error) {
+	db := mCl.Database(dbName)
+	_, err := db.Collection(appConstants.RColl).DeleteMany(ctx, bson.M{"postId": bson.M{"$in": postIds}})
+	if err != nil {
+		return 0, err
+	}
+	err = deleteAttachmentFiles(ctx, mCl, bson.M{"metadata.postId": bson.M{"$in": postIds}}, dbName)
+	if err != nil {
+		return 0, err
+	}
+
+	postIdHexes := make([]string, len(postIds))
+	reacted := make([]any, len(postIds))
+	for i, id := range postIds {
+		postIdHexes[i], reacted[i] = id.Hex(), id
+	}
+	filter := bson.M{"postId": bson.M{"$in": postIdHexes}}
+	if !detachComments {
+		commentIds, err := db.Collection(cColName).Distinct(ctx, "_id", filter)
+		if err != nil {
+			return 0, err
+		}
+		reacted = append(reacted, commentIds...)
+	}
+	err = deleteReactions(ctx, mCl, reacted, dbName)
+	if err != nil {
+		return 0, err
+	}
+
+	if detachComments {
+		// a pipeline update, so each comment moves its own postId to detachedFrom
+		update := mongo.Pipeline{
+			{{Key: "$set", Value: bson.M{
+				"detachedFrom": "$postId",
+				"version":      bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$version", 0}}, 1}},
+				"updatedAt":    "$$NOW",
+			}}},
+			{{Key: "$unset", Value: "postId"}},
+		}
+		res, err := db.Collection(cColName).UpdateMany(ctx, filter, update)
+		if err != nil {
+			return 0, err
+		}
+		return res.ModifiedCount, nil
+	}
+	res, err := db.Collection(cColName).DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+// ListPosts returns a page of the posts matching query. When tags are given, only posts having
+// all of them are listed, or any of them if anyTag is set
+func (p *PostDoc) ListPosts(ctx context.Context, mCl *mongo.Client, tags []string, anyTag bool, query *ListQuery, limit int64, dbName, colName string) (*Page[*PostDoc], error) {
+	filter := bson.M{}
+	if tags = normalizeTags(tags); len(tags) > 0 {
+		op := "$all"
+		if anyTag {
+			op = "$in"
+		}
+		filter["tags"] = bson.M{op: tags}
+	}
+	return findQueryPage[*PostDoc](ctx, mCl, filter, query, limit, dbName, colName)
+}
+
+func (p *PostDoc) ListAuthorPosts(ctx context.Context, mCl *mongo.Client, authorId primitive.ObjectID, query *ListQuery, limit int64, dbName, colName string) (*Page[*PostDoc], error) {
+	return findQueryPage[*PostDoc](ctx, mCl, bson.M{"authorId": authorId}, query, limit, dbName, colName)
+}
+
+// ListRevisions returns the previous versions of a post, newest first
+func (p *PostDoc) ListRevisions(ctx context.Context, mCl *mongo.Client, objId, cursor primitive.ObjectID, limit int64, dbName, colName string) (*Page[*RevisionDoc], error) {
+	return listRevisions(ctx, mCl, objId, cursor, limit, dbName)
+}
+
+// ReadRevision returns revision n of a post, where the current version is the latest revision
+func (p *PostDoc) ReadRevision(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, n int64, dbName, colName string) (*RevisionDoc, error) {
+	return readRevision(ctx, mCl, objId, n, dbName, colName)
+}
+
+// RestoreRevision sets the fields listed in restoredFields back to the ones of revision n, which
+// creates a new version. A version other than 0 must match the stored one
+func (p *PostDoc) RestoreRevision(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, n, version int64, dbName, colName string) error {
+	rev, err := readRevision(ctx, mCl, objId, n, dbName, colName)
+	if err != nil {
+		return err
+	}
+	err = rev.Post.CheckSchedule()
+	if err != nil {
+		return err
+	}
+	update, err := restoreUpdate(rev.Post)
+	if err != nil {
+		return err
+	}
+	return updatePostWithRevision(ctx, mCl, versionedUpdate(update), nil, objId, version, dbName, colName)
+}
+
+// SetAuthor makes author the author of p, keeping a copy of its name
+func (p *PostDoc) SetAuthor(author *AuthorDoc) {
+	p.AuthorId, p.Author = &author.Id, author.Name
+}
+
+func (p *PostDoc) GetAuthorId() string {
+	if p.AuthorId == nil {
+		return ""
+	}
+	return p.AuthorId.Hex()
+}
+
+func (p *PostDoc) AddReaction(ctx context.Context, mCl *mongo.Client, objId, authorId primitive.ObjectID, reactionType, dbName, colName string) error {
+	return addReaction(ctx, mCl, objId, authorId, reactionType, dbName, colName)
+}
+
+func (p *PostDoc) RemoveReaction(ctx context.Context, mCl *mongo.Client, objId, authorId primitive.ObjectID, reactionType, dbName, colName string) error {
+	return removeReaction(ctx, mCl, objId, authorId, reactionType, dbName, colName)
 }
 
-func (p *PostDoc) CreatePost(mCl *mongo.Client, dbName, colName string) (*mongo.InsertOneResult, error) {
-	return createOneRecord(mCl, p, dbName, colName)
+func (p *PostDoc) CountTags(ctx context.Context, mCl *mongo.Client, limit int64, dbName, colName string) ([]*TagCount, error) {
+	return countTags(ctx, mCl, limit, dbName, colName)
 }
 
-func (p *PostDoc) ReadPost(mCl *mongo.Client, objId primitive.ObjectID, dbName, colName string) (*PostDoc, error) {
-	return readOneRecord(mCl, p, objId, dbName, colName)
+func (p *PostDoc) getId() primitive.ObjectID {
+	return p.Id
 }
 
-func (p *PostDoc) UpdatePost(mCl *mongo.Client, objId primitive.ObjectID, dbName, colName string) error {
-	return updateOneRecord(mCl, p, objId, dbName, colName)
+// dropServerFields drops the fields listed in postKeepFields other than the author, which start
+// empty and are only changed by the operations maintaining them
+func (p *PostDoc) dropServerFields() {
+	p.Reactions, p.Attachments = nil, nil
+	p.CommentCount, p.LastCommentAt = 0, nil
 }
 
-func (p *PostDoc) DeletePost(mCl *mongo.Client, objId primitive.ObjectID, dbName, colName string) error {
-	return deleteOneRecord(mCl, objId, dbName, colName)
+func (p *PostDoc) initialize(now time.Time) {
+	p.dropServerFields()
+	p.Version = 1
+	p.CreatedAt, p.UpdatedAt = &now, &now
 }
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestReplacePost(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("server-managed-fields-dropped", func(mt *mtest.T) {
+		now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+		objId, authorId := primitive.NewObjectID(), primitive.NewObjectID()
+		mt.AddMockResponses(
+			// the replaced post, kept as a revision
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.D{{Key: "_id", Value: objId}, {Key: "content", Value: "fake content"}, {Key: "version", Value: 1}}}),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+		)
+
+		p := &PostDoc{
+			Content:       "replaced content",
+			AuthorId:      &authorId,
+			Author:        "fake author",
+			Reactions:     map[string]int64{"like": 100},
+			Attachments:   []*AttachmentDoc{{Id: primitive.NewObjectID(), Name: "fake.png"}},
+			CommentCount:  100,
+			LastCommentAt: &now,
+		}
+		err := p.ReplacePost(context.Background(), mt.Client, objId, 0, "fakeDb", "fakePostCol")
+		if assert.NoError(t, err) {
+			assert.Equal(t, &PostDoc{Content: "replaced content"}, p)
+		}
+	})
+}
@@ -0,0 +1,100 @@
+package models
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// FieldNames maps the json names of the fields of a document to their bson names
+type FieldNames map[string]string
+
+// PostFieldNames are the fields posts can be read with
+var PostFieldNames = fieldNamesOf(PostDoc{})
+
+// CommentFieldNames are the fields comments can be read with
+var CommentFieldNames = fieldNamesOf(CommentDoc{})
+
+// fieldNamesOf lists the fields of doc showing in json
+func fieldNamesOf(doc any) FieldNames {
+	out := make(FieldNames)
+	t := reflect.TypeOf(doc)
+	for i := 0; i < t.NumField(); i++ {
+		jsonName, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		bsonName, _, _ := strings.Cut(t.Field(i).Tag.Get("bson"), ",")
+		if jsonName != "" && jsonName != "-" && bsonName != "" && bsonName != "-" {
+			out[jsonName] = bsonName
+		}
+	}
+	return out
+}
+
+// Projection selects the fields documents are read with. A nil Projection reads whole documents
+type Projection bson.M
+
+// NewProjection selects the fields of a comma separated list of json names, out of names.
+// Ids are always selected, and an empty list selects every field
+func NewProjection(spec string, names FieldNames) (Projection, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	out := Projection{"_id": 1}
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		bsonName, ok := names[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown field %q", ErrInvalidQuery, name)
+		}
+		out[bsonName] = 1
+	}
+	return out, nil
+}
+
+// with returns the projection also selecting fields, or nil when p is nil
+func (p Projection) with(fields ...string) Projection {
+	if p == nil {
+		return nil
+	}
+	out := make(Projection, len(p)+len(fields))
+	for k, v := range p {
+		out[k] = v
+	}
+	for _, f := range fields {
+		out[f] = 1
+	}
+	return out
+}
+
+// Trim zeroes the fields of doc, a pointer to a document, that p does not select. Reads whose
+// projection was widened for checks, see WithVisibilityFields, are trimmed back with it.
+// Nothing is trimmed when p is nil
+func (p Projection) Trim(doc any) {
+	if p == nil {
+		return
+	}
+	v := reflect.ValueOf(doc).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		bsonName, _, _ := strings.Cut(t.Field(i).Tag.Get("bson"), ",")
+		if bsonName != "" && bsonName != "-" && p[bsonName] != 1 {
+			v.Field(i).Set(reflect.Zero(t.Field(i).Type))
+		}
+	}
+}
+
+// trim drops from doc the fields p does not select
+func (p Projection) trim(doc bson.Raw) (bson.Raw, error) {
+	elems, err := doc.Elements()
+	if err != nil {
+		return nil, err
+	}
+	out := bson.D{}
+	for _, e := range elems {
+		if p[e.Key()] == 1 {
+			out = append(out, bson.E{Key: e.Key(), Value: e.Value()})
+		}
+	}
+	return bson.Marshal(out)
+}
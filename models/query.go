@@ -0,0 +1,485 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	appConstants "github.com/gjbastidas/GoSimpleAPIWithMongoDB/constants"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrInvalidQuery is returned when a list query uses fields or operators that are not allowed,
+// or cannot be parsed
+var ErrInvalidQuery = errors.New("invalid query")
+
+type fieldKind int
+
+const (
+	stringField fieldKind = iota
+	timeField
+	numberField
+	// idField holds an ObjectID
+	idField
+	// idHexField holds an ObjectID as hex string
+	idHexField
+)
+
+// QueryField is a field lists can be filtered, and maybe sorted, by
+type QueryField struct {
+	bsonName string
+	kind     fieldKind
+	sortable bool
+	// omitZero tells the field is left out of documents when zero
+	omitZero bool
+}
+
+// QueryFields whitelists the fields list queries may use, by their json name
+type QueryFields map[string]QueryField
+
+// PostQueryFields are the fields posts can be queried by
+var PostQueryFields = QueryFields{
+	"id":            {bsonName: "_id", kind: idField, sortable: true},
+	"author":        {bsonName: "author", kind: stringField, sortable: true},
+	"authorId":      {bsonName: "authorId", kind: idField},
+	"content":       {bsonName: "content", kind: stringField},
+	"tags":          {bsonName: "tags", kind: stringField},
+	"status":        {bsonName: "status", kind: stringField},
+	"publishAt":     {bsonName: "publishAt", kind: timeField, sortable: true},
+	"commentCount":  {bsonName: "commentCount", kind: numberField, sortable: true, omitZero: true},
+	"lastCommentAt": {bsonName: "lastCommentAt", kind: timeField, sortable: true},
+	"version":       {bsonName: "version", kind: numberField, sortable: true},
+	"createdAt":     {bsonName: "createdAt", kind: timeField, sortable: true},
+	"updatedAt":     {bsonName: "updatedAt", kind: timeField, sortable: true},
+}
+
+// CommentQueryFields are the fields comments can be queried by
+var CommentQueryFields = QueryFields{
+	"id":        {bsonName: "_id", kind: idField, sortable: true},
+	"author":    {bsonName: "author", kind: stringField, sortable: true},
+	"authorId":  {bsonName: "authorId", kind: idField},
+	"content":   {bsonName: "content", kind: stringField},
+	"parentId":  {bsonName: "parentId", kind: idHexField},
+	"depth":     {bsonName: "depth", kind: numberField, sortable: true, omitZero: true},
+	"version":   {bsonName: "version", kind: numberField, sortable: true},
+	"createdAt": {bsonName: "createdAt", kind: timeField, sortable: true},
+	"updatedAt": {bsonName: "updatedAt", kind: timeField, sortable: true},
+}
+
+// comparisonOps maps the comparison operators of filters to MongoDB ones
+var comparisonOps = map[string]string{"eq": "$eq", "ne": "$ne", "gt": "$gt", "ge": "$gte", "lt": "$lt", "le": "$lte"}
+
+// ListQuery filters and sorts a list. Filters only reach MongoDB as comparisons of whitelisted
+// fields with typed values, so queries cannot inject operators of their own
+type ListQuery struct {
+	fields  QueryFields
+	clauses bson.A
+	// sort always ends with _id, so every document has a single place in the list
+	sort bson.D
+	// after holds the sort values of the document the list starts after
+	after bson.A
+	// projection selects the fields listed documents are read with
+	projection Projection
+}
+
+// NewListQuery returns a query listing every document by ascending id
+func NewListQuery(fields QueryFields) *ListQuery {
+	return &ListQuery{fields: fields, clauses: bson.A{}, sort: bson.D{{Key: "_id", Value: 1}}}
+}
+
+// AddFilter narrows the list down with an expression such as
+//
+//	author eq 'alice' and (content contains 'go' or createdAt gt '2023-01-01')
+//
+// Comparisons are made of a field, an operator (eq, ne, gt, ge, lt, le, or contains and
+// startswith for text) and a value, quoted unless it is a number. Quotes are escaped by doubling them
+func (q *ListQuery) AddFilter(expr string) error {
+	if strings.TrimSpace(expr) == "" {
+		return nil
+	}
+	if len(expr) > appConstants.MaxFilterLength {
+		return fmt.Errorf("%w: filter is longer than %d characters", ErrInvalidQuery, appConstants.MaxFilterLength)
+	}
+	tokens, err := lexFilter(expr)
+	if err != nil {
+		return err
+	}
+	p := &filterParser{q: q, tokens: tokens}
+	clause, err := p.or(0)
+	if err != nil {
+		return err
+	}
+	if p.pos < len(p.tokens) {
+		return fmt.Errorf("%w: unexpected %q", ErrInvalidQuery, p.tokens[p.pos].text)
+	}
+	q.clauses = append(q.clauses, clause)
+	return nil
+}
+
+// Where narrows the list down to the documents where a field compares to a value,
+// like a comparison of AddFilter does
+func (q *ListQuery) Where(field, op, value string) error {
+	clause, err := q.comparison(field, op, value)
+	if err != nil {
+		return err
+	}
+	q.clauses = append(q.clauses, clause)
+	return nil
+}
+
+// SortBy orders the list by a comma separated list of fields. Fields starting with - are sorted
+// in descending order
+func (q *ListQuery) SortBy(spec string) error {
+	if spec == "" {
+		return nil
+	}
+	sort := bson.D{}
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		order := 1
+		if strings.HasPrefix(name, "-") {
+			name, order = name[1:], -1
+		}
+		f, ok := q.fields[name]
+		if !ok || !f.sortable {
+			return fmt.Errorf("%w: cannot sort by %q", ErrInvalidQuery, name)
+		}
+		if seen[f.bsonName] {
+			return fmt.Errorf("%w: %q is sorted by more than once", ErrInvalidQuery, name)
+		}
+		seen[f.bsonName] = true
+		sort = append(sort, bson.E{Key: f.bsonName, Value: order})
+	}
+	if !seen["_id"] {
+		sort = append(sort, bson.E{Key: "_id", Value: 1})
+	}
+	q.sort = sort
+	return nil
+}
+
+// After starts the list after the document cursor points to, as given by the Next of a Page.
+// Lists sorted by id only take the id itself as cursor. It must be called after SortBy
+func (q *ListQuery) After(cursor string) error {
+	if cursor == "" {
+		return nil
+	}
+	if len(q.sort) == 1 {
+		objId, err := primitive.ObjectIDFromHex(cursor)
+		if err != nil {
+			return err
+		}
+		q.after = bson.A{objId}
+		return nil
+	}
+
+	var c struct {
+		V bson.A `bson:"v"`
+	}
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		err = bson.UnmarshalExtJSON(b, true, &c)
+	}
+	if err != nil || len(c.V) != len(q.sort) {
+		return fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	q.after = c.V
+	return nil
+}
+
+// Select reads listed documents with the fields of projection only
+func (q *ListQuery) Select(projection Projection) {
+	q.projection = projection
+}
+
+// match returns the filter selecting the documents matching filter and the filter of q, from its cursor
+func (q *ListQuery) match(filter bson.M) bson.M {
+	and := bson.A{filter, q.Filter()}
+	if q.after != nil {
+		and = append(and, q.afterFilter())
+	}
+	return bson.M{"$and": and}
+}
+
+// Filter returns the MongoDB filter the query narrows the list down with
+func (q *ListQuery) Filter() bson.M {
+	switch len(q.clauses) {
+	case 0:
+		return bson.M{}
+	case 1:
+		return q.clauses[0].(bson.M)
+	default:
+		return bson.M{"$and": q.clauses}
+	}
+}
+
+// Restrict narrows the list down with a MongoDB filter, such as PostsVisibleTo
+func (q *ListQuery) Restrict(filter bson.M) {
+	q.clauses = append(q.clauses, filter)
+}
+
+// Sort returns the MongoDB sort the query orders the list by
+func (q *ListQuery) Sort() bson.D {
+	return q.sort
+}
+
+// IsFirstPage tells whether the list starts at its first document
+func (q *ListQuery) IsFirstPage() bool {
+	return q.after == nil
+}
+
+// sortKeys returns the fields the list is sorted by
+func (q *ListQuery) sortKeys() []string {
+	out := make([]string, len(q.sort))
+	for i, s := range q.sort {
+		out[i] = s.Key
+	}
+	return out
+}
+
+// afterFilter selects the documents sorted after the ones holding the values of q.after.
+// Missing fields sort before any value, and comparisons never match them, hence the $ne and $not
+func (q *ListQuery) afterFilter() bson.M {
+	or := bson.A{}
+	for i, s := range q.sort {
+		clause := bson.M{}
+		for j, prev := range q.sort[:i] {
+			clause[prev.Key] = bson.M{"$eq": q.after[j]}
+		}
+		v := q.after[i]
+		switch {
+		case s.Value == 1 && v == nil:
+			clause[s.Key] = bson.M{"$ne": nil}
+		case s.Value == 1:
+			clause[s.Key] = bson.M{"$gt": v}
+		case v == nil:
+			// nothing comes after a missing field in descending order
+			continue
+		default:
+			clause[s.Key] = bson.M{"$not": bson.M{"$gte": v}}
+		}
+		or = append(or, clause)
+	}
+	return bson.M{"$or": or}
+}
+
+// cursorOf returns the cursor of the list starting after doc
+func (q *ListQuery) cursorOf(doc bson.Raw) string {
+	if len(q.sort) == 1 {
+		objId, _ := doc.Lookup("_id").ObjectIDOK()
+		return objId.Hex()
+	}
+	values := make(bson.A, len(q.sort))
+	for i, s := range q.sort {
+		v, err := doc.LookupErr(s.Key)
+		if err == nil {
+			values[i] = v
+		}
+	}
+	b, _ := bson.MarshalExtJSON(bson.M{"v": values}, true, false)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// comparison translates the comparison of a field with a value into a MongoDB filter
+func (q *ListQuery) comparison(field, op, raw string) (bson.M, error) {
+	f, ok := q.fields[field]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown field %q", ErrInvalidQuery, field)
+	}
+	value, err := f.value(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q is not a valid value for %v", ErrInvalidQuery, raw, field)
+	}
+
+	switch op {
+	case "contains", "startswith":
+		if f.kind != stringField {
+			return nil, fmt.Errorf("%w: %v does not apply to %v", ErrInvalidQuery, op, field)
+		}
+		pattern := regexp.QuoteMeta(raw)
+		if op == "startswith" {
+			pattern = "^" + pattern
+		}
+		return bson.M{f.bsonName: bson.M{"$regex": pattern, "$options": "i"}}, nil
+	}
+	mOp, ok := comparisonOps[op]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown operator %q", ErrInvalidQuery, op)
+	}
+	clause := bson.M{f.bsonName: bson.M{mOp: value}}
+	if n, ok := value.(int64); ok && f.omitZero && zeroMatches(op, n) {
+		clause = bson.M{"$or": bson.A{clause, bson.M{f.bsonName: bson.M{"$eq": nil}}}}
+	}
+	return clause, nil
+}
+
+// value converts the raw value of a comparison to the type the field holds
+func (f QueryField) value(raw string) (any, error) {
+	switch f.kind {
+	case timeField:
+		for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+			t, err := time.Parse(layout, raw)
+			if err == nil {
+				return t.UTC(), nil
+			}
+		}
+		return nil, errors.New("not a time")
+	case numberField:
+		return strconv.ParseInt(raw, 10, 64)
+	case idField:
+		return primitive.ObjectIDFromHex(raw)
+	case idHexField:
+		objId, err := primitive.ObjectIDFromHex(raw)
+		return objId.Hex(), err
+	default:
+		return raw, nil
+	}
+}
+
+// zeroMatches tells whether 0 compares to n by op, in which case a comparison must also
+// match the documents leaving the field out
+func zeroMatches(op string, n int64) bool {
+	switch op {
+	case "eq":
+		return n == 0
+	case "ne":
+		return n != 0
+	case "gt":
+		return 0 > n
+	case "ge":
+		return 0 >= n
+	case "lt":
+		return 0 < n
+	default:
+		return 0 <= n
+	}
+}
+
+type tokenKind int
+
+const (
+	wordToken tokenKind = iota
+	stringToken
+	openToken
+	closeToken
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// lexFilter splits a filter expression into words, quoted strings and parentheses
+func lexFilter(expr string) ([]token, error) {
+	tokens := make([]token, 0)
+	for i := 0; i < len(expr); {
+		switch c := expr[i]; {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: openToken, text: "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: closeToken, text: ")"})
+			i++
+		case c == '\'':
+			var b strings.Builder
+			closed := false
+			for i++; i < len(expr) && !closed; i++ {
+				switch {
+				case expr[i] != '\'':
+					b.WriteByte(expr[i])
+				case i+1 < len(expr) && expr[i+1] == '\'':
+					b.WriteByte('\'')
+					i++
+				default:
+					closed = true
+				}
+			}
+			if !closed {
+				return nil, fmt.Errorf("%w: unterminated string", ErrInvalidQuery)
+			}
+			tokens = append(tokens, token{kind: stringToken, text: b.String()})
+		default:
+			start := i
+			for i < len(expr) && !strings.ContainsRune(" \t\n()'", rune(expr[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: wordToken, text: expr[start:i]})
+		}
+	}
+	return tokens, nil
+}
+
+// filterParser parses filter expressions, where and binds tighter than or:
+//
+//	or         = and { "or" and }
+//	and        = factor { "and" factor }
+//	factor     = "(" or ")" | comparison
+//	comparison = field operator value
+type filterParser struct {
+	q      *ListQuery
+	tokens []token
+	pos    int
+}
+
+func (p *filterParser) or(depth int) (bson.M, error) {
+	return p.chain("or", "$or", func() (bson.M, error) { return p.and(depth) })
+}
+
+func (p *filterParser) and(depth int) (bson.M, error) {
+	return p.chain("and", "$and", func() (bson.M, error) { return p.factor(depth) })
+}
+
+// chain parses operands separated by keyword, joining them with the MongoDB operator op
+func (p *filterParser) chain(keyword, op string, operand func() (bson.M, error)) (bson.M, error) {
+	operands := bson.A{}
+	for {
+		clause, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, clause)
+		if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != wordToken || !strings.EqualFold(p.tokens[p.pos].text, keyword) {
+			break
+		}
+		p.pos++
+	}
+	if len(operands) == 1 {
+		return operands[0].(bson.M), nil
+	}
+	return bson.M{op: operands}, nil
+}
+
+func (p *filterParser) factor(depth int) (bson.M, error) {
+	if p.pos < len(p.tokens) && p.tokens[p.pos].kind == openToken {
+		if depth == appConstants.MaxFilterDepth {
+			return nil, fmt.Errorf("%w: filter is nested deeper than %d levels", ErrInvalidQuery, appConstants.MaxFilterDepth)
+		}
+		p.pos++
+		clause, err := p.or(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != closeToken {
+			return nil, fmt.Errorf("%w: missing closing parenthesis", ErrInvalidQuery)
+		}
+		p.pos++
+		return clause, nil
+	}
+
+	if p.pos+3 > len(p.tokens) {
+		return nil, fmt.Errorf("%w: incomplete comparison", ErrInvalidQuery)
+	}
+	field, op, value := p.tokens[p.pos], p.tokens[p.pos+1], p.tokens[p.pos+2]
+	if field.kind != wordToken || op.kind != wordToken || (value.kind != wordToken && value.kind != stringToken) {
+		return nil, fmt.Errorf("%w: comparisons must be a field, an operator and a value", ErrInvalidQuery)
+	}
+	p.pos += 3
+	return p.q.comparison(field.text, op.text, value.text)
+}
@@ -0,0 +1,365 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const fakeIdHex = "5f1e2d3c4b5a69788796a5b4"
+
+func TestAddFilter(t *testing.T) {
+	fakeId, _ := primitive.ObjectIDFromHex(fakeIdHex)
+
+	subtests := []struct {
+		name           string
+		fields         QueryFields
+		expr           string
+		expectedFilter bson.M
+		expectedErr    string
+	}{
+		{
+			name:           "empty",
+			expr:           " ",
+			expectedFilter: bson.M{},
+		},
+		{
+			name:           "eq",
+			expr:           "author eq 'alice'",
+			expectedFilter: bson.M{"author": bson.M{"$eq": "alice"}},
+		},
+		{
+			name:           "ne",
+			expr:           "author ne 'alice'",
+			expectedFilter: bson.M{"author": bson.M{"$ne": "alice"}},
+		},
+		{
+			name:           "number",
+			expr:           "version ge 2",
+			expectedFilter: bson.M{"version": bson.M{"$gte": int64(2)}},
+		},
+		{
+			name:           "date",
+			expr:           "createdAt lt '2023-01-02'",
+			expectedFilter: bson.M{"createdAt": bson.M{"$lt": time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)}},
+		},
+		{
+			name:           "time",
+			expr:           "updatedAt le '2023-01-02T03:04:05+01:00'",
+			expectedFilter: bson.M{"updatedAt": bson.M{"$lte": time.Date(2023, 1, 2, 2, 4, 5, 0, time.UTC)}},
+		},
+		{
+			name:           "id",
+			expr:           "authorId eq '" + fakeIdHex + "'",
+			expectedFilter: bson.M{"authorId": bson.M{"$eq": fakeId}},
+		},
+		{
+			name:           "id-hex",
+			fields:         CommentQueryFields,
+			expr:           "parentId eq '" + strings.ToUpper(fakeIdHex) + "'",
+			expectedFilter: bson.M{"parentId": bson.M{"$eq": fakeIdHex}},
+		},
+		{
+			name:           "contains-quoted",
+			expr:           "content contains 'a.b*'",
+			expectedFilter: bson.M{"content": bson.M{"$regex": `a\.b\*`, "$options": "i"}},
+		},
+		{
+			name:           "startswith",
+			expr:           "author startswith 'al'",
+			expectedFilter: bson.M{"author": bson.M{"$regex": "^al", "$options": "i"}},
+		},
+		{
+			name:           "escaped-quote",
+			expr:           "author eq 'o''brien'",
+			expectedFilter: bson.M{"author": bson.M{"$eq": "o'brien"}},
+		},
+		{
+			name:           "operator-as-value",
+			expr:           "author eq '$where'",
+			expectedFilter: bson.M{"author": bson.M{"$eq": "$where"}},
+		},
+		{
+			name:           "omitted-zero-matched",
+			expr:           "commentCount lt 3",
+			expectedFilter: bson.M{"$or": bson.A{bson.M{"commentCount": bson.M{"$lt": int64(3)}}, bson.M{"commentCount": bson.M{"$eq": nil}}}},
+		},
+		{
+			name:           "omitted-zero-not-matched",
+			expr:           "commentCount gt 3",
+			expectedFilter: bson.M{"commentCount": bson.M{"$gt": int64(3)}},
+		},
+		{
+			name: "and-binds-tighter-than-or",
+			expr: "author eq 'a' or author eq 'b' and version gt 1",
+			expectedFilter: bson.M{"$or": bson.A{
+				bson.M{"author": bson.M{"$eq": "a"}},
+				bson.M{"$and": bson.A{bson.M{"author": bson.M{"$eq": "b"}}, bson.M{"version": bson.M{"$gt": int64(1)}}}},
+			}},
+		},
+		{
+			name: "parentheses",
+			expr: "(author eq 'a' or author eq 'b') and version gt 1",
+			expectedFilter: bson.M{"$and": bson.A{
+				bson.M{"$or": bson.A{bson.M{"author": bson.M{"$eq": "a"}}, bson.M{"author": bson.M{"$eq": "b"}}}},
+				bson.M{"version": bson.M{"$gt": int64(1)}},
+			}},
+		},
+		{
+			name:        "return-error-unknown-field",
+			expr:        "password eq 'secret'",
+			expectedErr: `invalid query: unknown field "password"`,
+		},
+		{
+			name:        "return-error-unknown-operator",
+			expr:        "author like 'alice'",
+			expectedErr: `invalid query: unknown operator "like"`,
+		},
+		{
+			name:        "return-error-text-operator-on-number",
+			expr:        "version contains '1'",
+			expectedErr: "invalid query: contains does not apply to version",
+		},
+		{
+			name:        "return-error-invalid-number",
+			expr:        "version gt 'two'",
+			expectedErr: `invalid query: "two" is not a valid value for version`,
+		},
+		{
+			name:        "return-error-invalid-time",
+			expr:        "createdAt gt 'yesterday'",
+			expectedErr: `invalid query: "yesterday" is not a valid value for createdAt`,
+		},
+		{
+			name:        "return-error-invalid-id",
+			expr:        "authorId eq 'alice'",
+			expectedErr: `invalid query: "alice" is not a valid value for authorId`,
+		},
+		{
+			name:        "return-error-unterminated-string",
+			expr:        "author eq 'alice",
+			expectedErr: "invalid query: unterminated string",
+		},
+		{
+			name:        "return-error-incomplete-comparison",
+			expr:        "author eq",
+			expectedErr: "invalid query: incomplete comparison",
+		},
+		{
+			name:        "return-error-malformed-comparison",
+			expr:        "author 'eq' alice",
+			expectedErr: "invalid query: comparisons must be a field, an operator and a value",
+		},
+		{
+			name:        "return-error-missing-parenthesis",
+			expr:        "(author eq 'alice'",
+			expectedErr: "invalid query: missing closing parenthesis",
+		},
+		{
+			name:        "return-error-trailing-token",
+			expr:        "author eq 'alice' 'bob'",
+			expectedErr: `invalid query: unexpected "bob"`,
+		},
+		{
+			name:        "return-error-too-deep",
+			expr:        "((((((author eq 'alice'))))))",
+			expectedErr: "invalid query: filter is nested deeper than 5 levels",
+		},
+		{
+			name:        "return-error-too-long",
+			expr:        "author eq '" + strings.Repeat("a", 1000) + "'",
+			expectedErr: "invalid query: filter is longer than 1000 characters",
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			if st.fields == nil {
+				st.fields = PostQueryFields
+			}
+			q := NewListQuery(st.fields)
+			err := q.AddFilter(st.expr)
+			if st.expectedErr != "" {
+				assert.ErrorIs(t, err, ErrInvalidQuery)
+				assert.EqualError(t, err, st.expectedErr)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, st.expectedFilter, q.Filter())
+			}
+		})
+	}
+}
+
+func TestSortBy(t *testing.T) {
+	subtests := []struct {
+		name         string
+		spec         string
+		expectedSort bson.D
+		expectedErr  string
+	}{
+		{
+			name:         "default",
+			expectedSort: bson.D{{Key: "_id", Value: 1}},
+		},
+		{
+			name:         "many-fields",
+			spec:         "-createdAt, author",
+			expectedSort: bson.D{{Key: "createdAt", Value: -1}, {Key: "author", Value: 1}, {Key: "_id", Value: 1}},
+		},
+		{
+			name:         "by-id",
+			spec:         "-id",
+			expectedSort: bson.D{{Key: "_id", Value: -1}},
+		},
+		{
+			name:        "return-error-not-sortable",
+			spec:        "content",
+			expectedErr: `invalid query: cannot sort by "content"`,
+		},
+		{
+			name:        "return-error-unknown-field",
+			spec:        "password",
+			expectedErr: `invalid query: cannot sort by "password"`,
+		},
+		{
+			name:        "return-error-repeated-field",
+			spec:        "createdAt,-createdAt",
+			expectedErr: `invalid query: "createdAt" is sorted by more than once`,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			q := NewListQuery(PostQueryFields)
+			err := q.SortBy(st.spec)
+			if st.expectedErr != "" {
+				assert.ErrorIs(t, err, ErrInvalidQuery)
+				assert.EqualError(t, err, st.expectedErr)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, st.expectedSort, q.Sort())
+			}
+		})
+	}
+}
+
+func TestCursor(t *testing.T) {
+	fakeId, _ := primitive.ObjectIDFromHex(fakeIdHex)
+	createdAt := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	subtests := []struct {
+		name          string
+		sort          string
+		doc           bson.M
+		cursor        string
+		expectedAfter bson.A
+		expectedErr   string
+	}{
+		{
+			name:          "by-id",
+			doc:           bson.M{"_id": fakeId, "author": "alice"},
+			expectedAfter: bson.A{fakeId},
+		},
+		{
+			name:          "many-fields",
+			sort:          "-createdAt,author",
+			doc:           bson.M{"_id": fakeId, "author": "alice", "createdAt": createdAt},
+			expectedAfter: bson.A{primitive.NewDateTimeFromTime(createdAt), "alice", fakeId},
+		},
+		{
+			name:          "missing-field",
+			sort:          "-createdAt,author",
+			doc:           bson.M{"_id": fakeId, "createdAt": createdAt},
+			expectedAfter: bson.A{primitive.NewDateTimeFromTime(createdAt), nil, fakeId},
+		},
+		{
+			name:        "return-error-malformed-id",
+			cursor:      "alice",
+			expectedErr: "the provided hex string is not a valid ObjectID",
+		},
+		{
+			name:        "return-error-malformed-cursor",
+			sort:        "-createdAt",
+			cursor:      "not base64!",
+			expectedErr: "invalid query: malformed cursor",
+		},
+		{
+			name:        "return-error-cursor-of-another-sort",
+			sort:        "-createdAt,author",
+			cursor:      "eyJ2IjpbXX0",
+			expectedErr: "invalid query: malformed cursor",
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			q := NewListQuery(PostQueryFields)
+			if !assert.NoError(t, q.SortBy(st.sort)) {
+				return
+			}
+			if st.doc != nil {
+				raw, err := bson.Marshal(st.doc)
+				if !assert.NoError(t, err) {
+					return
+				}
+				st.cursor = q.cursorOf(raw)
+			}
+
+			err := q.After(st.cursor)
+			if st.expectedErr != "" {
+				assert.EqualError(t, err, st.expectedErr)
+				assert.True(t, q.IsFirstPage())
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, st.expectedAfter, q.after)
+				assert.False(t, q.IsFirstPage())
+			}
+		})
+	}
+}
+
+func TestAfterFilter(t *testing.T) {
+	fakeId, _ := primitive.ObjectIDFromHex(fakeIdHex)
+	createdAt := primitive.NewDateTimeFromTime(time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC))
+
+	subtests := []struct {
+		name           string
+		after          bson.A
+		expectedFilter bson.M
+	}{
+		{
+			name:  "with-values",
+			after: bson.A{createdAt, "alice", fakeId},
+			expectedFilter: bson.M{"$or": bson.A{
+				bson.M{"createdAt": bson.M{"$not": bson.M{"$gte": createdAt}}},
+				bson.M{"createdAt": bson.M{"$eq": createdAt}, "author": bson.M{"$gt": "alice"}},
+				bson.M{"createdAt": bson.M{"$eq": createdAt}, "author": bson.M{"$eq": "alice"}, "_id": bson.M{"$gt": fakeId}},
+			}},
+		},
+		{
+			name:  "with-missing-values",
+			after: bson.A{nil, nil, fakeId},
+			expectedFilter: bson.M{"$or": bson.A{
+				bson.M{"createdAt": bson.M{"$eq": nil}, "author": bson.M{"$ne": nil}},
+				bson.M{"createdAt": bson.M{"$eq": nil}, "author": bson.M{"$eq": nil}, "_id": bson.M{"$gt": fakeId}},
+			}},
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			q := NewListQuery(PostQueryFields)
+			if assert.NoError(t, q.SortBy("-createdAt,author")) {
+				q.after = st.after
+				assert.Equal(t, st.expectedFilter, q.afterFilter())
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	appConstants "github.com/gjbastidas/GoSimpleAPIWithMongoDB/constants"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ReactionTypes are the reactions a post or comment can get
+var ReactionTypes = []string{"like", "love", "laugh", "wow", "sad", "angry"}
+
+var (
+	// ErrInvalidReaction is returned for reaction types not listed in ReactionTypes
+	ErrInvalidReaction = fmt.Errorf("reaction type must be one of %v", strings.Join(ReactionTypes, ", "))
+	// ErrAlreadyReacted is returned when an author reacts twice the same way to a post or comment
+	ErrAlreadyReacted = errors.New("author already reacted with this type")
+)
+
+// ReactionDoc records that an author reacted to a post or comment. Each one is counted in the
+// reactions field of its target, so counters are read along with the post or comment
+type ReactionDoc struct {
+	Id        primitive.ObjectID `bson:"_id,omitempty"`
+	TargetId  primitive.ObjectID `bson:"targetId"`
+	AuthorId  primitive.ObjectID `bson:"authorId"`
+	Type      string             `bson:"type"`
+	CreatedAt *time.Time         `bson:"createdAt,omitempty"`
+}
+
+func (r *ReactionDoc) getId() primitive.ObjectID {
+	return r.Id
+}
+
+func (r *ReactionDoc) initialize(now time.Time) {
+	r.CreatedAt = &now
+}
+
+func validReaction(reactionType string) error {
+	for _, t := range ReactionTypes {
+		if t == reactionType {
+			return nil
+		}
+	}
+	return ErrInvalidReaction
+}
+
+// addReaction records the reaction of an author to the document objId of colName and, within
+// the same transaction, increments its counter. Reacting twice the same way is refused
+func addReaction(ctx context.Context, mCl *mongo.Client, objId, authorId primitive.ObjectID, reactionType, dbName, colName string) error {
+	err := validReaction(reactionType)
+	if err != nil {
+		return err
+	}
+	_, err = withTransaction(ctx, mCl, func(sCtx mongo.SessionContext) (bool, error) {
+		r := &ReactionDoc{TargetId: objId, AuthorId: authorId, Type: reactionType}
+		_, err := createOneRecord(sCtx, mCl, r, dbName, appConstants.ReactColl)
+		if mongo.IsDuplicateKeyError(err) {
+			return false, ErrAlreadyReacted
+		}
+		if err != nil {
+			return false, err
+		}
+		return true, countReaction(sCtx, mCl, objId, reactionType, 1, dbName, colName)
+	})
+	return err
+}
+
+// removeReaction deletes the reaction of an author to the document objId of colName and, within
+// the same transaction, decrements its counter
+func removeReaction(ctx context.Context, mCl *mongo.Client, objId, authorId primitive.ObjectID, reactionType, dbName, colName string) error {
+	err := validReaction(reactionType)
+	if err != nil {
+		return err
+	}
+	_, err = withTransaction(ctx, mCl, func(sCtx mongo.SessionContext) (bool, error) {
+		filter := bson.M{"targetId": objId, "authorId": authorId, "type": reactionType}
+		res, err := mCl.Database(dbName).Collection(appConstants.ReactColl).DeleteOne(sCtx, filter)
+		if err != nil {
+			return false, err
+		}
+		if res.DeletedCount == 0 {
+			return false, mongo.ErrNoDocuments
+		}
+		return true, countReaction(sCtx, mCl, objId, reactionType, -1, dbName, colName)
+	})
+	return err
+}
+
+// countReaction adds n to the counter of a reaction type. Counters are not part of the content,
+// so the version of the document is left untouched
+func countReaction(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, reactionType string, n int64, dbName, colName string) error {
+	update := bson.M{"$inc": bson.M{"reactions." + reactionType: n}}
+	res, err := mCl.Database(dbName).Collection(colName).UpdateOne(ctx, bson.M{"_id": objId}, update)
+	if err != nil {
+		return err
+	}
+	return matchedVersion(res.MatchedCount, 0)
+}
+
+// deleteReactions removes the reactions to any of targetIds
+func deleteReactions(ctx context.Context, mCl *mongo.Client, targetIds []any, dbName string) error {
+	_, err := mCl.Database(dbName).Collection(appConstants.ReactColl).DeleteMany(ctx, bson.M{"targetId": bson.M{"$in": targetIds}})
+	return err
+}
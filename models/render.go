@@ -0,0 +1,104 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// Format tells how the content of a post or comment is written. An empty format is plain text
+type Format string
+
+const (
+	FormatPlain    Format = "plain"
+	FormatMarkdown Format = "markdown"
+)
+
+// Formats are the formats content can be written in
+var Formats = []Format{FormatPlain, FormatMarkdown}
+
+// ErrInvalidFormat is returned for formats not listed in Formats
+var ErrInvalidFormat = fmt.Errorf("format must be one of %v, %v", FormatPlain, FormatMarkdown)
+
+var (
+	// markdown leaves out raw HTML and links with dangerous URLs, which sanitizer strips anyway
+	markdown  = goldmark.New(goldmark.WithExtensions(extension.GFM))
+	sanitizer = bluemonday.UGCPolicy()
+)
+
+func validFormat(f Format) error {
+	if f == "" {
+		return nil
+	}
+	for _, v := range Formats {
+		if v == f {
+			return nil
+		}
+	}
+	return ErrInvalidFormat
+}
+
+// UnmarshalJSON refuses formats not listed in Formats
+func (f *Format) UnmarshalJSON(b []byte) error {
+	var s string
+	err := json.Unmarshal(b, &s)
+	if err != nil {
+		return err
+	}
+	err = validFormat(Format(s))
+	if err != nil {
+		return err
+	}
+	*f = Format(s)
+	return nil
+}
+
+func formatValue(v any) (any, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, errors.New("expected a string")
+	}
+	err := validFormat(Format(s))
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// RenderHTML renders content written in format as sanitized HTML. Plain text is escaped, its
+// paragraphs separated by blank lines
+func RenderHTML(format Format, content string) (string, error) {
+	switch format {
+	case FormatMarkdown:
+		var buf bytes.Buffer
+		err := markdown.Convert([]byte(content), &buf)
+		if err != nil {
+			return "", err
+		}
+		return sanitizer.Sanitize(buf.String()), nil
+	case FormatPlain, "":
+		var b strings.Builder
+		for _, par := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n\n") {
+			if par = strings.TrimSpace(par); par != "" {
+				b.WriteString("<p>")
+				b.WriteString(strings.ReplaceAll(html.EscapeString(par), "\n", "<br>\n"))
+				b.WriteString("</p>\n")
+			}
+		}
+		return b.String(), nil
+	}
+	return "", ErrInvalidFormat
+}
+
+// WithRenderFields returns the projection also selecting the fields content is rendered from,
+// or nil when p is nil
+func (p Projection) WithRenderFields() Projection {
+	return p.with("content", "format", "version")
+}
@@ -0,0 +1,171 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	appConstants "github.com/gjbastidas/GoSimpleAPIWithMongoDB/constants"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// RevisionDoc is a snapshot of a post as it was before an update.
+// Revision matches the version the post had at that time
+type RevisionDoc struct {
+	Id       primitive.ObjectID `json:"-" bson:"_id,omitempty"`
+	PostId   primitive.ObjectID `json:"postId" bson:"postId"`
+	Revision int64              `json:"revision" bson:"revision"`
+	Post     *PostDoc           `json:"post" bson:"post"`
+	SavedAt  *time.Time         `json:"savedAt,omitempty" bson:"savedAt,omitempty"`
+}
+
+// ErrDiffTooLarge is returned when comparing revisions having more than MaxDiffLines lines, whose
+// comparison takes memory growing with the product of their lengths
+var ErrDiffTooLarge = fmt.Errorf("revisions longer than %d lines cannot be compared", appConstants.MaxDiffLines)
+
+func (rv *RevisionDoc) getId() primitive.ObjectID {
+	return rv.Id
+}
+
+func (rv *RevisionDoc) initialize(now time.Time) {
+	rv.SavedAt = &now
+}
+
+// restoredFields are the fields of a post restored from a revision. The others, such as its
+// author, reactions, attachments and comment counters, keep their stored value
+var restoredFields = []string{"content", "format", "tags", "status", "publishAt"}
+
+// restoreUpdate builds the update setting the fields listed in restoredFields back to the ones
+// of the post p saved in a revision, and removing those p does not have
+func restoreUpdate(p *PostDoc) (bson.M, error) {
+	raw, err := bson.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	var saved bson.M
+	err = bson.Unmarshal(raw, &saved)
+	if err != nil {
+		return nil, err
+	}
+
+	set, unset := bson.M{}, bson.M{}
+	for _, k := range restoredFields {
+		if v, ok := saved[k]; ok {
+			set[k] = v
+		} else {
+			unset[k] = ""
+		}
+	}
+	update := bson.M{}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	return update, nil
+}
+
+// updatePostWithRevision applies update to a post and saves the version it replaces as a
+// revision, both within a transaction. check, when given, vets the post as it was before the
+// update, and the update is rolled back when it fails
+func updatePostWithRevision(ctx context.Context, mCl *mongo.Client, update any, check func(prev *PostDoc) error, objId primitive.ObjectID, version int64, dbName, colName string) error {
+	_, err := withTransaction(ctx, mCl, func(sCtx mongo.SessionContext) (*mongo.InsertOneResult, error) {
+		prev, err := findOneAndUpdateRecord(sCtx, mCl, new(PostDoc), update, objId, version, dbName, colName)
+		if err != nil {
+			return nil, err
+		}
+		if check != nil {
+			err = check(prev)
+			if err != nil {
+				return nil, err
+			}
+		}
+		rev := &RevisionDoc{PostId: objId, Revision: prev.Version, Post: prev}
+		return createOneRecord(sCtx, mCl, rev, dbName, appConstants.RColl)
+	})
+	return err
+}
+
+func listRevisions(ctx context.Context, mCl *mongo.Client, postId, cursor primitive.ObjectID, limit int64, dbName string) (*Page[*RevisionDoc], error) {
+	return findPage[*RevisionDoc](ctx, mCl, bson.M{"postId": postId}, cursor, limit, true, dbName, appConstants.RColl)
+}
+
+// readRevision returns revision n of a post. The post itself is its latest revision
+func readRevision(ctx context.Context, mCl *mongo.Client, postId primitive.ObjectID, n int64, dbName, colName string) (*RevisionDoc, error) {
+	rev := new(RevisionDoc)
+	filter := bson.M{"postId": postId, "revision": n}
+	err := mCl.Database(dbName).Collection(appConstants.RColl).FindOne(ctx, filter).Decode(rev)
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return rev, err
+	}
+
+	post, err := readOneRecord(ctx, mCl, new(PostDoc), postId, nil, dbName, colName)
+	if err != nil {
+		return nil, err
+	}
+	if post.Version != n {
+		return nil, mongo.ErrNoDocuments
+	}
+	return &RevisionDoc{PostId: postId, Revision: n, Post: post}, nil
+}
+
+// DiffRevisions compares two revisions line by line. The result follows the unified diff
+// format, without hunk headers, so every line of both revisions is shown
+func DiffRevisions(from, to *RevisionDoc) (string, error) {
+	a, b := revisionLines(from), revisionLines(to)
+	if len(a) > appConstants.MaxDiffLines || len(b) > appConstants.MaxDiffLines {
+		return "", ErrDiffTooLarge
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- revision %d\n+++ revision %d\n", from.Revision, to.Revision)
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			sb.WriteString(" " + a[i] + "\n")
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			sb.WriteString("-" + a[i] + "\n")
+			i++
+		default:
+			sb.WriteString("+" + b[j] + "\n")
+			j++
+		}
+	}
+	return sb.String(), nil
+}
+
+// revisionLines renders the fields of a revision that DiffRevisions compares
+func revisionLines(rev *RevisionDoc) []string {
+	lines := []string{"author: " + rev.Post.Author}
+	if len(rev.Post.Tags) > 0 {
+		lines = append(lines, "tags: "+strings.Join(rev.Post.Tags, ", "))
+	}
+	lines = append(lines, "")
+	return append(lines, strings.Split(rev.Post.Content, "\n")...)
+}
@@ -0,0 +1,140 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	appConstants "github.com/gjbastidas/GoSimpleAPIWithMongoDB/constants"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDiffRevisions(t *testing.T) {
+	revision := func(n int64, content string, tags ...string) *RevisionDoc {
+		return &RevisionDoc{Revision: n, Post: &PostDoc{Author: "fake author", Content: content, Tags: tags}}
+	}
+
+	subtests := []struct {
+		name         string
+		from         *RevisionDoc
+		to           *RevisionDoc
+		expectedDiff string
+		expectedErr  error
+	}{
+		{
+			name:         "same-content",
+			from:         revision(1, "a\nb"),
+			to:           revision(2, "a\nb"),
+			expectedDiff: "--- revision 1\n+++ revision 2\n author: fake author\n \n a\n b\n",
+		},
+		{
+			name:         "added-line",
+			from:         revision(1, "a\nc"),
+			to:           revision(2, "a\nb\nc"),
+			expectedDiff: "--- revision 1\n+++ revision 2\n author: fake author\n \n a\n+b\n c\n",
+		},
+		{
+			name:         "removed-line",
+			from:         revision(1, "a\nb\nc"),
+			to:           revision(2, "a\nc"),
+			expectedDiff: "--- revision 1\n+++ revision 2\n author: fake author\n \n a\n-b\n c\n",
+		},
+		{
+			name:         "changed-line",
+			from:         revision(1, "a\nb\nc"),
+			to:           revision(2, "a\nx\nc"),
+			expectedDiff: "--- revision 1\n+++ revision 2\n author: fake author\n \n a\n-b\n+x\n c\n",
+		},
+		{
+			name:         "changed-tags",
+			from:         revision(1, "a", "go"),
+			to:           revision(2, "a", "go", "mongodb"),
+			expectedDiff: "--- revision 1\n+++ revision 2\n author: fake author\n-tags: go\n+tags: go, mongodb\n \n a\n",
+		},
+		{
+			name:         "added-tags",
+			from:         revision(1, "a"),
+			to:           revision(2, "a", "go"),
+			expectedDiff: "--- revision 1\n+++ revision 2\n author: fake author\n+tags: go\n \n a\n",
+		},
+		{
+			name:         "older-revision-last",
+			from:         revision(2, "a\nb"),
+			to:           revision(1, "a"),
+			expectedDiff: "--- revision 2\n+++ revision 1\n author: fake author\n \n a\n-b\n",
+		},
+		{
+			name:         "longest-revision",
+			from:         revision(1, strings.Repeat("a\n", appConstants.MaxDiffLines-3)),
+			to:           revision(2, "a"),
+			expectedDiff: "--- revision 1\n+++ revision 2\n author: fake author\n \n a\n" + strings.Repeat("-a\n", appConstants.MaxDiffLines-4) + "-\n",
+		},
+		{
+			name:        "return-error-too-large",
+			from:        revision(1, "a"),
+			to:          revision(2, strings.Repeat("a\n", appConstants.MaxDiffLines-2)),
+			expectedErr: ErrDiffTooLarge,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			diff, err := DiffRevisions(st.from, st.to)
+			assert.ErrorIs(t, err, st.expectedErr)
+			assert.Equal(t, st.expectedDiff, diff)
+		})
+	}
+}
+
+func TestRestoreUpdate(t *testing.T) {
+	publishAt := time.Date(2030, 1, 2, 8, 0, 0, 0, time.UTC)
+
+	subtests := []struct {
+		name           string
+		post           *PostDoc
+		expectedUpdate bson.M
+	}{
+		{
+			name: "server-managed-fields-left-out",
+			post: &PostDoc{
+				Id:           primitive.NewObjectID(),
+				Content:      "fake content",
+				Format:       FormatMarkdown,
+				Tags:         []string{"go"},
+				Status:       StatusScheduled,
+				PublishAt:    &publishAt,
+				Moderation:   ModerationPre,
+				Reactions:    map[string]int64{"like": 100},
+				Attachments:  []*AttachmentDoc{{Id: primitive.NewObjectID(), Name: "fake.png"}},
+				CommentCount: 100,
+				Version:      3,
+			},
+			expectedUpdate: bson.M{"$set": bson.M{
+				"content":   "fake content",
+				"format":    string(FormatMarkdown),
+				"tags":      bson.A{"go"},
+				"status":    string(StatusScheduled),
+				"publishAt": primitive.NewDateTimeFromTime(publishAt),
+			}},
+		},
+		{
+			name: "missing-fields-removed",
+			post: &PostDoc{Content: "fake content", CommentCount: 100},
+			expectedUpdate: bson.M{
+				"$set":   bson.M{"content": "fake content"},
+				"$unset": bson.M{"format": "", "tags": "", "status": "", "publishAt": ""},
+			},
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			update, err := restoreUpdate(st.post)
+			if assert.NoError(t, err) {
+				assert.Equal(t, st.expectedUpdate, update)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package models
+
+import (
+	"context"
+	"html"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	appConstants "github.com/gjbastidas/GoSimpleAPIWithMongoDB/constants"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Types of documents a search can return
+const (
+	HitPost    = "post"
+	HitComment = "comment"
+)
+
+type Search interface {
+	Search(ctx context.Context, mCl *mongo.Client, q, hitType string, offset, limit int64, dbName, pColName, cColName string) (*Page[*SearchHit], error)
+}
+
+// SearchFactory returns a Search, see PostFactory
+type SearchFactory func() Search
+
+func NewSearch() Search {
+	return new(TextSearch)
+}
+
+// TextSearch looks for posts and comments through the text indexes on their content and author
+type TextSearch struct{}
+
+// SearchHit is a post or comment matching a search, along with its text score and a snippet
+// of its content where matches are wrapped in <mark> tags
+type SearchHit struct {
+	Type     string              `json:"type" bson:"-"`
+	Id       primitive.ObjectID  `json:"id" bson:"_id"`
+	PostId   string              `json:"postId,omitempty" bson:"postId,omitempty"`
+	AuthorId *primitive.ObjectID `json:"authorId,omitempty" bson:"authorId,omitempty"`
+	Author   string              `json:"author,omitempty" bson:"author,omitempty"`
+	Content  string              `json:"-" bson:"content,omitempty"`
+	Snippet  string              `json:"snippet" bson:"-"`
+	Score    float64             `json:"score" bson:"score"`
+}
+
+// Search runs q as a MongoDB $text query over posts and comments, or only over hitType when given,
+// and returns the hits ranked by text score. Posts not published yet, along with their comments,
+// and comments not approved are left out. Pages are requested by offset
+func (s *TextSearch) Search(ctx context.Context, mCl *mongo.Client, q, hitType string, offset, limit int64, dbName, pColName, cColName string) (*Page[*SearchHit], error) {
+	colNames := map[string]string{HitPost: pColName, HitComment: cColName}
+	if hitType != "" {
+		colNames = map[string]string{hitType: colNames[hitType]}
+	}
+
+	// any collection may hold the whole requested page, so each one is ranked down to its
+	// end and the merged ranking is cut afterwards. One extra hit tells whether there is a next page
+	hits := make([]*SearchHit, 0)
+	for t, colName := range colNames {
+		pipeline := mongo.Pipeline{}
+		text := bson.M{"$text": bson.M{"$search": q}}
+		switch t {
+		case HitPost:
+			pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.M{"$and": bson.A{text, PostsVisibleTo(nil)}}}})
+		case HitComment:
+			pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.M{"$and": bson.A{text, CommentsVisibleTo(nil)}}}})
+		}
+		pipeline = append(pipeline,
+			bson.D{{Key: "$addFields", Value: bson.M{"score": bson.M{"$meta": "textScore"}}}},
+			bson.D{{Key: "$sort", Value: bson.D{{Key: "score", Value: -1}, {Key: "_id", Value: 1}}}},
+		)
+		if t == HitComment {
+			pipeline = append(pipeline, visiblePostStages(nil, pColName)...)
+		}
+		pipeline = append(pipeline,
+			bson.D{{Key: "$limit", Value: offset + limit + 1}},
+			bson.D{{Key: "$project", Value: bson.M{"postId": 1, "authorId": 1, "author": 1, "content": 1, "score": 1}}},
+		)
+		cur, err := mCl.Database(dbName).Collection(colName).Aggregate(ctx, pipeline)
+		if err != nil {
+			return nil, err
+		}
+		found := make([]*SearchHit, 0)
+		err = cur.All(ctx, &found)
+		if err != nil {
+			return nil, err
+		}
+		for _, h := range found {
+			h.Type = t
+		}
+		hits = append(hits, found...)
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		if hits[i].Type != hits[j].Type {
+			return hits[i].Type > hits[j].Type
+		}
+		return hits[i].Id.Hex() < hits[j].Id.Hex()
+	})
+
+	out := &Page[*SearchHit]{Items: []*SearchHit{}}
+	if offset < int64(len(hits)) {
+		out.Items = hits[offset:]
+	}
+	if int64(len(out.Items)) > limit {
+		out.Items = out.Items[:limit]
+		out.Next = strconv.FormatInt(offset+limit, 10)
+	}
+	terms := searchTerms(q)
+	for _, h := range out.Items {
+		h.Snippet = snippet(h.Content, terms)
+	}
+	return out, nil
+}
+
+// visiblePostStages leaves out the comments of the posts viewer cannot read, see PostsVisibleTo,
+// looking their posts up in pColName. Detached comments, having no post, are kept
+func visiblePostStages(viewer *primitive.ObjectID, pColName string) mongo.Pipeline {
+	postId := bson.M{"$convert": bson.M{"input": "$$postId", "to": "objectId", "onError": nil, "onNull": nil}}
+	return mongo.Pipeline{
+		{{Key: "$lookup", Value: bson.M{
+			"from": pColName,
+			"let":  bson.M{"postId": "$postId"},
+			"pipeline": mongo.Pipeline{
+				{{Key: "$match", Value: bson.M{"$expr": bson.M{"$eq": bson.A{"$_id", postId}}}}},
+				{{Key: "$match", Value: PostsVisibleTo(viewer)}},
+				{{Key: "$project", Value: bson.M{"_id": 1}}},
+			},
+			"as": "post",
+		}}},
+		{{Key: "$match", Value: bson.M{"$or": bson.A{bson.M{"postId": bson.M{"$exists": false}}, bson.M{"post.0": bson.M{"$exists": true}}}}}},
+		{{Key: "$unset", Value: "post"}},
+	}
+}
+
+// searchTerms returns the lowercase words of a $text query, leaving out negated ones
+func searchTerms(q string) []string {
+	out := make([]string, 0)
+	for _, f := range strings.FieldsFunc(q, func(r rune) bool { return unicode.IsSpace(r) || r == '"' }) {
+		if strings.HasPrefix(f, "-") {
+			continue
+		}
+		for _, w := range strings.FieldsFunc(f, isNotWordRune) {
+			out = append(out, strings.ToLower(w))
+		}
+	}
+	return out
+}
+
+func isNotWordRune(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// matchesTerm tells whether a word of a document was likely matched by a term of the query.
+// Text indexes match words by their stem, so a word matches a term starting like it
+func matchesTerm(word string, terms []string) bool {
+	word = strings.ToLower(word)
+	for _, t := range terms {
+		short, long := t, word
+		if len(short) > len(long) {
+			short, long = long, short
+		}
+		if short == long || (len([]rune(short)) >= 3 && strings.HasPrefix(long, short)) {
+			return true
+		}
+	}
+	return false
+}
+
+// snippet cuts from content about SnippetLength characters around the first word matching terms,
+// escapes them as HTML and wraps the matching words in <mark> tags
+func snippet(content string, terms []string) string {
+	// content split in alternating runs of word and non-word characters
+	var tokens []string
+	start, inWord := 0, false
+	for i, r := range content {
+		if i > 0 && inWord == isNotWordRune(r) {
+			tokens = append(tokens, content[start:i])
+			start = i
+		}
+		inWord = !isNotWordRune(r)
+	}
+	if start < len(content) {
+		tokens = append(tokens, content[start:])
+	}
+
+	first := 0
+	for i, t := range tokens {
+		if matchesTerm(t, terms) {
+			first = i
+			break
+		}
+	}
+	from, size := first, 0
+	for from > 0 && size+len([]rune(tokens[from-1])) <= appConstants.SnippetContext {
+		from--
+		size += len([]rune(tokens[from]))
+	}
+	to, size := from, 0
+	for to < len(tokens) && (to == from || size+len([]rune(tokens[to])) <= appConstants.SnippetLength) {
+		size += len([]rune(tokens[to]))
+		to++
+	}
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	for _, t := range tokens[from:to] {
+		if matchesTerm(t, terms) {
+			b.WriteString("<mark>" + html.EscapeString(t) + "</mark>")
+			continue
+		}
+		b.WriteString(html.EscapeString(t))
+	}
+	if to < len(tokens) {
+		b.WriteString("…")
+	}
+	return strings.TrimSpace(b.String())
+}
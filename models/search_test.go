@@ -0,0 +1,113 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchTerms(t *testing.T) {
+	subtests := []struct {
+		name          string
+		q             string
+		expectedTerms []string
+	}{
+		{
+			name:          "words",
+			q:             "First  Post",
+			expectedTerms: []string{"first", "post"},
+		},
+		{
+			name:          "phrase",
+			q:             `"mongo db" go`,
+			expectedTerms: []string{"mongo", "db", "go"},
+		},
+		{
+			name:          "negated",
+			q:             "go -java",
+			expectedTerms: []string{"go"},
+		},
+		{
+			name:          "punctuation",
+			q:             "e-mail's",
+			expectedTerms: []string{"e", "mail", "s"},
+		},
+		{
+			name:          "empty",
+			q:             "  ",
+			expectedTerms: []string{},
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			assert.Equal(t, st.expectedTerms, searchTerms(st.q))
+		})
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	long := strings.Repeat("lorem ", 20) + "mongo " + strings.Repeat("ipsum ", 40)
+
+	subtests := []struct {
+		name            string
+		content         string
+		terms           []string
+		expectedSnippet string
+	}{
+		{
+			name:            "marks-matches",
+			content:         "My first post about MongoDB",
+			terms:           []string{"first", "mongodb"},
+			expectedSnippet: "My <mark>first</mark> post about <mark>MongoDB</mark>",
+		},
+		{
+			name:            "marks-stems",
+			content:         "Posting posts",
+			terms:           []string{"post"},
+			expectedSnippet: "<mark>Posting</mark> <mark>posts</mark>",
+		},
+		{
+			name:            "short-words-match-whole",
+			content:         "go gopher",
+			terms:           []string{"go"},
+			expectedSnippet: "<mark>go</mark> gopher",
+		},
+		{
+			name:            "escapes-html",
+			content:         "<b>bold</b> & post",
+			terms:           []string{"post"},
+			expectedSnippet: "&lt;b&gt;bold&lt;/b&gt; &amp; <mark>post</mark>",
+		},
+		{
+			name:            "no-match",
+			content:         "nothing to see",
+			terms:           []string{"mongo"},
+			expectedSnippet: "nothing to see",
+		},
+		{
+			name:            "cut-around-first-match",
+			content:         long,
+			terms:           []string{"mongo"},
+			expectedSnippet: "…" + strings.Repeat(" lorem", 6) + " <mark>mongo</mark>" + strings.Repeat(" ipsum", 19) + " …",
+		},
+		{
+			name:            "multibyte",
+			content:         "café über post",
+			terms:           []string{"über"},
+			expectedSnippet: "café <mark>über</mark> post",
+		},
+		{
+			name:            "empty",
+			terms:           []string{"mongo"},
+			expectedSnippet: "",
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			assert.Equal(t, st.expectedSnippet, snippet(st.content, st.terms))
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// PostStatus tells who can read a post. Posts without status are published
+type PostStatus string
+
+const (
+	StatusDraft     PostStatus = "draft"
+	StatusScheduled PostStatus = "scheduled"
+	StatusPublished PostStatus = "published"
+	StatusArchived  PostStatus = "archived"
+)
+
+// PostStatuses are the statuses a post can have
+var PostStatuses = []PostStatus{StatusDraft, StatusScheduled, StatusPublished, StatusArchived}
+
+// hiddenStatuses are the statuses of the posts only their author can read. Archived posts are
+// read, listed, searched and counted like published ones
+var hiddenStatuses = []PostStatus{StatusDraft, StatusScheduled}
+
+var (
+	// ErrInvalidStatus is returned for statuses not listed in PostStatuses
+	ErrInvalidStatus = fmt.Errorf("status must be one of %v", joinStatuses(PostStatuses))
+	// ErrPublishAtRequired is returned when saving a scheduled post without a publishAt time
+	ErrPublishAtRequired = errors.New("scheduled posts must have a publishAt time")
+)
+
+func validStatus(s PostStatus) error {
+	if s == "" {
+		return nil
+	}
+	for _, v := range PostStatuses {
+		if v == s {
+			return nil
+		}
+	}
+	return ErrInvalidStatus
+}
+
+// UnmarshalJSON refuses statuses not listed in PostStatuses
+func (s *PostStatus) UnmarshalJSON(b []byte) error {
+	var v string
+	err := json.Unmarshal(b, &v)
+	if err != nil {
+		return err
+	}
+	err = validStatus(PostStatus(v))
+	if err != nil {
+		return err
+	}
+	*s = PostStatus(v)
+	return nil
+}
+
+func statusValue(v any) (any, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, errors.New("expected a string")
+	}
+	err := validStatus(PostStatus(s))
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func timeValue(v any) (any, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, errors.New("expected an RFC 3339 time")
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil, errors.New("expected an RFC 3339 time")
+	}
+	return t.UTC(), nil
+}
+
+// CheckSchedule tells whether the post can be saved as it is: scheduled posts must say when
+// they are published
+func (p *PostDoc) CheckSchedule() error {
+	if p.Status == StatusScheduled && p.PublishAt == nil {
+		return ErrPublishAtRequired
+	}
+	return nil
+}
+
+// patchedSchedule returns the status and publishAt time the post p ends up with once update, built
+// by mergePatchUpdate, is applied to it
+func patchedSchedule(p *PostDoc, update bson.M) *PostDoc {
+	out := &PostDoc{Status: p.Status, PublishAt: p.PublishAt}
+	if set, ok := update["$set"].(bson.M); ok {
+		if s, ok := set["status"].(string); ok {
+			out.Status = PostStatus(s)
+		}
+		if t, ok := set["publishAt"].(time.Time); ok {
+			out.PublishAt = &t
+		}
+	}
+	if unset, ok := update["$unset"].(bson.M); ok {
+		if _, ok := unset["status"]; ok {
+			out.Status = ""
+		}
+		if _, ok := unset["publishAt"]; ok {
+			out.PublishAt = nil
+		}
+	}
+	return out
+}
+
+// VisibleTo tells whether viewer can read the post. Posts not published yet can only be read by
+// their author, and no one else is read when viewer is nil
+func (p *PostDoc) VisibleTo(viewer *primitive.ObjectID) bool {
+	for _, s := range hiddenStatuses {
+		if p.Status == s {
+			return viewer != nil && p.AuthorId != nil && *viewer == *p.AuthorId
+		}
+	}
+	return true
+}
+
+// PostsVisibleTo is the filter of the posts viewer can read, see VisibleTo
+func PostsVisibleTo(viewer *primitive.ObjectID) bson.M {
+	published := bson.M{"status": bson.M{"$nin": hiddenStatuses}}
+	if viewer == nil {
+		return published
+	}
+	return bson.M{"$or": bson.A{published, bson.M{"authorId": *viewer}}}
+}
+
+// WithVisibilityFields returns the projection also selecting the fields telling who can read
+// a post or comment, or nil when p is nil
+func (p Projection) WithVisibilityFields() Projection {
+	return p.with("status", "authorId")
+}
+
+// PublishScheduled publishes the scheduled posts whose publishAt time is not after now, returning
+// how many of them there were. Like counters, the status set this way does not change the version
+func (p *PostDoc) PublishScheduled(ctx context.Context, mCl *mongo.Client, now time.Time, dbName, colName string) (int64, error) {
+	filter := bson.M{"status": StatusScheduled, "publishAt": bson.M{"$lte": now}}
+	update := bson.M{"$set": bson.M{"status": StatusPublished}}
+	res, err := mCl.Database(dbName).Collection(colName).UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+// joinStatuses lists statuses for messages
+func joinStatuses(statuses []PostStatus) string {
+	out := make([]string, len(statuses))
+	for i, s := range statuses {
+		out[i] = string(s)
+	}
+	return strings.Join(out, ", ")
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestVisibleTo(t *testing.T) {
+	authorId, otherId := primitive.NewObjectID(), primitive.NewObjectID()
+
+	subtests := []struct {
+		name            string
+		status          PostStatus
+		viewer          *primitive.ObjectID
+		expectedVisible bool
+	}{
+		{name: "no-status", expectedVisible: true},
+		{name: "published", status: StatusPublished, expectedVisible: true},
+		{name: "archived", status: StatusArchived, expectedVisible: true},
+		{name: "draft-anonymous", status: StatusDraft},
+		{name: "draft-other-author", status: StatusDraft, viewer: &otherId},
+		{name: "draft-own", status: StatusDraft, viewer: &authorId, expectedVisible: true},
+		{name: "scheduled-anonymous", status: StatusScheduled},
+		{name: "scheduled-own", status: StatusScheduled, viewer: &authorId, expectedVisible: true},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			p := &PostDoc{AuthorId: &authorId, Status: st.status}
+			assert.Equal(t, st.expectedVisible, p.VisibleTo(st.viewer))
+		})
+	}
+
+	t.Run("same-statuses-filtered", func(t *testing.T) {
+		hidden := bson.M{"status": bson.M{"$nin": []PostStatus{StatusDraft, StatusScheduled}}}
+		assert.Equal(t, hidden, PostsVisibleTo(nil))
+		assert.Equal(t, bson.M{"$or": bson.A{hidden, bson.M{"authorId": authorId}}}, PostsVisibleTo(&authorId))
+	})
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// TagCount tells how many posts carry a tag
+type TagCount struct {
+	Tag   string `json:"tag" bson:"_id"`
+	Count int64  `json:"count" bson:"count"`
+}
+
+// normalizeTags lowercases and trims tags, dropping empty and repeated ones
+func normalizeTags(tags []string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	return out
+}
+
+func tagsValue(v any) (any, error) {
+	list, ok := v.([]any)
+	if !ok {
+		return nil, errors.New("expected an array of strings")
+	}
+	tags := make([]string, 0, len(list))
+	for _, e := range list {
+		t, ok := e.(string)
+		if !ok {
+			return nil, errors.New("expected an array of strings")
+		}
+		tags = append(tags, t)
+	}
+	if tags = normalizeTags(tags); tags == nil {
+		return []string{}, nil
+	}
+	return tags, nil
+}
+
+// countTags returns up to limit tags used by the posts of a collection anyone can read, see
+// PostsVisibleTo, most used first
+func countTags(ctx context.Context, mCl *mongo.Client, limit int64, dbName, colName string) ([]*TagCount, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: PostsVisibleTo(nil)}},
+		{{Key: "$unwind", Value: "$tags"}},
+		{{Key: "$group", Value: bson.M{"_id": "$tags", "count": bson.M{"$sum": 1}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$limit", Value: limit}},
+	}
+	cur, err := mCl.Database(dbName).Collection(colName).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*TagCount, 0)
+	err = cur.All(ctx, &out)
+	return out, err
+}
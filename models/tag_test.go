@@ -0,0 +1,87 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	subtests := []struct {
+		name         string
+		tags         []string
+		expectedTags []string
+	}{
+		{
+			name: "nil",
+		},
+		{
+			name:         "lowercase-and-trimmed",
+			tags:         []string{" Go ", "MongoDB"},
+			expectedTags: []string{"go", "mongodb"},
+		},
+		{
+			name:         "repeated-kept-once-in-order",
+			tags:         []string{"go", "mongo", "GO", " go"},
+			expectedTags: []string{"go", "mongo"},
+		},
+		{
+			name:         "empty-dropped",
+			tags:         []string{"", "  ", "go"},
+			expectedTags: []string{"go"},
+		},
+		{
+			name: "only-empty",
+			tags: []string{"", " "},
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			assert.Equal(t, st.expectedTags, normalizeTags(st.tags))
+		})
+	}
+}
+
+func TestTagsValue(t *testing.T) {
+	subtests := []struct {
+		name          string
+		value         any
+		expectedValue any
+		expectedErr   string
+	}{
+		{
+			name:          "normalized",
+			value:         []any{"Go", "go", " mongo "},
+			expectedValue: []string{"go", "mongo"},
+		},
+		{
+			name:          "empty",
+			value:         []any{" "},
+			expectedValue: []string{},
+		},
+		{
+			name:        "return-error-not-an-array",
+			value:       "go",
+			expectedErr: "expected an array of strings",
+		},
+		{
+			name:        "return-error-not-strings",
+			value:       []any{"go", 1.0},
+			expectedErr: "expected an array of strings",
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			v, err := tagsValue(st.value)
+			if st.expectedErr != "" {
+				assert.EqualError(t, err, st.expectedErr)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, st.expectedValue, v)
+			}
+		})
+	}
+}
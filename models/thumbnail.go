@@ -0,0 +1,178 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	appConstants "github.com/gjbastidas/GoSimpleAPIWithMongoDB/constants"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ThumbnailTypes are the attachment types thumbnails are made of
+var ThumbnailTypes = []string{"image/png", "image/jpeg", "image/gif"}
+
+// ErrImageTooLarge is returned for images having more than MaxThumbnailPixels
+var ErrImageTooLarge = fmt.Errorf("image must not have more than %d pixels", appConstants.MaxThumbnailPixels)
+
+// HasThumbnails tells whether thumbnails are made of attachments of contentType
+func HasThumbnails(contentType string) bool {
+	return contains(ThumbnailTypes, contentType)
+}
+
+// thumbnailFile is the GridFS file of a thumbnail
+type thumbnailFile struct {
+	Id       primitive.ObjectID `bson:"_id"`
+	Length   int64              `bson:"length"`
+	Metadata struct {
+		ContentType string `bson:"contentType"`
+	} `bson:"metadata"`
+}
+
+// AddThumbnails makes thumbnails of an image attached to the post, fitting in squares of the given
+// sizes. They are stored in GridFS next to the image, which lists their sizes in its thumbnails
+func (p *PostDoc) AddThumbnails(ctx context.Context, mCl *mongo.Client, objId, fileId primitive.ObjectID, sizes []int, dbName, colName string) error {
+	a, content, err := p.OpenAttachment(ctx, mCl, objId, fileId, 0, dbName, colName)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+	if !HasThumbnails(a.ContentType) {
+		return nil
+	}
+
+	// the header tells the size of the image before it takes any memory
+	cfg, _, err := image.DecodeConfig(content)
+	if err != nil {
+		return err
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > appConstants.MaxThumbnailPixels {
+		return ErrImageTooLarge
+	}
+	_, err = content.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	img, _, err := image.Decode(content)
+	if err != nil {
+		return err
+	}
+
+	// thumbnails made before, by a job asked twice, are replaced
+	filter := bson.M{"metadata.thumbnailOf": fileId, "metadata.size": bson.M{"$in": sizes}}
+	err = deleteAttachmentFiles(ctx, mCl, filter, dbName)
+	if err != nil {
+		return err
+	}
+	bucket, err := attachmentBucket(ctx, mCl, dbName)
+	if err != nil {
+		return err
+	}
+	for _, size := range sizes {
+		var buf bytes.Buffer
+		contentType := "image/png"
+		if a.ContentType == "image/jpeg" {
+			contentType = "image/jpeg"
+			err = jpeg.Encode(&buf, thumbnail(img, size), &jpeg.Options{Quality: 85})
+		} else {
+			err = png.Encode(&buf, thumbnail(img, size))
+		}
+		if err != nil {
+			return err
+		}
+		opts := options.GridFSUpload().SetMetadata(bson.M{"postId": objId, "thumbnailOf": fileId, "size": size, "contentType": contentType})
+		err = bucket.UploadFromStreamWithID(primitive.NewObjectID(), a.Name, &buf, opts)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the image may have been removed while its thumbnails were made, which are then removed too
+	res, err := mCl.Database(dbName).Collection(colName).UpdateOne(ctx,
+		bson.M{"_id": objId, "attachments._id": fileId},
+		bson.M{"$addToSet": bson.M{"attachments.$.thumbnails": bson.M{"$each": sizes}}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		err = deleteAttachmentFiles(ctx, mCl, bson.M{"metadata.thumbnailOf": fileId}, dbName)
+		if err != nil {
+			return err
+		}
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// openThumbnail returns the thumbnail of size of attachment a, along with a reader of its content
+func openThumbnail(ctx context.Context, mCl *mongo.Client, a *AttachmentDoc, size int, dbName string) (*AttachmentDoc, io.ReadSeekCloser, error) {
+	found := false
+	for _, s := range a.Thumbnails {
+		found = found || s == size
+	}
+	if !found {
+		return nil, nil, mongo.ErrNoDocuments
+	}
+
+	bucket, err := attachmentBucket(ctx, mCl, dbName)
+	if err != nil {
+		return nil, nil, err
+	}
+	var f thumbnailFile
+	filter := bson.M{"metadata.thumbnailOf": a.Id, "metadata.size": size}
+	err = bucket.GetFilesCollection().FindOne(ctx, filter).Decode(&f)
+	if err != nil {
+		return nil, nil, err
+	}
+	thumb := &AttachmentDoc{Id: a.Id, Name: a.Name, ContentType: f.Metadata.ContentType, Size: f.Length, CreatedAt: a.CreatedAt}
+	return thumb, &attachmentReader{bucket: bucket, fileId: f.Id, size: f.Length}, nil
+}
+
+// thumbnail scales img down to fit in a square of size, each pixel averaging the ones it covers.
+// Images fitting already are kept as they are
+func thumbnail(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= size && h <= size {
+		return img
+	}
+	tw, th := size, size
+	if w > h {
+		th = h * size / w
+	} else {
+		tw = w * size / h
+	}
+	if tw == 0 {
+		tw = 1
+	}
+	if th == 0 {
+		th = 1
+	}
+
+	out := image.NewRGBA64(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := b.Min.Y+y*h/th, b.Min.Y+(y+1)*h/th
+		for x := 0; x < tw; x++ {
+			x0, x1 := b.Min.X+x*w/tw, b.Min.X+(x+1)*w/tw
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, bl, a, n = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+			out.SetRGBA64(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(bl / n), A: uint16(a / n)})
+		}
+	}
+	return out
+}
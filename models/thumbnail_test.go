@@ -0,0 +1,83 @@
+package models
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThumbnail(t *testing.T) {
+	subtests := []struct {
+		name           string
+		bounds         image.Rectangle
+		size           int
+		expectedBounds image.Rectangle
+	}{
+		{
+			name:           "fitting-kept",
+			bounds:         image.Rect(0, 0, 64, 32),
+			size:           64,
+			expectedBounds: image.Rect(0, 0, 64, 32),
+		},
+		{
+			name:           "landscape",
+			bounds:         image.Rect(0, 0, 400, 200),
+			size:           100,
+			expectedBounds: image.Rect(0, 0, 100, 50),
+		},
+		{
+			name:           "portrait",
+			bounds:         image.Rect(0, 0, 200, 400),
+			size:           100,
+			expectedBounds: image.Rect(0, 0, 50, 100),
+		},
+		{
+			name:           "thin-keeps-a-pixel",
+			bounds:         image.Rect(0, 0, 1000, 1),
+			size:           10,
+			expectedBounds: image.Rect(0, 0, 10, 1),
+		},
+		{
+			name:           "not-at-origin",
+			bounds:         image.Rect(10, 20, 210, 120),
+			size:           50,
+			expectedBounds: image.Rect(0, 0, 50, 25),
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			img := image.NewRGBA(st.bounds)
+			assert.Equal(t, st.expectedBounds, thumbnail(img, st.size).Bounds())
+		})
+	}
+
+	t.Run("averages-pixels", func(t *testing.T) {
+		img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+		for y := 0; y < 2; y++ {
+			for x := 0; x < 4; x++ {
+				c := color.RGBA{A: 255}
+				if x%2 == 1 {
+					c = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+				}
+				img.Set(x, y, c)
+			}
+		}
+		thumb := thumbnail(img, 2)
+		if assert.Equal(t, image.Rect(0, 0, 2, 1), thumb.Bounds()) {
+			gray := color.RGBA64{R: 0x7fff, G: 0x7fff, B: 0x7fff, A: 0xffff}
+			assert.Equal(t, gray, thumb.At(0, 0))
+			assert.Equal(t, gray, thumb.At(1, 0))
+		}
+	})
+}
+
+func TestHasThumbnails(t *testing.T) {
+	assert.True(t, HasThumbnails("image/png"))
+	assert.True(t, HasThumbnails("image/jpeg"))
+	assert.True(t, HasThumbnails("image/gif"))
+	assert.False(t, HasThumbnails("image/svg+xml"))
+	assert.False(t, HasThumbnails("text/plain"))
+}
@@ -0,0 +1,323 @@
+package models
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	appConstants "github.com/gjbastidas/GoSimpleAPIWithMongoDB/constants"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type Transfer interface {
+	Export(ctx context.Context, mCl *mongo.Client, w io.Writer, dbName, aColName, pColName, cColName string) error
+	Import(ctx context.Context, mCl *mongo.Client, r io.Reader, upsert, keepIds bool, dbName, aColName, pColName, cColName string) (*ImportReport, error)
+}
+
+// TransferFactory returns a Transfer, see PostFactory
+type TransferFactory func() Transfer
+
+func NewTransfer() Transfer {
+	return new(NDJSONTransfer)
+}
+
+// NDJSONTransfer moves the whole dataset as newline-delimited JSON, one TransferRecord per line
+type NDJSONTransfer struct{}
+
+// TransferRecord is a line of an export. Doc is the stored document as canonical extended JSON,
+// so every bson type survives the trip
+type TransferRecord struct {
+	Type string          `json:"type"`
+	Doc  json.RawMessage `json:"doc"`
+}
+
+// ImportReport tells what an import did with each record. Errors holds the first
+// MaxImportErrors failures along with their line
+type ImportReport struct {
+	Inserted int64    `json:"inserted"`
+	Updated  int64    `json:"updated"`
+	Skipped  int64    `json:"skipped"`
+	Failed   int64    `json:"failed"`
+	Errors   []string `json:"errors,omitempty"`
+	// Reconciled is the number of posts whose comment counters were fixed after importing
+	Reconciled int64 `json:"reconciled"`
+}
+
+// transferType is a type of record, stored in colName. refs are the fields holding ids of
+// other records, either as ObjectIDs or their hex strings. files are the fields listing GridFS
+// files, which are not transferred, so neither are the fields listing them
+type transferType struct {
+	name    string
+	colName string
+	refs    []string
+	files   []string
+}
+
+// transferTypes lists the types of records in the order they are exported, where records
+// come after the ones they refer to
+func transferTypes(aColName, pColName, cColName string) []transferType {
+	return []transferType{
+		{name: "author", colName: aColName},
+		{name: "post", colName: pColName, refs: []string{"authorId"}, files: []string{"attachments"}},
+		{name: "revision", colName: appConstants.RColl, refs: []string{"postId"}, files: []string{"post.attachments"}},
+		{name: "comment", colName: cColName, refs: []string{"authorId", "postId", "detachedFrom", "parentId", "ancestors"}},
+		{name: "reaction", colName: appConstants.ReactColl, refs: []string{"targetId", "authorId"}},
+	}
+}
+
+// Export writes every author, post, revision, comment and reaction to w, reading them
+// through cursors so they are never held in memory all at once. Attachments are left out
+func (t *NDJSONTransfer) Export(ctx context.Context, mCl *mongo.Client, w io.Writer, dbName, aColName, pColName, cColName string) error {
+	enc := json.NewEncoder(w)
+	for _, tt := range transferTypes(aColName, pColName, cColName) {
+		opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+		if len(tt.files) > 0 {
+			projection := bson.M{}
+			for _, f := range tt.files {
+				projection[f] = 0
+			}
+			opts.SetProjection(projection)
+		}
+		cur, err := mCl.Database(dbName).Collection(tt.colName).Find(ctx, bson.M{}, opts)
+		if err != nil {
+			return err
+		}
+		for cur.Next(ctx) {
+			doc, err := bson.MarshalExtJSON(cur.Current, true, false)
+			if err != nil {
+				cur.Close(ctx)
+				return err
+			}
+			err = enc.Encode(&TransferRecord{Type: tt.name, Doc: doc})
+			if err != nil {
+				cur.Close(ctx)
+				return err
+			}
+		}
+		err = cur.Err()
+		cur.Close(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Import stores the records of an export read from r, in batches of MaxBulkItems. Records
+// already stored are replaced when upsert is set, or skipped otherwise. Unless keepIds is set,
+// records get new ids and their references to other imported records follow them.
+// Attachments listed by records are dropped, since their files are not exported, and
+// replaced posts keep their own. Comment counters of posts are reconciled afterwards
+func (t *NDJSONTransfer) Import(ctx context.Context, mCl *mongo.Client, r io.Reader, upsert, keepIds bool, dbName, aColName, pColName, cColName string) (*ImportReport, error) {
+	types := make(map[string]transferType)
+	for _, tt := range transferTypes(aColName, pColName, cColName) {
+		types[tt.name] = tt
+	}
+	im := &importer{mCl: mCl, upsert: upsert, dbName: dbName, report: new(ImportReport)}
+	if !keepIds {
+		im.newIds = make(map[primitive.ObjectID]primitive.ObjectID)
+	}
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), appConstants.MaxImportLine)
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		rec := new(TransferRecord)
+		err := json.Unmarshal(sc.Bytes(), rec)
+		if err != nil {
+			im.fail(line, err)
+			continue
+		}
+		tt, ok := types[rec.Type]
+		if !ok {
+			im.fail(line, fmt.Errorf("unknown record type %q", rec.Type))
+			continue
+		}
+		var doc bson.D
+		err = bson.UnmarshalExtJSON(rec.Doc, true, &doc)
+		if err != nil {
+			im.fail(line, err)
+			continue
+		}
+
+		err = im.add(ctx, tt, line, doc)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	err := im.flush(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	im.report.Reconciled, err = ReconcileCommentCounts(ctx, mCl, dbName, pColName, cColName)
+	if err != nil {
+		return nil, err
+	}
+	return im.report, nil
+}
+
+// importer batches the writes of an import, sending each batch once it is full or the
+// type of records changes
+type importer struct {
+	mCl    *mongo.Client
+	upsert bool
+	dbName string
+	// newIds maps the ids of imported records to the new ones they got, unless ids are kept
+	newIds map[primitive.ObjectID]primitive.ObjectID
+	report *ImportReport
+
+	colName string
+	lines   []int
+	writes  []mongo.WriteModel
+}
+
+func (im *importer) add(ctx context.Context, tt transferType, line int, doc bson.D) error {
+	if tt.colName != im.colName || len(im.writes) == appConstants.MaxBulkItems {
+		err := im.flush(ctx)
+		if err != nil {
+			return err
+		}
+		im.colName = tt.colName
+	}
+
+	var id any
+	for i, e := range doc {
+		switch {
+		case e.Key == "_id":
+			oldId, ok := e.Value.(primitive.ObjectID)
+			if ok && im.newIds != nil {
+				im.newIds[oldId] = primitive.NewObjectID()
+			}
+			doc[i].Value = im.remap(e.Value)
+			id = doc[i].Value
+		case contains(tt.refs, e.Key):
+			doc[i].Value = im.remap(e.Value)
+		}
+	}
+	if id == nil {
+		im.fail(line, errors.New("record has no _id"))
+		return nil
+	}
+	for _, f := range tt.files {
+		doc = dropField(doc, f)
+	}
+
+	if im.upsert {
+		im.writes = append(im.writes, upsertModel(id, doc, tt.files))
+	} else {
+		im.writes = append(im.writes, mongo.NewInsertOneModel().SetDocument(doc))
+	}
+	im.lines = append(im.lines, line)
+	return nil
+}
+
+// upsertModel replaces the record with id by doc, or inserts doc when missing. Replaced records
+// keep their own top level fields out of keep
+func upsertModel(id any, doc bson.D, keep []string) mongo.WriteModel {
+	kept := bson.M{}
+	for _, f := range keep {
+		if !strings.Contains(f, ".") {
+			kept[f] = "$" + f
+		}
+	}
+	if len(kept) == 0 {
+		return mongo.NewReplaceOneModel().SetFilter(bson.M{"_id": id}).SetReplacement(doc).SetUpsert(true)
+	}
+	// $literal keeps values such as "$field" from being read as expressions
+	update := mongo.Pipeline{{{Key: "$replaceWith", Value: bson.M{"$mergeObjects": bson.A{bson.M{"$literal": doc}, kept}}}}}
+	return mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": id}).SetUpdate(update).SetUpsert(true)
+}
+
+// dropField removes from doc the field at path, whose parts are separated by dots
+func dropField(doc bson.D, path string) bson.D {
+	key, rest, nested := strings.Cut(path, ".")
+	out := doc[:0]
+	for _, e := range doc {
+		switch {
+		case e.Key != key:
+		case !nested:
+			continue
+		default:
+			if sub, ok := e.Value.(bson.D); ok {
+				e.Value = dropField(sub, rest)
+			}
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// remap replaces the ids in v that got new ones, whether ObjectIDs, hex strings or arrays of them
+func (im *importer) remap(v any) any {
+	if im.newIds == nil {
+		return v
+	}
+	switch id := v.(type) {
+	case primitive.ObjectID:
+		if newId, ok := im.newIds[id]; ok {
+			return newId
+		}
+	case string:
+		objId, err := primitive.ObjectIDFromHex(id)
+		if newId, ok := im.newIds[objId]; err == nil && ok {
+			return newId.Hex()
+		}
+	case primitive.A:
+		for i := range id {
+			id[i] = im.remap(id[i])
+		}
+	}
+	return v
+}
+
+func (im *importer) flush(ctx context.Context) error {
+	if len(im.writes) == 0 {
+		return nil
+	}
+	res, err := im.mCl.Database(im.dbName).Collection(im.colName).BulkWrite(ctx, im.writes, options.BulkWrite().SetOrdered(false))
+	var bwe mongo.BulkWriteException
+	if err != nil && (!errors.As(err, &bwe) || bwe.WriteConcernError != nil || res == nil) {
+		return err
+	}
+	im.report.Inserted += res.InsertedCount + res.UpsertedCount
+	im.report.Updated += res.MatchedCount
+	for _, we := range bwe.WriteErrors {
+		werr := mongo.WriteException{WriteErrors: mongo.WriteErrors{we.WriteError}}
+		if !im.upsert && mongo.IsDuplicateKeyError(werr) {
+			im.report.Skipped++
+			continue
+		}
+		im.fail(im.lines[we.Index], werr)
+	}
+	im.lines, im.writes = im.lines[:0], im.writes[:0]
+	return nil
+}
+
+func (im *importer) fail(line int, err error) {
+	im.report.Failed++
+	if len(im.report.Errors) < appConstants.MaxImportErrors {
+		im.report.Errors = append(im.report.Errors, fmt.Sprintf("line %d: %v", line, err))
+	}
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestDropField(t *testing.T) {
+	subtests := []struct {
+		name     string
+		doc      bson.D
+		path     string
+		expected bson.D
+	}{
+		{
+			name:     "top-level",
+			doc:      bson.D{{Key: "_id", Value: 1}, {Key: "attachments", Value: bson.A{bson.D{{Key: "_id", Value: 2}}}}, {Key: "content", Value: "fake content"}},
+			path:     "attachments",
+			expected: bson.D{{Key: "_id", Value: 1}, {Key: "content", Value: "fake content"}},
+		},
+		{
+			name:     "nested",
+			doc:      bson.D{{Key: "_id", Value: 1}, {Key: "post", Value: bson.D{{Key: "content", Value: "fake content"}, {Key: "attachments", Value: bson.A{}}}}},
+			path:     "post.attachments",
+			expected: bson.D{{Key: "_id", Value: 1}, {Key: "post", Value: bson.D{{Key: "content", Value: "fake content"}}}},
+		},
+		{
+			name:     "missing",
+			doc:      bson.D{{Key: "_id", Value: 1}, {Key: "post", Value: "fake post"}},
+			path:     "post.attachments",
+			expected: bson.D{{Key: "_id", Value: 1}, {Key: "post", Value: "fake post"}},
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			assert.Equal(t, st.expected, dropField(st.doc, st.path))
+		})
+	}
+}
+
+func TestUpsertModel(t *testing.T) {
+	doc := bson.D{{Key: "_id", Value: 1}, {Key: "content", Value: "fake content"}}
+
+	t.Run("replace", func(t *testing.T) {
+		model, ok := upsertModel(1, doc, []string{"post.attachments"}).(*mongo.ReplaceOneModel)
+		if assert.True(t, ok) {
+			assert.Equal(t, doc, model.Replacement)
+			assert.True(t, *model.Upsert)
+		}
+	})
+
+	t.Run("keep-stored-fields", func(t *testing.T) {
+		model, ok := upsertModel(1, doc, []string{"attachments"}).(*mongo.UpdateOneModel)
+		if assert.True(t, ok) {
+			expected := mongo.Pipeline{{{Key: "$replaceWith", Value: bson.M{"$mergeObjects": bson.A{bson.M{"$literal": doc}, bson.M{"attachments": "$attachments"}}}}}}
+			assert.Equal(t, expected, model.Update)
+			assert.True(t, *model.Upsert)
+		}
+	})
+}
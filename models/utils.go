@@ -2,7 +2,9 @@ package models
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	appConstants "github.com/gjbastidas/GoSimpleAPIWithMongoDB/constants"
 	"go.mongodb.org/mongo-driver/bson"
@@ -12,18 +14,26 @@ import (
 )
 
 type Models struct {
-	P        Post
+	P        PostFactory
 	PColName string
-	C        Comment
+	C        CommentFactory
 	CColName string
+	A        AuthorFactory
+	AColName string
+	S        SearchFactory
+	T        TransferFactory
 }
 
 func NewModels() *Models {
 	return &Models{
-		P:        &PostDoc{},
+		P:        NewPost,
 		PColName: appConstants.PColl,
-		C:        &CommentDoc{},
+		C:        NewComment,
 		CColName: appConstants.CColl,
+		A:        NewAuthor,
+		AColName: appConstants.AColl,
+		S:        NewSearch,
+		T:        NewTransfer,
 	}
 }
 
@@ -33,38 +43,357 @@ func NewClient(DbUsername, DbPassword, DbHost, DbPort string) (*mongo.Client, er
 	return mongo.Connect(context.TODO(), mClientOpts)
 }
 
+// EnsureIndexes creates the indexes the queries of this package rely on
+func EnsureIndexes(ctx context.Context, mCl *mongo.Client, dbName string) error {
+	indexes := map[string][]mongo.IndexModel{
+		appConstants.AColl: {
+			{Keys: bson.D{{Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		appConstants.PColl: {
+			{Keys: bson.D{{Key: "authorId", Value: 1}, {Key: "_id", Value: 1}}},
+			{Keys: bson.D{{Key: "tags", Value: 1}, {Key: "_id", Value: 1}}},
+			{Keys: bson.D{{Key: "createdAt", Value: -1}}},
+			{Keys: bson.D{{Key: "updatedAt", Value: -1}}},
+			{Keys: bson.D{{Key: "status", Value: 1}, {Key: "publishAt", Value: 1}}},
+			{Keys: bson.D{{Key: "content", Value: "text"}, {Key: "author", Value: "text"}}},
+		},
+		appConstants.CColl: {
+			{Keys: bson.D{{Key: "postId", Value: 1}, {Key: "_id", Value: 1}}},
+			{Keys: bson.D{{Key: "postId", Value: 1}, {Key: "createdAt", Value: 1}}},
+			{Keys: bson.D{{Key: "postId", Value: 1}, {Key: "depth", Value: 1}}},
+			{Keys: bson.D{{Key: "authorId", Value: 1}, {Key: "_id", Value: 1}}},
+			{Keys: bson.D{{Key: "status", Value: 1}, {Key: "_id", Value: 1}}},
+			{Keys: bson.D{{Key: "updatedAt", Value: -1}}},
+			{Keys: bson.D{{Key: "content", Value: "text"}, {Key: "author", Value: "text"}}},
+		},
+		appConstants.ReactColl: {
+			{Keys: bson.D{{Key: "targetId", Value: 1}, {Key: "authorId", Value: 1}, {Key: "type", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		appConstants.AttachmentBucket + ".files": {
+			{Keys: bson.D{{Key: "metadata.postId", Value: 1}}},
+		},
+		appConstants.RColl: {
+			{Keys: bson.D{{Key: "postId", Value: 1}, {Key: "revision", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "postId", Value: 1}, {Key: "_id", Value: 1}}},
+		},
+	}
+	for colName, models := range indexes {
+		_, err := mCl.Database(dbName).Collection(colName).Indexes().CreateMany(ctx, models)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 type AnyDoc interface {
-	*PostDoc | *CommentDoc
+	*PostDoc | *CommentDoc | *RevisionDoc | *AuthorDoc | *ReactionDoc
+	getId() primitive.ObjectID
+	// initialize sets the server managed fields of a new document
+	initialize(now time.Time)
+}
+
+// Page is a batch of documents plus the cursor to request the following batch
+type Page[D any] struct {
+	Items []D    `json:"items"`
+	Next  string `json:"next,omitempty"`
 }
 
-func createOneRecord[D AnyDoc](mCl *mongo.Client, d D, dbName, colName string) (*mongo.InsertOneResult, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), appConstants.RequestTimeout)
-	defer cancel()
+func createOneRecord[D AnyDoc](ctx context.Context, mCl *mongo.Client, d D, dbName, colName string) (*mongo.InsertOneResult, error) {
+	d.initialize(time.Now().UTC())
 	res, err := mCl.Database(dbName).Collection(colName).InsertOne(ctx, d)
 	return res, err
 }
 
-func readOneRecord[D AnyDoc](mCl *mongo.Client, d D, objId primitive.ObjectID, dbName, colName string) (D, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), appConstants.RequestTimeout)
-	defer cancel()
+// readOneRecord decodes into d the document with id objId, reading only the fields of projection
+func readOneRecord[D AnyDoc](ctx context.Context, mCl *mongo.Client, d D, objId primitive.ObjectID, projection Projection, dbName, colName string) (D, error) {
 	filter := bson.M{"_id": objId}
-	err := mCl.Database(dbName).Collection(colName).FindOne(ctx, filter).Decode(d)
+	opts := options.FindOne()
+	if projection != nil {
+		opts.SetProjection(projection)
+	}
+	err := mCl.Database(dbName).Collection(colName).FindOne(ctx, filter, opts).Decode(d)
 	return d, err
 }
 
-func updateOneRecord[D AnyDoc](mCl *mongo.Client, d D, objId primitive.ObjectID, dbName, colName string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), appConstants.RequestTimeout)
-	defer cancel()
-	filter := bson.M{"_id": objId}
-	update := bson.M{"$set": d}
-	_, err := mCl.Database(dbName).Collection(colName).UpdateOne(ctx, filter, update)
-	return err
+func findManyRecords[D AnyDoc](ctx context.Context, mCl *mongo.Client, filter bson.M, opts *options.FindOptions, dbName, colName string) ([]D, error) {
+	cur, err := mCl.Database(dbName).Collection(colName).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]D, 0)
+	err = cur.All(ctx, &out)
+	return out, err
 }
 
-func deleteOneRecord(mCl *mongo.Client, objId primitive.ObjectID, dbName, colName string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), appConstants.RequestTimeout)
-	defer cancel()
+// findPage fetches up to limit documents whose _id comes after cursor, in ascending
+// _id order or descending when newestFirst is set
+func findPage[D AnyDoc](ctx context.Context, mCl *mongo.Client, filter bson.M, cursor primitive.ObjectID, limit int64, newestFirst bool, dbName, colName string) (*Page[D], error) {
+	op, order := "$gt", 1
+	if newestFirst {
+		op, order = "$lt", -1
+	}
+	if !cursor.IsZero() {
+		filter["_id"] = bson.M{op: cursor}
+	}
+	// one extra document tells whether there is a next page
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: order}}).SetLimit(limit + 1)
+	docs, err := findManyRecords[D](ctx, mCl, filter, opts, dbName, colName)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &Page[D]{Items: docs}
+	if int64(len(docs)) > limit {
+		out.Items = docs[:limit]
+		out.Next = out.Items[limit-1].getId().Hex()
+	}
+	return out, nil
+}
+
+// findQueryPage fetches up to limit documents matching filter and the filter of query, in the
+// order of query and from its cursor
+func findQueryPage[D AnyDoc](ctx context.Context, mCl *mongo.Client, filter bson.M, query *ListQuery, limit int64, dbName, colName string) (*Page[D], error) {
+	// one extra document tells whether there is a next page
+	opts := options.Find().SetSort(query.sort).SetLimit(limit + 1)
+	if query.projection != nil {
+		opts.SetProjection(query.projection.with(query.sortKeys()...))
+	}
+	cur, err := mCl.Database(dbName).Collection(colName).Find(ctx, query.match(filter), opts)
+	if err != nil {
+		return nil, err
+	}
+	return decodeQueryPage[D](ctx, cur, query, limit)
+}
+
+// aggregateQueryPage is findQueryPage running stages, which may only leave documents out, over
+// the documents matched before the page is cut
+func aggregateQueryPage[D AnyDoc](ctx context.Context, mCl *mongo.Client, filter bson.M, query *ListQuery, stages mongo.Pipeline, limit int64, dbName, colName string) (*Page[D], error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: query.match(filter)}},
+		{{Key: "$sort", Value: query.sort}},
+	}
+	pipeline = append(pipeline, stages...)
+	pipeline = append(pipeline, bson.D{{Key: "$limit", Value: limit + 1}})
+	if query.projection != nil {
+		pipeline = append(pipeline, bson.D{{Key: "$project", Value: query.projection.with(query.sortKeys()...)}})
+	}
+	cur, err := mCl.Database(dbName).Collection(colName).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	return decodeQueryPage[D](ctx, cur, query, limit)
+}
+
+// decodeQueryPage decodes the page of query out of cur, holding up to limit + 1 documents
+func decodeQueryPage[D AnyDoc](ctx context.Context, cur *mongo.Cursor, query *ListQuery, limit int64) (*Page[D], error) {
+	// raw documents keep the sort values cursors are made of
+	raws := make([]bson.Raw, 0)
+	err := cur.All(ctx, &raws)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &Page[D]{Items: make([]D, 0, len(raws))}
+	for i, raw := range raws {
+		if int64(i) == limit {
+			out.Next = query.cursorOf(raws[i-1])
+			break
+		}
+		if query.projection != nil {
+			raw, err = query.projection.trim(raw)
+			if err != nil {
+				return nil, err
+			}
+		}
+		var d D
+		err = bson.Unmarshal(raw, &d)
+		if err != nil {
+			return nil, err
+		}
+		out.Items = append(out.Items, d)
+	}
+	return out, nil
+}
+
+// versionFilter selects a document by id and, unless version is 0, by its current version
+func versionFilter(objId primitive.ObjectID, version int64) bson.M {
 	filter := bson.M{"_id": objId}
-	_, err := mCl.Database(dbName).Collection(colName).DeleteOne(ctx, filter)
-	return err
+	if version != 0 {
+		filter["version"] = version
+	}
+	return filter
+}
+
+// matchedVersion turns an update or delete that hit no document into an error
+func matchedVersion(matched, version int64) error {
+	switch {
+	case matched > 0:
+		return nil
+	case version != 0:
+		return ErrVersionMismatch
+	default:
+		return mongo.ErrNoDocuments
+	}
+}
+
+// replacement builds the update that overwrites a document with d, bumps its version and sets
+// updatedAt. Fields listed in keep are managed by the server and retain their stored value
+func replacement[D AnyDoc](d D, keep []string) (mongo.Pipeline, error) {
+	managed := bson.M{
+		"_id":       "$_id",
+		"version":   bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$version", 0}}, 1}},
+		"createdAt": "$createdAt",
+		"updatedAt": "$$NOW",
+	}
+	for _, k := range keep {
+		managed[k] = "$" + k
+	}
+
+	// managed fields missing from the stored document are left out of $mergeObjects,
+	// so they are dropped from d as well for the values sent not to be written instead
+	raw, err := bson.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	var sent bson.D
+	err = bson.Unmarshal(raw, &sent)
+	if err != nil {
+		return nil, err
+	}
+	doc := bson.D{}
+	for _, e := range sent {
+		if _, ok := managed[e.Key]; !ok {
+			doc = append(doc, e)
+		}
+	}
+	// $literal keeps client values such as "$field" from being read as expressions
+	return mongo.Pipeline{{{Key: "$replaceWith", Value: bson.M{"$mergeObjects": bson.A{bson.M{"$literal": doc}, managed}}}}}, nil
+}
+
+// versionedUpdate adds to update the operators that bump the version and set updatedAt
+func versionedUpdate(update bson.M) bson.M {
+	update["$inc"] = bson.M{"version": 1}
+	update["$currentDate"] = bson.M{"updatedAt": true}
+	return update
+}
+
+func replaceOneRecord[D AnyDoc](ctx context.Context, mCl *mongo.Client, d D, keep []string, objId primitive.ObjectID, version int64, dbName, colName string) error {
+	update, err := replacement(d, keep)
+	if err != nil {
+		return err
+	}
+	return updateOneRecord(ctx, mCl, update, objId, version, dbName, colName)
+}
+
+func updateOneRecord(ctx context.Context, mCl *mongo.Client, update any, objId primitive.ObjectID, version int64, dbName, colName string) error {
+	res, err := mCl.Database(dbName).Collection(colName).UpdateOne(ctx, versionFilter(objId, version), update)
+	if err != nil {
+		return err
+	}
+	return matchedVersion(res.MatchedCount, version)
+}
+
+// findOneAndUpdateRecord applies update and decodes into d the document as it was before
+func findOneAndUpdateRecord[D AnyDoc](ctx context.Context, mCl *mongo.Client, d D, update any, objId primitive.ObjectID, version int64, dbName, colName string) (D, error) {
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+	err := mCl.Database(dbName).Collection(colName).FindOneAndUpdate(ctx, versionFilter(objId, version), update, opts).Decode(d)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return d, matchedVersion(0, version)
+	}
+	return d, err
+}
+
+// findOneAndDeleteRecord deletes a document and decodes it into d
+func findOneAndDeleteRecord[D AnyDoc](ctx context.Context, mCl *mongo.Client, d D, objId primitive.ObjectID, version int64, dbName, colName string) (D, error) {
+	err := mCl.Database(dbName).Collection(colName).FindOneAndDelete(ctx, versionFilter(objId, version)).Decode(d)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return d, matchedVersion(0, version)
+	}
+	return d, err
+}
+
+func deleteOneRecord(ctx context.Context, mCl *mongo.Client, objId primitive.ObjectID, version int64, dbName, colName string) error {
+	res, err := mCl.Database(dbName).Collection(colName).DeleteOne(ctx, versionFilter(objId, version))
+	if err != nil {
+		return err
+	}
+	return matchedVersion(res.DeletedCount, version)
+}
+
+// withTransaction runs fn inside a multi-document transaction, retrying it on transient errors.
+// Transactions require MongoDB to run as a replica set
+func withTransaction[T any](ctx context.Context, mCl *mongo.Client, fn func(sCtx mongo.SessionContext) (T, error)) (T, error) {
+	var out T
+	sess, err := mCl.StartSession()
+	if err != nil {
+		return out, err
+	}
+	defer sess.EndSession(ctx)
+
+	res, err := sess.WithTransaction(ctx, func(sCtx mongo.SessionContext) (interface{}, error) {
+		return fn(sCtx)
+	})
+	if err != nil {
+		return out, err
+	}
+	return res.(T), nil
+}
+
+var (
+	// ErrInvalidPatch is returned when a merge patch touches unknown or read-only fields
+	ErrInvalidPatch = errors.New("invalid merge patch")
+	// ErrVersionMismatch is returned when a conditional write finds a different document version
+	ErrVersionMismatch = errors.New("document version mismatch")
+)
+
+// patchRules maps the fields a merge patch may touch to a function validating and
+// converting the new value. Patchable fields share their name in json and bson
+type patchRules map[string]func(v any) (any, error)
+
+func stringValue(v any) (any, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, errors.New("expected a string")
+	}
+	return s, nil
+}
+
+// mergePatchUpdate translates a JSON merge patch (RFC 7396) into an update document
+// where null values remove their field and any other value replaces it
+func mergePatchUpdate(patch map[string]any, rules patchRules) (bson.M, error) {
+	set, unset := bson.M{}, bson.M{}
+	for k, v := range patch {
+		conv, ok := rules[k]
+		if !ok {
+			return nil, fmt.Errorf("%w: field %q cannot be patched", ErrInvalidPatch, k)
+		}
+		if v == nil {
+			unset[k] = ""
+			continue
+		}
+		val, err := conv(v)
+		if err != nil {
+			return nil, fmt.Errorf("%w: field %q: %v", ErrInvalidPatch, k, err)
+		}
+		set[k] = val
+	}
+
+	update := bson.M{}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	return update, nil
+}
+
+// patchOneRecord applies a merge patch to a document and bumps its version
+func patchOneRecord(ctx context.Context, mCl *mongo.Client, patch map[string]any, rules patchRules, objId primitive.ObjectID, version int64, dbName, colName string) error {
+	update, err := mergePatchUpdate(patch, rules)
+	if err != nil {
+		return err
+	}
+	return updateOneRecord(ctx, mCl, versionedUpdate(update), objId, version, dbName, colName)
 }
@@ -0,0 +1,334 @@
+package models
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestInitialize(t *testing.T) {
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	past := now.Add(-time.Hour)
+	fileId := primitive.NewObjectID()
+	parentId := primitive.NewObjectID().Hex()
+
+	subtests := []struct {
+		name     string
+		doc      interface{ initialize(now time.Time) }
+		expected any
+	}{
+		{
+			name: "post-server-managed-fields",
+			doc: &PostDoc{
+				Content:       "fake content",
+				Reactions:     map[string]int64{"like": 100},
+				Attachments:   []*AttachmentDoc{{Id: fileId, Name: "fake.png"}},
+				CommentCount:  100,
+				LastCommentAt: &past,
+			},
+			expected: &PostDoc{Content: "fake content", Version: 1, CreatedAt: &now, UpdatedAt: &now},
+		},
+		{
+			name: "comment-server-managed-fields",
+			doc: &CommentDoc{
+				Content:      "fake comment",
+				Reactions:    map[string]int64{"like": 100},
+				DetachedFrom: primitive.NewObjectID().Hex(),
+				StatusReason: "fake reason",
+				ModeratedAt:  &past,
+			},
+			expected: &CommentDoc{Content: "fake comment", Version: 1, CreatedAt: &now, UpdatedAt: &now},
+		},
+		{
+			name:     "comment-thread-without-parent",
+			doc:      &CommentDoc{Content: "fake comment", Ancestors: []string{parentId}, Depth: 50},
+			expected: &CommentDoc{Content: "fake comment", Version: 1, CreatedAt: &now, UpdatedAt: &now},
+		},
+		{
+			name:     "comment-thread-from-parent",
+			doc:      &CommentDoc{Content: "fake reply", ParentId: parentId, Ancestors: []string{parentId}, Depth: 1},
+			expected: &CommentDoc{Content: "fake reply", ParentId: parentId, Ancestors: []string{parentId}, Depth: 1, Version: 1, CreatedAt: &now, UpdatedAt: &now},
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			st.doc.initialize(now)
+			assert.Equal(t, st.expected, st.doc)
+		})
+	}
+}
+
+func TestMergePatchUpdate(t *testing.T) {
+	publishAt := time.Date(2030, 1, 2, 8, 0, 0, 0, time.UTC)
+
+	subtests := []struct {
+		name           string
+		patch          map[string]any
+		rules          patchRules
+		expectedUpdate bson.M
+		expectedErr    string
+	}{
+		{
+			name:           "empty",
+			patch:          map[string]any{},
+			rules:          postPatchRules,
+			expectedUpdate: bson.M{},
+		},
+		{
+			name:           "set",
+			patch:          map[string]any{"content": "patched content", "tags": []any{"Go", "go"}},
+			rules:          postPatchRules,
+			expectedUpdate: bson.M{"$set": bson.M{"content": "patched content", "tags": []string{"go"}}},
+		},
+		{
+			name:           "unset-null",
+			patch:          map[string]any{"publishAt": nil, "tags": nil},
+			rules:          postPatchRules,
+			expectedUpdate: bson.M{"$unset": bson.M{"publishAt": "", "tags": ""}},
+		},
+		{
+			name:  "set-and-unset",
+			patch: map[string]any{"status": "scheduled", "publishAt": "2030-01-02T09:00:00+01:00", "moderation": nil},
+			rules: postPatchRules,
+			expectedUpdate: bson.M{
+				"$set":   bson.M{"status": "scheduled", "publishAt": publishAt},
+				"$unset": bson.M{"moderation": ""},
+			},
+		},
+		{
+			name:        "return-error-read-only-field",
+			patch:       map[string]any{"authorId": "5f1e2d3c4b5a69788796a5b4"},
+			rules:       postPatchRules,
+			expectedErr: `invalid merge patch: field "authorId" cannot be patched`,
+		},
+		{
+			name:        "return-error-field-of-other-type",
+			patch:       map[string]any{"tags": []any{"go"}},
+			rules:       commentPatchRules,
+			expectedErr: `invalid merge patch: field "tags" cannot be patched`,
+		},
+		{
+			name:        "return-error-nested-operator",
+			patch:       map[string]any{"$set": map[string]any{"authorId": nil}},
+			rules:       postPatchRules,
+			expectedErr: `invalid merge patch: field "$set" cannot be patched`,
+		},
+		{
+			name:        "return-error-wrong-type",
+			patch:       map[string]any{"content": 1.0},
+			rules:       commentPatchRules,
+			expectedErr: `invalid merge patch: field "content": expected a string`,
+		},
+		{
+			name:        "return-error-invalid-value",
+			patch:       map[string]any{"publishAt": "tomorrow"},
+			rules:       postPatchRules,
+			expectedErr: `invalid merge patch: field "publishAt": expected an RFC 3339 time`,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			update, err := mergePatchUpdate(st.patch, st.rules)
+			if st.expectedErr != "" {
+				assert.ErrorIs(t, err, ErrInvalidPatch)
+				assert.EqualError(t, err, st.expectedErr)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, st.expectedUpdate, update)
+			}
+		})
+	}
+}
+
+func TestTimestamps(t *testing.T) {
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	sent := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("client-timestamps-ignored-on-create", func(t *testing.T) {
+		p := &PostDoc{Version: 7, CreatedAt: &sent, UpdatedAt: &sent}
+		p.initialize(now)
+		assert.EqualValues(t, 1, p.Version)
+		assert.Equal(t, now, *p.CreatedAt)
+		assert.Equal(t, now, *p.UpdatedAt)
+
+		c := &CommentDoc{Version: 7, CreatedAt: &sent, UpdatedAt: &sent}
+		c.initialize(now)
+		assert.EqualValues(t, 1, c.Version)
+		assert.Equal(t, now, *c.CreatedAt)
+		assert.Equal(t, now, *c.UpdatedAt)
+
+		a := &AuthorDoc{Name: "fake author", CreatedAt: &sent}
+		a.initialize(now)
+		assert.Equal(t, now, *a.CreatedAt)
+	})
+
+	t.Run("updated-at-set-on-update", func(t *testing.T) {
+		update := versionedUpdate(bson.M{"$set": bson.M{"content": "patched content"}})
+		assert.Equal(t, bson.M{"content": "patched content"}, update["$set"])
+		assert.Equal(t, bson.M{"version": 1}, update["$inc"])
+		assert.Equal(t, bson.M{"updatedAt": true}, update["$currentDate"])
+	})
+
+	t.Run("client-timestamps-rejected-on-patch", func(t *testing.T) {
+		for _, k := range []string{"createdAt", "updatedAt"} {
+			_, err := mergePatchUpdate(map[string]any{k: sent.Format(time.RFC3339)}, postPatchRules)
+			assert.ErrorIs(t, err, ErrInvalidPatch)
+		}
+	})
+}
+
+func TestReplaceTimestamps(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	created := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	sent := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	objId := primitive.NewObjectID()
+
+	subtests := []struct {
+		name             string
+		stored           bson.M
+		expectedReplaced bson.M
+	}{
+		{
+			name:             "stored-created-at-kept",
+			stored:           bson.M{"_id": objId, "content": "fake comment", "createdAt": created},
+			expectedReplaced: bson.M{"_id": objId, "content": "replaced comment", "createdAt": created, "updatedAt": now},
+		},
+		{
+			// documents stored before timestamps existed have none
+			name:             "missing-created-at-not-set",
+			stored:           bson.M{"_id": objId, "content": "fake comment"},
+			expectedReplaced: bson.M{"_id": objId, "content": "replaced comment", "updatedAt": now},
+		},
+	}
+
+	for _, st := range subtests {
+		mt.Run(st.name, func(mt *mtest.T) {
+			mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+			c := &CommentDoc{Content: "replaced comment", Version: 7, CreatedAt: &sent, UpdatedAt: &sent}
+			err := c.ReplaceComment(context.Background(), mt.Client, objId, 0, "fakeDb", "fakeCommentCol")
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			var cmd struct {
+				Updates []struct {
+					U []bson.M `bson:"u"`
+				} `bson:"updates"`
+			}
+			if assert.NoError(t, bson.Unmarshal(mt.GetStartedEvent().Command, &cmd)) && assert.Len(t, cmd.Updates, 1) {
+				assert.Equal(t, st.expectedReplaced, replaceWith(st.stored, cmd.Updates[0].U, now))
+			}
+		})
+	}
+}
+
+// replaceWith runs over stored the $replaceWith pipeline built by replacement the way MongoDB does,
+// where fields read from stored are left out of $mergeObjects when stored lacks them. The version
+// is left out
+func replaceWith(stored bson.M, pipeline []bson.M, now time.Time) bson.M {
+	merged := pipeline[0]["$replaceWith"].(bson.M)["$mergeObjects"].(bson.A)
+	out := bson.M{}
+	for k, v := range merged[0].(bson.M)["$literal"].(bson.M) {
+		out[k] = v
+	}
+	for k, v := range merged[1].(bson.M) {
+		path, ok := v.(string)
+		switch {
+		case !ok:
+		case path == "$$NOW":
+			out[k] = now
+		default:
+			if v, ok := stored[strings.TrimPrefix(path, "$")]; ok {
+				out[k] = v
+			}
+		}
+	}
+	delete(out, "version")
+	return out
+}
+
+func TestReplacement(t *testing.T) {
+	sent := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	authorId := primitive.NewObjectID()
+	parentId := primitive.NewObjectID().Hex()
+
+	subtests := []struct {
+		name        string
+		pipeline    func() (mongo.Pipeline, error)
+		keep        []string
+		expectedDoc bson.D
+	}{
+		{
+			name: "post",
+			pipeline: func() (mongo.Pipeline, error) {
+				return replacement(&PostDoc{
+					Id:            primitive.NewObjectID(),
+					Content:       "replaced content",
+					AuthorId:      &authorId,
+					Author:        "fake author",
+					Tags:          []string{"go"},
+					Reactions:     map[string]int64{"like": 100},
+					Attachments:   []*AttachmentDoc{{Id: primitive.NewObjectID(), Name: "fake.png"}},
+					CommentCount:  100,
+					LastCommentAt: &sent,
+					Version:       7,
+					CreatedAt:     &sent,
+					UpdatedAt:     &sent,
+				}, postKeepFields)
+			},
+			keep:        postKeepFields,
+			expectedDoc: bson.D{{Key: "content", Value: "replaced content"}, {Key: "tags", Value: bson.A{"go"}}},
+		},
+		{
+			name: "comment",
+			pipeline: func() (mongo.Pipeline, error) {
+				return replacement(&CommentDoc{
+					Content:      "replaced comment",
+					AuthorId:     &authorId,
+					PostId:       primitive.NewObjectID().Hex(),
+					DetachedFrom: primitive.NewObjectID().Hex(),
+					ParentId:     parentId,
+					Ancestors:    []string{parentId},
+					Depth:        1,
+					Reactions:    map[string]int64{"like": 100},
+					Status:       CommentApproved,
+					StatusReason: "fake reason",
+					ModeratedAt:  &sent,
+					CreatedAt:    &sent,
+				}, commentKeepFields)
+			},
+			keep:        commentKeepFields,
+			expectedDoc: bson.D{{Key: "content", Value: "replaced comment"}},
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			pipeline, err := st.pipeline()
+			if !assert.NoError(t, err) || !assert.Len(t, pipeline, 1) {
+				return
+			}
+			merged := pipeline[0][0].Value.(bson.M)["$mergeObjects"].(bson.A)
+			// a managed field missing from the stored document is left out of the merge,
+			// so none may be sent or the value sent would be written
+			assert.Equal(t, bson.M{"$literal": st.expectedDoc}, merged[0])
+			managed := merged[1].(bson.M)
+			for _, k := range st.keep {
+				assert.Equal(t, "$"+k, managed[k])
+			}
+		})
+	}
+}